@@ -1,13 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/aslam/backend/internal/database"
 	"github.com/aslam/backend/internal/handlers"
 	"github.com/aslam/backend/internal/middleware"
+	"github.com/aslam/backend/internal/storage"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
@@ -49,7 +52,7 @@ func main() {
 	}
 
 	// Create initial admin user if no users exist
-	users, err := db.ListUsers(nil)
+	users, _, err := db.ListUsers(nil, nil)
 	if err == nil && len(users) == 0 {
 		adminEmail := "admin@aslam.local"
 		adminPass := "Admin@123456"
@@ -59,6 +62,15 @@ func main() {
 		}
 	}
 
+	// Media storage
+	store, err := newStorage()
+	if err != nil {
+		log.Fatalf("Failed to set up media storage: %v", err)
+	}
+
+	// Raise low-stock alerts in the background
+	go db.WatchStockLevels(context.Background(), 5*time.Minute)
+
 	// Router setup
 	router := gin.Default()
 
@@ -72,6 +84,9 @@ func main() {
 		public.POST("/login", handlers.Login(db))
 	}
 
+	// Uploaded media, for storage drivers that do not serve files themselves
+	router.GET("/media/*key", handlers.ServeMedia(store))
+
 	// Protected routes
 	protected := router.Group("/api")
 	protected.Use(middleware.AuthMiddleware())
@@ -96,10 +111,33 @@ func main() {
 		products := protected.Group("/products")
 		{
 			products.GET("", handlers.ListProducts(db))
+			products.GET("/search", handlers.SearchProducts(db))
 			products.GET("/:sku", handlers.GetProduct(db))
 			products.POST("", handlers.CreateProduct(db))
 			products.PUT("/:sku", handlers.UpdateProduct(db))
-			products.DELETE("/:sku", handlers.DeleteProduct(db))
+			products.DELETE("/:sku", handlers.ArchiveProduct(db))
+			products.POST("/:sku/restore", handlers.RestoreProduct(db))
+			products.GET("/:sku/units", handlers.ListProductUnits(db))
+			products.PUT("/:sku/units", handlers.SetProductUnits(db))
+			products.GET("/:sku/barcodes", handlers.ListBarcodes(db))
+			products.POST("/:sku/barcodes", handlers.AddBarcode(db))
+			products.DELETE("/:sku/barcodes/:code", handlers.DeleteBarcode(db))
+			products.GET("/:sku/media", handlers.ListMedia(db))
+			products.POST("/:sku/media", handlers.UploadMedia(db, store))
+			products.DELETE("/:sku/media/:id", handlers.DeleteMedia(db, store))
+		}
+
+		// Category tree
+		categories := protected.Group("/categories")
+		{
+			categories.GET("", handlers.ListCategories(db))
+			categories.GET("/:id", handlers.GetCategory(db))
+			categories.POST("", handlers.CreateCategory(db))
+			categories.PUT("/:id", handlers.RenameCategory(db))
+			categories.POST("/:id/move", handlers.MoveCategory(db))
+			categories.DELETE("/:id", handlers.DeleteCategory(db))
+			categories.GET("/:id/attributes", handlers.ListAttributes(db))
+			categories.PUT("/:id/attributes", handlers.SetAttributes(db))
 		}
 
 		// Shelf endpoints
@@ -109,12 +147,100 @@ func main() {
 			shelves.GET("/:id", handlers.GetShelf(db))
 			shelves.POST("", handlers.CreateShelf(db))
 			shelves.PUT("/:id", handlers.UpdateShelf(db))
-			shelves.DELETE("/:id", handlers.DeleteShelf(db))
+			shelves.DELETE("/:id", handlers.ArchiveShelf(db))
+			shelves.POST("/:id/restore", handlers.RestoreShelf(db))
 			shelves.POST("/:id/items", handlers.AddItemToShelf(db))
 			shelves.DELETE("/:id/items/:itemId", handlers.RemoveItemFromShelf(db))
 			shelves.PUT("/:id/items/:itemId", handlers.UpdateItemQuantity(db))
 		}
 
+		// Serial number lookup
+		protected.GET("/serials/:serial", handlers.GetSerial(db))
+
+		// Resolve any scanned barcode or shelf label
+		protected.GET("/scan/:code", handlers.Scan(db))
+
+		// Printable product and shelf labels
+		labels := protected.Group("/labels")
+		{
+			labels.GET("/products/:sku", handlers.GetProductLabel(db))
+			labels.GET("/shelves", handlers.GetShelfLabels(db))
+			labels.GET("/shelves/:id", handlers.GetShelfLabel(db))
+		}
+
+		// Lot expiry
+		protected.GET("/stock/expiring", handlers.ListExpiringStock(db))
+
+		// Reorder points and low-stock alerts
+		protected.GET("/stock/reorder", handlers.ListBelowReorder(db))
+		protected.GET("/stock/alerts", handlers.ListStockAlerts(db))
+
+		// Inventory valuation and cost of goods sold
+		protected.GET("/valuation", handlers.GetValuation(db))
+		protected.GET("/valuation/cogs", handlers.ListCOGS(db))
+
+		// Shelf-to-shelf transfers
+		protected.POST("/transfers", handlers.TransferItems(db))
+
+		// Stock movement ledger
+		protected.GET("/movements", handlers.ListMovements(db))
+
+		// Stock reservations
+		reservations := protected.Group("/reservations")
+		{
+			reservations.GET("", handlers.ListReservations(db))
+			reservations.GET("/:id", handlers.GetReservation(db))
+			reservations.POST("", handlers.CreateReservation(db))
+			reservations.POST("/:id/confirm", handlers.ConfirmReservation(db))
+			reservations.POST("/:id/release", handlers.ReleaseReservation(db))
+		}
+
+		// Outbound orders and pick lists
+		orders := protected.Group("/orders")
+		{
+			orders.GET("", handlers.ListOrders(db))
+			orders.GET("/:id", handlers.GetOrder(db))
+			orders.POST("", handlers.CreateOrder(db))
+			orders.POST("/:id/picklist", handlers.CreatePicklist(db))
+			orders.POST("/:id/picklist/confirm", handlers.ConfirmPicks(db))
+			orders.POST("/:id/cancel", handlers.CancelOrder(db))
+		}
+
+		// Inbound receiving
+		inbound := protected.Group("/inbound")
+		{
+			inbound.GET("", handlers.ListInboundDocuments(db))
+			inbound.GET("/:id", handlers.GetInboundDocument(db))
+			inbound.POST("", handlers.CreateInboundDocument(db))
+			inbound.POST("/:id/receive", handlers.ReceiveInbound(db))
+			inbound.POST("/:id/close", handlers.CloseInbound(db))
+		}
+
+		// Staging area awaiting putaway
+		staging := protected.Group("/staging")
+		{
+			staging.GET("", handlers.ListStagedItems(db))
+			staging.POST("/:id/putaway", handlers.PutawayStagedItem(db))
+		}
+
+		// Putaway suggestions
+		protected.POST("/putaway/suggest", handlers.SuggestPutaway(db))
+		protected.POST("/putaway/apply", handlers.ApplyPutaway(db))
+
+		// Cycle counts
+		counts := protected.Group("/counts")
+		{
+			counts.GET("", handlers.ListCountSessions(db))
+			counts.GET("/:id", handlers.GetCountSession(db))
+			counts.POST("", handlers.CreateCountSession(db))
+			counts.POST("/:id/counts", handlers.SubmitCounts(db))
+			counts.POST("/:id/approve", handlers.ApproveCount(db))
+			counts.POST("/:id/cancel", handlers.CancelCount(db))
+		}
+
+		// Pick path optimization
+		protected.POST("/routing/optimize", handlers.OptimizeRoute(db))
+
 		// Health check
 		protected.GET("/health", func(c *gin.Context) {
 			c.JSON(200, gin.H{"status": "ok"})
@@ -126,3 +252,32 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// newStorage sets up the media storage driver chosen by STORAGE_DRIVER:
+// "local" (the default) keeps files under MEDIA_DIR and serves them from
+// /media, "s3" keeps them in an S3-compatible bucket.
+func newStorage() (storage.Storage, error) {
+	switch driver := os.Getenv("STORAGE_DRIVER"); driver {
+	case "", "local":
+		dir := os.Getenv("MEDIA_DIR")
+		if dir == "" {
+			dir = "./media"
+		}
+		baseURL := os.Getenv("MEDIA_BASE_URL")
+		if baseURL == "" {
+			baseURL = "/media"
+		}
+		return storage.NewLocal(dir, baseURL)
+	case "s3":
+		return storage.NewS3(
+			os.Getenv("S3_ENDPOINT"),
+			os.Getenv("S3_BUCKET"),
+			os.Getenv("S3_REGION"),
+			os.Getenv("S3_ACCESS_KEY"),
+			os.Getenv("S3_SECRET_KEY"),
+			os.Getenv("S3_PUBLIC_URL"),
+		)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", driver)
+	}
+}
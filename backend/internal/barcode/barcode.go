@@ -0,0 +1,107 @@
+package barcode
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Symbology is the kind of barcode a code is printed as.
+type Symbology string
+
+const (
+	EAN13   Symbology = "ean13"
+	UPCA    Symbology = "upc_a"
+	GTIN14  Symbology = "gtin14"
+	Code128 Symbology = "code128"
+)
+
+// lengths holds the digit count of each GTIN symbology.
+var lengths = map[Symbology]int{
+	EAN13:  13,
+	UPCA:   12,
+	GTIN14: 14,
+}
+
+// maxCode128Length keeps Code128 values printable on a shelf or product
+// label.
+const maxCode128Length = 80
+
+// Validate checks code against the rules of its symbology: digit count and
+// check digit for GTINs, printable ASCII for Code128.
+func Validate(symbology Symbology, code string) error {
+	if symbology == Code128 {
+		if code == "" || len(code) > maxCode128Length {
+			return fmt.Errorf("code128 value must be 1 to %d characters", maxCode128Length)
+		}
+		for _, r := range code {
+			if r < ' ' || r > '~' {
+				return errors.New("code128 value must be printable ASCII")
+			}
+		}
+		return nil
+	}
+
+	length, ok := lengths[symbology]
+	if !ok {
+		return fmt.Errorf("unknown barcode type %q", symbology)
+	}
+	if len(code) != length || !isDigits(code) {
+		return fmt.Errorf("%s must be %d digits", symbology, length)
+	}
+
+	want := CheckDigit(code[:length-1])
+	if code[length-1] != want {
+		return fmt.Errorf("invalid %s check digit: expected %c", symbology, want)
+	}
+
+	return nil
+}
+
+// CheckDigit computes the GS1 mod-10 check digit for the digits of a GTIN
+// without its check digit. Weights alternate 3 and 1 from the rightmost
+// digit, so the same function serves every GTIN length.
+func CheckDigit(digits string) byte {
+	sum := 0
+	for i := 0; i < len(digits); i++ {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 0 {
+			d *= 3
+		}
+		sum += d
+	}
+
+	return byte('0' + (10-sum%10)%10)
+}
+
+// GTIN returns code as a 14-digit GTIN when it is one, so the same item
+// printed as UPC-A, EAN-13 or GTIN-14 resolves to one value. ok is false
+// for anything that is not a valid GTIN.
+func GTIN(code string) (gtin string, ok bool) {
+	if !isDigits(code) {
+		return "", false
+	}
+
+	for symbology, length := range lengths {
+		if len(code) == length {
+			if Validate(symbology, code) != nil {
+				return "", false
+			}
+			return strings.Repeat("0", 14-length) + code, true
+		}
+	}
+
+	return "", false
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
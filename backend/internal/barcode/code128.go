@@ -0,0 +1,64 @@
+package barcode
+
+// code128Patterns holds the bar and space widths, in modules, of every
+// Code128 symbol value. Each symbol is three bars and three spaces eleven
+// modules wide; the stop symbol adds a final two-module bar.
+var code128Patterns = [...]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+const (
+	code128StartB = 104
+	code128StartC = 105
+	code128Stop   = 106
+)
+
+// EncodeCode128 returns the modules of value as a Code128 symbol, true for
+// bars, without quiet zones. Values made only of an even number of digits
+// use code set C, which packs two digits per symbol; everything else uses
+// code set B.
+func EncodeCode128(value string) ([]bool, error) {
+	if err := Validate(Code128, value); err != nil {
+		return nil, err
+	}
+
+	var symbols []int
+	if len(value) >= 4 && len(value)%2 == 0 && isDigits(value) {
+		symbols = append(symbols, code128StartC)
+		for i := 0; i < len(value); i += 2 {
+			symbols = append(symbols, int(value[i]-'0')*10+int(value[i+1]-'0'))
+		}
+	} else {
+		symbols = append(symbols, code128StartB)
+		for i := 0; i < len(value); i++ {
+			symbols = append(symbols, int(value[i])-' ')
+		}
+	}
+
+	checksum := symbols[0]
+	for i, symbol := range symbols[1:] {
+		checksum += (i + 1) * symbol
+	}
+	symbols = append(symbols, checksum%103, code128Stop)
+
+	var modules []bool
+	for _, symbol := range symbols {
+		for i, width := range code128Patterns[symbol] {
+			for n := 0; n < int(width-'0'); n++ {
+				modules = append(modules, i%2 == 0)
+			}
+		}
+	}
+
+	return modules, nil
+}
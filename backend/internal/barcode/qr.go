@@ -0,0 +1,482 @@
+package barcode
+
+import (
+	"fmt"
+)
+
+// qrVersion describes the error correction layout of one QR version at
+// level M: the EC codewords per block and the data codewords of the blocks
+// in each of the two block groups.
+type qrVersion struct {
+	ecPerBlock  int
+	group1      int
+	group1Data  int
+	group2      int
+	group2Data  int
+	alignCenter []int
+}
+
+// qrVersions covers versions 1 to 10 at error correction level M, enough
+// for up to 213 bytes, which is far more than any label carries.
+var qrVersions = [...]qrVersion{
+	1:  {10, 1, 16, 0, 0, nil},
+	2:  {16, 1, 28, 0, 0, []int{6, 18}},
+	3:  {26, 1, 44, 0, 0, []int{6, 22}},
+	4:  {18, 2, 32, 0, 0, []int{6, 26}},
+	5:  {24, 2, 43, 0, 0, []int{6, 30}},
+	6:  {16, 4, 27, 0, 0, []int{6, 34}},
+	7:  {18, 4, 31, 0, 0, []int{6, 22, 38}},
+	8:  {22, 2, 38, 2, 39, []int{6, 24, 42}},
+	9:  {22, 3, 36, 2, 37, []int{6, 26, 46}},
+	10: {26, 4, 43, 1, 44, []int{6, 28, 50}},
+}
+
+func (v qrVersion) dataCodewords() int {
+	return v.group1*v.group1Data + v.group2*v.group2Data
+}
+
+// EncodeQR returns data as a QR code in byte mode at error correction level
+// M, as rows of modules with true for dark, without the quiet zone. The
+// smallest version that fits is used, with the mask scoring lowest on the
+// standard penalty rules.
+func EncodeQR(data string) ([][]bool, error) {
+	version := 0
+	for v := 1; v < len(qrVersions); v++ {
+		// Mode and length header: 4 bits, then 8 bits of length up to
+		// version 9 and 16 from version 10
+		header := 12
+		if v >= 10 {
+			header = 20
+		}
+		if header+8*len(data) <= 8*qrVersions[v].dataCodewords() {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("qr data too long: %d bytes", len(data))
+	}
+
+	q := newQRMatrix(version)
+	q.drawFunctionPatterns()
+	q.drawCodewords(q.addErrorCorrection(q.dataCodewords(data)))
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormatBits(mask)
+		if penalty := q.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		// Masks are their own inverse
+		q.applyMask(mask)
+	}
+	q.applyMask(best)
+	q.drawFormatBits(best)
+
+	return q.modules, nil
+}
+
+type qrMatrix struct {
+	version    int
+	size       int
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+func newQRMatrix(version int) *qrMatrix {
+	size := version*4 + 17
+	q := &qrMatrix{version: version, size: size}
+	q.modules = make([][]bool, size)
+	q.isFunction = make([][]bool, size)
+	for i := range q.modules {
+		q.modules[i] = make([]bool, size)
+		q.isFunction[i] = make([]bool, size)
+	}
+	return q
+}
+
+func (q *qrMatrix) setFunction(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.isFunction[y][x] = true
+}
+
+func (q *qrMatrix) drawFunctionPatterns() {
+	for i := 0; i < q.size; i++ {
+		q.setFunction(6, i, i%2 == 0)
+		q.setFunction(i, 6, i%2 == 0)
+	}
+
+	q.drawFinder(3, 3)
+	q.drawFinder(q.size-4, 3)
+	q.drawFinder(3, q.size-4)
+
+	centers := qrVersions[q.version].alignCenter
+	last := len(centers) - 1
+	for i, y := range centers {
+		for j, x := range centers {
+			// Skip the three corners taken by finder patterns
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			q.drawAlignment(x, y)
+		}
+	}
+
+	// Reserve the format areas, then draw the real bits once a mask is
+	// chosen
+	q.drawFormatBits(0)
+	q.drawVersionBits()
+}
+
+func (q *qrMatrix) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || x >= q.size || y < 0 || y >= q.size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			q.setFunction(x, y, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (q *qrMatrix) drawAlignment(cx, cy int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			q.setFunction(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// drawFormatBits writes both copies of the format information for level M
+// and the given mask.
+func (q *qrMatrix) drawFormatBits(mask int) {
+	// Level M is encoded as 00
+	data := mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 != 0 }
+
+	for i := 0; i <= 5; i++ {
+		q.setFunction(8, i, bit(i))
+	}
+	q.setFunction(8, 7, bit(6))
+	q.setFunction(8, 8, bit(7))
+	q.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		q.setFunction(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.setFunction(8, q.size-15+i, bit(i))
+	}
+	q.setFunction(8, q.size-8, true)
+}
+
+// drawVersionBits writes the version information blocks that versions 7
+// and up carry next to two of the finder patterns.
+func (q *qrMatrix) drawVersionBits() {
+	if q.version < 7 {
+		return
+	}
+
+	rem := q.version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := q.version<<12 | rem
+
+	for i := 0; i < 18; i++ {
+		dark := (bits>>i)&1 != 0
+		a, b := q.size-11+i%3, i/3
+		q.setFunction(a, b, dark)
+		q.setFunction(b, a, dark)
+	}
+}
+
+// dataCodewords encodes data in byte mode and pads it to the version's
+// data capacity.
+func (q *qrMatrix) dataCodewords(data string) []byte {
+	capacity := qrVersions[q.version].dataCodewords() * 8
+
+	var bits []bool
+	appendBits := func(value, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, (value>>i)&1 != 0)
+		}
+	}
+
+	appendBits(0x4, 4)
+	if q.version >= 10 {
+		appendBits(len(data), 16)
+	} else {
+		appendBits(len(data), 8)
+	}
+	for i := 0; i < len(data); i++ {
+		appendBits(int(data[i]), 8)
+	}
+
+	appendBits(0, min(4, capacity-len(bits)))
+	appendBits(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		appendBits(pad, 8)
+	}
+
+	codewords := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			codewords[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return codewords
+}
+
+// addErrorCorrection splits data into the version's blocks, computes each
+// block's Reed-Solomon codewords and interleaves the result.
+func (q *qrMatrix) addErrorCorrection(data []byte) []byte {
+	v := qrVersions[q.version]
+	divisor := rsDivisor(v.ecPerBlock)
+
+	var blocks, ecBlocks [][]byte
+	offset := 0
+	for i := 0; i < v.group1+v.group2; i++ {
+		n := v.group1Data
+		if i >= v.group1 {
+			n = v.group2Data
+		}
+		block := data[offset : offset+n]
+		offset += n
+
+		blocks = append(blocks, block)
+		ecBlocks = append(ecBlocks, rsRemainder(block, divisor))
+	}
+
+	var result []byte
+	for i := 0; i < max(v.group1Data, v.group2Data); i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < v.ecPerBlock; i++ {
+		for _, ec := range ecBlocks {
+			result = append(result, ec[i])
+		}
+	}
+	return result
+}
+
+// drawCodewords places the codewords in the zigzag order, two columns at a
+// time from the bottom right, skipping function modules.
+func (q *qrMatrix) drawCodewords(codewords []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < q.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = q.size - 1 - vert
+				}
+				if !q.isFunction[y][x] && i < len(codewords)*8 {
+					q.modules[y][x] = (codewords[i>>3]>>(7-i&7))&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (q *qrMatrix) applyMask(mask int) {
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !q.isFunction[y][x] {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the matrix on the four QR mask evaluation rules; lower is
+// easier to scan.
+func (q *qrMatrix) penalty() int {
+	penalty := 0
+	at := func(x, y int, transpose bool) bool {
+		if transpose {
+			return q.modules[x][y]
+		}
+		return q.modules[y][x]
+	}
+
+	for _, transpose := range []bool{false, true} {
+		for y := 0; y < q.size; y++ {
+			// Runs of five or more modules of one colour, and finder-like
+			// patterns found from the lengths of the runs
+			history := runHistory{size: q.size}
+			dark, run := false, 0
+			for x := 0; x < q.size; x++ {
+				if at(x, y, transpose) == dark {
+					run++
+					if run == 5 {
+						penalty += 3
+					} else if run > 5 {
+						penalty++
+					}
+					continue
+				}
+				history.push(run)
+				if !dark {
+					penalty += history.finderPatterns() * 40
+				}
+				dark, run = !dark, 1
+			}
+			if dark {
+				history.push(run)
+				run = 0
+			}
+			// The quiet zone extends the final light run
+			history.push(run + q.size)
+			penalty += history.finderPatterns() * 40
+		}
+	}
+
+	// 2x2 blocks of one colour
+	dark := 0
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if q.modules[y][x] {
+				dark++
+			}
+			if x+1 < q.size && y+1 < q.size {
+				c := q.modules[y][x]
+				if c == q.modules[y][x+1] && c == q.modules[y+1][x] && c == q.modules[y+1][x+1] {
+					penalty += 3
+				}
+			}
+		}
+	}
+
+	// Balance of dark and light modules
+	total := q.size * q.size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	penalty += max(k, 0) * 10
+
+	return penalty
+}
+
+// runHistory holds the lengths of the last seven runs along a line, newest
+// first, alternating between light and dark. The quiet zone counts as part
+// of the first and last light runs.
+type runHistory struct {
+	size int
+	runs [7]int
+}
+
+func (h *runHistory) push(run int) {
+	if h.runs[0] == 0 {
+		run += h.size
+	}
+	copy(h.runs[1:], h.runs[:6])
+	h.runs[0] = run
+}
+
+// finderPatterns counts the dark:light:dark:light:dark runs in the ratio
+// 1:1:3:1:1 that ended with the newest light run, once for each side that
+// has a light run at least four modules wide.
+func (h *runHistory) finderPatterns() int {
+	r := h.runs
+	n := r[1]
+	if n == 0 || r[2] != n || r[3] != 3*n || r[4] != n || r[5] != n {
+		return 0
+	}
+
+	count := 0
+	if r[0] >= 4*n && r[6] >= n {
+		count++
+	}
+	if r[6] >= 4*n && r[0] >= n {
+		count++
+	}
+	return count
+}
+
+// rsDivisor returns the Reed-Solomon generator polynomial of the given
+// degree, highest coefficient first with the leading 1 dropped.
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coefficient := range divisor {
+			result[i] ^= gfMultiply(coefficient, factor)
+		}
+	}
+	return result
+}
+
+// gfMultiply multiplies in GF(2^8) modulo the QR polynomial
+// x^8 + x^4 + x^3 + x^2 + 1.
+func gfMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,223 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aslam/backend/internal/models"
+	"github.com/lib/pq"
+)
+
+// attributeName keeps attribute names usable as filter keys.
+var attributeName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// ListAttributes returns the attributes that apply to products in the
+// category: its own and those inherited from its ancestors.
+func (d *DB) ListAttributes(ctx context.Context, categoryID string) ([]models.AttributeDefinition, error) {
+	if err := checkCategory(ctx, d.conn, categoryID); err != nil {
+		return nil, err
+	}
+
+	return categoryAttributes(ctx, d.conn, categoryID)
+}
+
+// categoryAttributes resolves the attribute schema of a category, walking
+// up to the root; the definition closest to the category wins.
+func categoryAttributes(ctx context.Context, q querier, categoryID string) ([]models.AttributeDefinition, error) {
+	if categoryID == "" {
+		return []models.AttributeDefinition{}, nil
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		WITH RECURSIVE chain AS (
+			SELECT id, parent_id, 0 AS depth FROM categories WHERE id = $1
+			UNION ALL
+			SELECT c.id, c.parent_id, ch.depth + 1 FROM categories c JOIN chain ch ON c.id = ch.parent_id
+		)
+		SELECT DISTINCT ON (a.name) a.category_id, a.name, a.type, a.required, a.enum_values, a.unit
+		FROM category_attributes a
+		JOIN chain ch ON ch.id = a.category_id
+		ORDER BY a.name, ch.depth
+	`, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attributes := []models.AttributeDefinition{}
+	for rows.Next() {
+		var a models.AttributeDefinition
+		if err := rows.Scan(&a.CategoryID, &a.Name, &a.Type, &a.Required, pq.Array(&a.Enum), &a.Unit); err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, a)
+	}
+
+	return attributes, rows.Err()
+}
+
+// SetAttributes replaces the attributes the category defines itself.
+func (d *DB) SetAttributes(ctx context.Context, categoryID string, req *models.SetAttributesRequest) ([]models.AttributeDefinition, error) {
+	if err := validateAttributeDefinitions(req.Attributes); err != nil {
+		return nil, err
+	}
+
+	var attributes []models.AttributeDefinition
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		var id string
+		err := tx.QueryRowContext(ctx, `SELECT id FROM categories WHERE id = $1 FOR UPDATE`, categoryID).Scan(&id)
+		if err == sql.ErrNoRows {
+			return errors.New("category not found")
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM category_attributes WHERE category_id = $1`, categoryID); err != nil {
+			return err
+		}
+
+		for _, a := range req.Attributes {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO category_attributes (category_id, name, type, required, enum_values, unit)
+				VALUES ($1, $2, $3, $4, $5, $6)
+			`, categoryID, a.Name, string(a.Type), a.Required, pq.Array(a.Enum), a.Unit)
+			if err != nil {
+				return err
+			}
+		}
+
+		attributes, err = categoryAttributes(ctx, tx, categoryID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return attributes, nil
+}
+
+func validateAttributeDefinitions(definitions []models.AttributeDefinitionRequest) error {
+	seen := make(map[string]bool, len(definitions))
+	for _, a := range definitions {
+		if !attributeName.MatchString(a.Name) {
+			return fmt.Errorf("attribute name %q must be lower case letters, digits and underscores", a.Name)
+		}
+		if seen[a.Name] {
+			return fmt.Errorf("attribute %q is defined more than once", a.Name)
+		}
+		seen[a.Name] = true
+
+		switch a.Type {
+		case models.AttributeEnum:
+			if len(a.Enum) == 0 {
+				return fmt.Errorf("enum attribute %q needs a list of values", a.Name)
+			}
+		case models.AttributeList:
+		default:
+			if len(a.Enum) > 0 {
+				return fmt.Errorf("attribute %q of type %s cannot have enum values", a.Name, a.Type)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateAttributes checks product attribute values against the schema of
+// the category: every value must be declared and of its declared type, and
+// every required attribute must be present.
+func validateAttributes(ctx context.Context, q querier, categoryID string, values map[string]interface{}) error {
+	schema, err := categoryAttributes(ctx, q, categoryID)
+	if err != nil {
+		return err
+	}
+
+	declared := make(map[string]models.AttributeDefinition, len(schema))
+	for _, a := range schema {
+		declared[a.Name] = a
+		if _, ok := values[a.Name]; a.Required && !ok {
+			return fmt.Errorf("attribute %q is required", a.Name)
+		}
+	}
+
+	// Sorted so the first error reported does not depend on map order
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		a, ok := declared[name]
+		if !ok {
+			return fmt.Errorf("attribute %q is not defined for the product's category", name)
+		}
+		if err := checkAttributeValue(a, values[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func checkAttributeValue(a models.AttributeDefinition, value interface{}) error {
+	mismatch := fmt.Errorf("attribute %q must be of type %s", a.Name, a.Type)
+	inEnum := func(s string) bool {
+		for _, allowed := range a.Enum {
+			if s == allowed {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch a.Type {
+	case models.AttributeString:
+		if _, ok := value.(string); !ok {
+			return mismatch
+		}
+	case models.AttributeNumber:
+		if _, ok := value.(float64); !ok {
+			return mismatch
+		}
+	case models.AttributeInteger:
+		if n, ok := value.(float64); !ok || n != math.Trunc(n) {
+			return mismatch
+		}
+	case models.AttributeBoolean:
+		if _, ok := value.(bool); !ok {
+			return mismatch
+		}
+	case models.AttributeEnum:
+		s, ok := value.(string)
+		if !ok {
+			return mismatch
+		}
+		if !inEnum(s) {
+			return fmt.Errorf("attribute %q must be one of %s", a.Name, strings.Join(a.Enum, ", "))
+		}
+	case models.AttributeList:
+		items, ok := value.([]interface{})
+		if !ok {
+			return mismatch
+		}
+		for _, item := range items {
+			s, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("attribute %q must be a list of strings", a.Name)
+			}
+			if len(a.Enum) > 0 && !inEnum(s) {
+				return fmt.Errorf("attribute %q values must be among %s", a.Name, strings.Join(a.Enum, ", "))
+			}
+		}
+	}
+
+	return nil
+}
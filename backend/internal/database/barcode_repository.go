@@ -0,0 +1,189 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aslam/backend/internal/barcode"
+	"github.com/aslam/backend/internal/listquery"
+	"github.com/aslam/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+// barcodeMatch matches product_barcodes rows for the code given as $1 and
+// its GTIN form as $2: the code itself, or any code of the same GTIN.
+const barcodeMatch = `(code = $1 OR gtin = $2)`
+
+// BarcodeList is what barcode lists can be sorted and filtered by.
+var BarcodeList = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"code":       {Column: "code", Type: listquery.String},
+		"type":       {Column: "type", Type: listquery.String},
+		"created_at": {Column: "created_at", Type: listquery.Time},
+	},
+	Sort: []listquery.Sort{{Field: "created_at"}},
+	Key:  "code",
+}
+
+func (d *DB) ListBarcodes(ctx context.Context, sku string, lq *listquery.Query) ([]models.ProductBarcode, *listquery.Page, error) {
+	if _, err := getProductFields(ctx, d.conn, sku); err != nil {
+		return nil, nil, err
+	}
+
+	if lq == nil {
+		lq = listquery.All(BarcodeList)
+	}
+
+	barcodes := []models.ProductBarcode{}
+	page, err := queryPage(ctx, d.conn, lq, "code, sku, type, created_at", "product_barcodes", []string{"sku = $1"}, []interface{}{sku}, func(row rowScanner) error {
+		var b models.ProductBarcode
+		if err := row.Scan(&b.Code, &b.SKU, &b.Type, &b.CreatedAt); err != nil {
+			return err
+		}
+		barcodes = append(barcodes, b)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return barcodes, page, nil
+}
+
+// AddBarcode assigns a validated barcode to the product. GTINs are also
+// stored in their 14-digit form, so a UPC-A and the EAN-13 it equals cannot
+// be given to two different products. That includes Code128 values made of
+// the digits of a GTIN, which scan the same.
+func (d *DB) AddBarcode(ctx context.Context, sku string, req *models.AddBarcodeRequest) (*models.ProductBarcode, error) {
+	code := strings.TrimSpace(req.Code)
+	if err := barcode.Validate(barcode.Symbology(req.Type), code); err != nil {
+		return nil, err
+	}
+
+	var gtin sql.NullString
+	gtin.String, gtin.Valid = barcode.GTIN(code)
+
+	b := &models.ProductBarcode{}
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := lockProduct(ctx, tx, sku, true); err != nil {
+			return err
+		}
+
+		var owner string
+		err := tx.QueryRowContext(ctx, `SELECT sku FROM product_barcodes WHERE `+barcodeMatch+` LIMIT 1`, code, gtin).Scan(&owner)
+		if err == nil {
+			return fmt.Errorf("barcode is already assigned to product %s", owner)
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+
+		return tx.QueryRowContext(ctx, `
+			INSERT INTO product_barcodes (code, sku, type, gtin)
+			VALUES ($1, $2, $3, $4)
+			RETURNING code, sku, type, created_at
+		`, code, sku, string(req.Type), gtin).Scan(&b.Code, &b.SKU, &b.Type, &b.CreatedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (d *DB) DeleteBarcode(ctx context.Context, sku, code string) error {
+	result, err := d.conn.ExecContext(ctx, `DELETE FROM product_barcodes WHERE sku = $1 AND code = $2`, sku, code)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return errors.New("barcode not found")
+	}
+
+	return nil
+}
+
+// Scan resolves a scanned code to what it identifies: a shelf label, a
+// product barcode, a SKU printed as is, or a serial number, tried in that
+// order.
+func (d *DB) Scan(ctx context.Context, code string) (*models.ScanResult, error) {
+	code = strings.TrimSpace(code)
+	result := &models.ScanResult{Code: code}
+
+	if id, ok := strings.CutPrefix(code, models.ShelfLabelPrefix); ok {
+		if _, err := uuid.Parse(id); err != nil {
+			return nil, errors.New("shelf not found")
+		}
+		shelf, err := getShelf(ctx, d.conn, id)
+		if err != nil {
+			return nil, err
+		}
+		result.Kind = models.ScanShelf
+		result.Shelf = shelf
+		return result, nil
+	}
+
+	var gtin sql.NullString
+	gtin.String, gtin.Valid = barcode.GTIN(code)
+
+	b := &models.ProductBarcode{}
+	err := d.conn.QueryRowContext(ctx, `
+		SELECT code, sku, type, created_at
+		FROM product_barcodes
+		WHERE `+barcodeMatch+`
+		ORDER BY code = $1 DESC, created_at ASC
+		LIMIT 1
+	`, code, gtin).Scan(&b.Code, &b.SKU, &b.Type, &b.CreatedAt)
+	switch {
+	case err == nil:
+		result.Barcode = b
+		return d.scanProduct(ctx, result, b.SKU)
+	case err != sql.ErrNoRows:
+		return nil, err
+	}
+
+	var exists bool
+	err = d.conn.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM products WHERE sku = $1)`, code).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return d.scanProduct(ctx, result, code)
+	}
+
+	err = d.conn.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM serial_numbers WHERE serial_number = $1)`, code).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		serial, err := d.GetSerial(ctx, code)
+		if err != nil {
+			return nil, err
+		}
+		result.Kind = models.ScanSerial
+		result.Serial = serial
+		return result, nil
+	}
+
+	return nil, errors.New("code not recognised")
+}
+
+func (d *DB) scanProduct(ctx context.Context, result *models.ScanResult, sku string) (*models.ScanResult, error) {
+	product, err := getProductBySKU(ctx, d.conn, sku)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Kind = models.ScanProduct
+	result.Product = product
+	return result, nil
+}
@@ -0,0 +1,196 @@
+package database
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aslam/backend/internal/models"
+	"github.com/aslam/backend/internal/packing"
+)
+
+// maxPackedUnits bounds the dimensional check; shelves that would hold more
+// units than this fall back to the volume check.
+const maxPackedUnits = 2000
+
+// CapacityError is returned when a mutation would overflow one or more
+// shelves. It lists every offending shelf so callers can report them all.
+type CapacityError struct {
+	Shelves []models.CapacityViolation
+}
+
+var capacityMessages = []struct {
+	limit   string
+	message string
+}{
+	{"volume", "insufficient shelf volume"},
+	{"dimensions", "item does not fit shelf dimensions"},
+	{"weight", "shelf weight limit exceeded"},
+}
+
+func (e *CapacityError) Error() string {
+	exceeded := make(map[string]bool)
+	for _, shelf := range e.Shelves {
+		for _, limit := range shelf.Exceeds {
+			exceeded[limit] = true
+		}
+	}
+
+	var problems []string
+	for _, m := range capacityMessages {
+		if exceeded[m.limit] {
+			problems = append(problems, m.message)
+		}
+	}
+	return strings.Join(problems, "; ")
+}
+
+// shelfLoad is a shelf's current state alongside the limits and usage it
+// would have once a pending mutation is applied.
+type shelfLoad struct {
+	shelf     *models.ShelfResponse
+	maxVolume float64
+	volume    float64
+	maxWeight float64
+	weight    float64
+
+	// check says whether the shelf is judged by dimensional fit or by
+	// volume; fits carries the packing result for the former.
+	check models.CapacityCheck
+	fits  bool
+}
+
+func newShelfLoad(shelf *models.ShelfResponse) shelfLoad {
+	return shelfLoad{
+		shelf:     shelf,
+		maxVolume: shelf.MaxVolume,
+		volume:    shelf.UsedVolume,
+		maxWeight: shelf.MaxWeight,
+		weight:    shelf.UsedWeight,
+		check:     models.CapacityCheckVolume,
+		fits:      true,
+	}
+}
+
+// exceeds lists the limits the pending mutation would break.
+func (l shelfLoad) exceeds() []string {
+	var limits []string
+	if l.check == models.CapacityCheckDimensional {
+		if !l.fits {
+			limits = append(limits, "dimensions")
+		}
+	} else if overflowGrows(l.maxVolume, l.volume, l.shelf.MaxVolume, l.shelf.UsedVolume) {
+		limits = append(limits, "volume")
+	}
+	if overflowGrows(l.maxWeight, l.weight, l.shelf.MaxWeight, l.shelf.UsedWeight) {
+		limits = append(limits, "weight")
+	}
+	return limits
+}
+
+// overflowGrows reports whether usage ends up over its limit by more than it
+// already was, so reductions on an already overfilled shelf are never
+// rejected. A limit of zero means unlimited.
+func overflowGrows(limit, used, limitBefore, usedBefore float64) bool {
+	if limit <= 0 || used <= limit {
+		return false
+	}
+	if limitBefore <= 0 {
+		return true
+	}
+	return used-limit > usedBefore-limitBefore
+}
+
+// validateCapacity is the single capacity rule shared by every mutation path.
+// Unless force is set it rejects the change with a *CapacityError; when forced
+// the change goes through and the shelves report themselves as over capacity.
+func validateCapacity(loads []shelfLoad, force bool) error {
+	var violations []models.CapacityViolation
+	for _, load := range loads {
+		limits := load.exceeds()
+		if len(limits) == 0 {
+			continue
+		}
+
+		violations = append(violations, models.CapacityViolation{
+			ShelfID:    load.shelf.ID,
+			ShelfName:  load.shelf.Name,
+			Exceeds:    limits,
+			MaxVolume:  load.maxVolume,
+			UsedVolume: load.volume,
+			MaxWeight:  load.maxWeight,
+			UsedWeight: load.weight,
+		})
+	}
+
+	if len(violations) == 0 || force {
+		return nil
+	}
+
+	return &CapacityError{Shelves: violations}
+}
+
+// checkFit runs the dimensional check for adding quantity units of product to
+// the shelf, when the shelf and every product on it have known dimensions.
+// Otherwise the load is left on the volume check.
+func checkFit(ctx context.Context, q querier, load *shelfLoad, product *models.Product, quantity int) error {
+	shelf := load.shelf
+	container := packing.Box{Length: shelf.Length, Width: shelf.Width, Height: shelf.Height}
+	unit := packing.Box{Length: product.Length, Width: product.Width, Height: product.Height}
+	if !hasDimensions(container) || !hasDimensions(unit) {
+		return nil
+	}
+
+	query := `
+		SELECT p.length, p.width, p.height, si.quantity
+		FROM shelf_items si
+		JOIN products p ON si.sku = p.sku
+		WHERE si.shelf_id = $1
+	`
+
+	rows, err := q.QueryContext(ctx, query, shelf.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type stored struct {
+		box      packing.Box
+		quantity int
+	}
+	contents := []stored{{unit, quantity}}
+	units := quantity
+
+	for rows.Next() {
+		var s stored
+		if err := rows.Scan(&s.box.Length, &s.box.Width, &s.box.Height, &s.quantity); err != nil {
+			return err
+		}
+		if !hasDimensions(s.box) {
+			return rows.Err()
+		}
+		contents = append(contents, s)
+		units += s.quantity
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if units > maxPackedUnits {
+		return nil
+	}
+
+	boxes := make([]packing.Box, 0, units)
+	for _, s := range contents {
+		for i := 0; i < s.quantity; i++ {
+			boxes = append(boxes, s.box)
+		}
+	}
+
+	load.check = models.CapacityCheckDimensional
+	load.fits = packing.Fits(container, boxes)
+	return nil
+}
+
+func hasDimensions(b packing.Box) bool {
+	return b.Length > 0 && b.Width > 0 && b.Height > 0
+}
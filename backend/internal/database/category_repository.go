@@ -0,0 +1,260 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aslam/backend/internal/models"
+)
+
+// categorySubtree selects the ID of the category given as query parameter
+// n and the IDs of all of its descendants.
+func categorySubtree(n int) string {
+	return fmt.Sprintf(`
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM categories WHERE id = $%d
+			UNION ALL
+			SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+		)
+		SELECT id FROM subtree`, n)
+}
+
+// categoryError reports a clash with a sibling's name plainly.
+func categoryError(err error) error {
+	if err != nil && strings.Contains(err.Error(), "uq_categories_sibling_name") {
+		return errors.New("a category with this name already exists under the same parent")
+	}
+	return err
+}
+
+// checkCategory verifies that the category exists; an empty ID is no
+// category and always passes.
+func checkCategory(ctx context.Context, q querier, id string) error {
+	if id == "" {
+		return nil
+	}
+
+	var exists bool
+	if err := q.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM categories WHERE id = $1)`, id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New("category not found")
+	}
+	return nil
+}
+
+// lockCategoryTree serializes changes to the shape of the tree, so two
+// concurrent moves cannot each pass the cycle check and form a loop
+// between them. Product assignments and reads are not blocked.
+func lockCategoryTree(ctx context.Context, q querier) error {
+	_, err := q.ExecContext(ctx, `LOCK TABLE categories IN SHARE ROW EXCLUSIVE MODE`)
+	return err
+}
+
+func (d *DB) CreateCategory(ctx context.Context, req *models.CreateCategoryRequest) (*models.Category, error) {
+	var id string
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		if err := lockCategoryTree(ctx, tx); err != nil {
+			return err
+		}
+		if err := checkCategory(ctx, tx, req.ParentID); err != nil {
+			return errors.New("parent category not found")
+		}
+
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO categories (name, parent_id)
+			VALUES ($1, NULLIF($2, '')::uuid)
+			RETURNING id
+		`, req.Name, req.ParentID).Scan(&id)
+		return categoryError(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d.GetCategory(ctx, id)
+}
+
+// GetCategory returns the category with its subtree and stock totals.
+func (d *DB) GetCategory(ctx context.Context, id string) (*models.Category, error) {
+	tree, err := d.ListCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if category := findCategory(tree, id); category != nil {
+		return category, nil
+	}
+	return nil, errors.New("category not found")
+}
+
+func findCategory(categories []models.Category, id string) *models.Category {
+	for i := range categories {
+		if categories[i].ID == id {
+			return &categories[i]
+		}
+		if found := findCategory(categories[i].Children, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// ListCategories returns the whole category tree, siblings sorted by name,
+// with each category's product count and on-hand stock rolled up from its
+// descendants.
+func (d *DB) ListCategories(ctx context.Context) ([]models.Category, error) {
+	query := `
+		SELECT c.id, c.name, c.parent_id, c.created_at, c.updated_at,
+			(SELECT COUNT(*) FROM products p WHERE p.category_id = c.id),
+			COALESCE((
+				SELECT SUM(si.quantity)
+				FROM shelf_items si
+				JOIN products p ON p.sku = si.sku
+				WHERE p.category_id = c.id
+			), 0)
+		FROM categories c
+		ORDER BY c.name ASC
+	`
+
+	rows, err := d.conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	children := make(map[string][]models.Category)
+	for rows.Next() {
+		var category models.Category
+		var parentID sql.NullString
+		if err := rows.Scan(&category.ID, &category.Name, &parentID, &category.CreatedAt, &category.UpdatedAt,
+			&category.ProductCount, &category.OnHand); err != nil {
+			return nil, err
+		}
+		if parentID.Valid {
+			category.ParentID = &parentID.String
+		}
+		children[parentID.String] = append(children[parentID.String], category)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return buildCategoryTree(children, ""), nil
+}
+
+// buildCategoryTree assembles the categories under parentID, adding each
+// subtree's totals to its root.
+func buildCategoryTree(children map[string][]models.Category, parentID string) []models.Category {
+	categories := children[parentID]
+	for i := range categories {
+		category := &categories[i]
+		category.Children = buildCategoryTree(children, category.ID)
+		for _, child := range category.Children {
+			category.ProductCount += child.ProductCount
+			category.OnHand += child.OnHand
+		}
+	}
+
+	if categories == nil {
+		return []models.Category{}
+	}
+	return categories
+}
+
+func (d *DB) RenameCategory(ctx context.Context, id string, req *models.RenameCategoryRequest) (*models.Category, error) {
+	result, err := d.conn.ExecContext(ctx, `
+		UPDATE categories SET name = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2
+	`, req.Name, id)
+	if err != nil {
+		return nil, categoryError(err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rows == 0 {
+		return nil, errors.New("category not found")
+	}
+
+	return d.GetCategory(ctx, id)
+}
+
+// MoveCategory moves a category and everything below it under a new
+// parent, refusing moves that would put a category below itself.
+func (d *DB) MoveCategory(ctx context.Context, id string, req *models.MoveCategoryRequest) (*models.Category, error) {
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		if err := lockCategoryTree(ctx, tx); err != nil {
+			return err
+		}
+		if err := checkCategory(ctx, tx, id); err != nil {
+			return err
+		}
+
+		if req.ParentID != "" {
+			if err := checkCategory(ctx, tx, req.ParentID); err != nil {
+				return errors.New("parent category not found")
+			}
+
+			var cycle bool
+			err := tx.QueryRowContext(ctx, `SELECT $2 IN (`+categorySubtree(1)+`)`, id, req.ParentID).Scan(&cycle)
+			if err != nil {
+				return err
+			}
+			if cycle {
+				return errors.New("cannot move a category below itself or its descendants")
+			}
+		}
+
+		_, err := tx.ExecContext(ctx, `
+			UPDATE categories SET parent_id = NULLIF($1, '')::uuid, updated_at = CURRENT_TIMESTAMP WHERE id = $2
+		`, req.ParentID, id)
+		return categoryError(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d.GetCategory(ctx, id)
+}
+
+// DeleteCategory removes a category, handing its subcategories and products
+// to its parent, or making them roots and uncategorized when it has none.
+func (d *DB) DeleteCategory(ctx context.Context, id string) error {
+	return d.withTx(ctx, func(tx *sql.Tx) error {
+		if err := lockCategoryTree(ctx, tx); err != nil {
+			return err
+		}
+
+		var parentID sql.NullString
+		err := tx.QueryRowContext(ctx, `SELECT parent_id FROM categories WHERE id = $1`, id).Scan(&parentID)
+		if err == sql.ErrNoRows {
+			return errors.New("category not found")
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE categories SET parent_id = $1, updated_at = CURRENT_TIMESTAMP WHERE parent_id = $2
+		`, parentID, id)
+		if err != nil {
+			return categoryError(err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE products SET category_id = $1, updated_at = CURRENT_TIMESTAMP WHERE category_id = $2
+		`, parentID, id)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM categories WHERE id = $1`, id)
+		return err
+	})
+}
@@ -0,0 +1,476 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/aslam/backend/internal/listquery"
+	"github.com/aslam/backend/internal/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// shelfFrozen is the SQL condition that shelf s is frozen by an open count.
+const shelfFrozen = `EXISTS (
+	SELECT 1 FROM count_session_shelves css
+	JOIN count_sessions cs ON cs.id = css.session_id
+	WHERE css.shelf_id = s.id AND cs.status = 'open' AND cs.freeze
+)`
+
+// FrozenError reports a shelf that takes no stock movements while an open
+// count has it frozen.
+type FrozenError struct {
+	ShelfName string
+}
+
+func (e *FrozenError) Error() string {
+	return fmt.Sprintf("shelf %s is frozen for a cycle count", e.ShelfName)
+}
+
+// checkNotFrozen fails if any of the shelves is frozen by an open count.
+// Callers hold the shelf locks, so a count cannot open in between.
+func checkNotFrozen(ctx context.Context, q querier, shelfIDs ...string) error {
+	query := `
+		SELECT s.name
+		FROM shelfs s
+		WHERE s.id::text = ANY($1) AND ` + shelfFrozen + `
+		LIMIT 1
+	`
+
+	var name string
+	err := q.QueryRowContext(ctx, query, pq.Array(shelfIDs)).Scan(&name)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return &FrozenError{ShelfName: name}
+}
+
+// frozenShelves returns the IDs of the shelves frozen by open counts.
+func frozenShelves(ctx context.Context, q querier) (map[string]bool, error) {
+	rows, err := q.QueryContext(ctx, `SELECT s.id FROM shelfs s WHERE `+shelfFrozen)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	frozen := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		frozen[id] = true
+	}
+
+	return frozen, rows.Err()
+}
+
+// CreateCountSession opens a count over the given shelves, snapshotting the
+// quantities they hold. A shelf can only be in one open count at a time.
+func (d *DB) CreateCountSession(ctx context.Context, req *models.CreateCountRequest) (*models.CountSession, error) {
+	shelfIDs := uniqueStrings(req.ShelfIDs)
+
+	var sessionID string
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		// Locking the shelves orders the snapshot against in-flight mutations
+		if err := lockShelves(ctx, tx, shelfIDs...); err != nil {
+			return err
+		}
+
+		var busy string
+		err := tx.QueryRowContext(ctx, `
+			SELECT s.name
+			FROM count_session_shelves css
+			JOIN count_sessions cs ON cs.id = css.session_id
+			JOIN shelfs s ON s.id = css.shelf_id
+			WHERE css.shelf_id::text = ANY($1) AND cs.status = 'open'
+			LIMIT 1
+		`, pq.Array(shelfIDs)).Scan(&busy)
+		if err == nil {
+			return fmt.Errorf("shelf %s is already in an open count", busy)
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+
+		sessionID = uuid.New().String()
+		actor := actorFromContext(ctx)
+		query := `INSERT INTO count_sessions (id, reference, status, freeze, created_by) VALUES ($1, $2, $3, $4, $5)`
+		_, err = tx.ExecContext(ctx, query, sessionID, req.Reference, models.CountOpen, req.Freeze,
+			sql.NullString{String: actor, Valid: actor != ""})
+		if err != nil {
+			return err
+		}
+
+		for _, shelfID := range shelfIDs {
+			query := `INSERT INTO count_session_shelves (session_id, shelf_id) VALUES ($1, $2)`
+			if _, err := tx.ExecContext(ctx, query, sessionID, shelfID); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO count_lines (id, session_id, shelf_id, sku, lot_number, expected_quantity)
+			SELECT gen_random_uuid(), $1, si.shelf_id, si.sku, si.lot_number, si.quantity
+			FROM shelf_items si
+			WHERE si.shelf_id::text = ANY($2)
+		`, sessionID, pq.Array(shelfIDs))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d.GetCountSession(ctx, sessionID)
+}
+
+func (d *DB) GetCountSession(ctx context.Context, id string) (*models.CountSession, error) {
+	return getCountSession(ctx, d.conn, id, false)
+}
+
+func getCountSession(ctx context.Context, q querier, id string, forUpdate bool) (*models.CountSession, error) {
+	query := `
+		SELECT id, reference, status, freeze, reason_code, created_by, approved_by, created_at, closed_at
+		FROM count_sessions
+		WHERE id = $1
+	`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+
+	session := &models.CountSession{}
+	var createdBy, approvedBy sql.NullString
+	var closedAt sql.NullTime
+	err := q.QueryRowContext(ctx, query, id).Scan(&session.ID, &session.Reference, &session.Status, &session.Freeze,
+		&session.ReasonCode, &createdBy, &approvedBy, &session.CreatedAt, &closedAt)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("count session not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	session.CreatedBy = createdBy.String
+	session.ApprovedBy = approvedBy.String
+	session.ClosedAt = timePtr(closedAt)
+
+	rows, err := q.QueryContext(ctx, `SELECT shelf_id FROM count_session_shelves WHERE session_id = $1 ORDER BY shelf_id`, id)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var shelfID string
+		if err := rows.Scan(&shelfID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		session.ShelfIDs = append(session.ShelfIDs, shelfID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if session.Lines, err = getCountLines(ctx, q, id); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func getCountLines(ctx context.Context, q querier, sessionID string) ([]models.CountLine, error) {
+	query := `
+		SELECT id, shelf_id, sku, lot_number, expected_quantity, counted_quantity, serial_numbers, counted_by, counted_at
+		FROM count_lines
+		WHERE session_id = $1
+		ORDER BY shelf_id, sku, lot_number
+	`
+
+	rows, err := q.QueryContext(ctx, query, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := []models.CountLine{}
+	for rows.Next() {
+		var line models.CountLine
+		var counted sql.NullInt64
+		var countedBy sql.NullString
+		var countedAt sql.NullTime
+		err := rows.Scan(&line.ID, &line.ShelfID, &line.SKU, &line.LotNumber, &line.ExpectedQuantity, &counted,
+			pq.Array(&line.SerialNumbers), &countedBy, &countedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if counted.Valid {
+			quantity := int(counted.Int64)
+			variance := quantity - line.ExpectedQuantity
+			line.CountedQuantity = &quantity
+			line.Variance = &variance
+		}
+		line.CountedBy = countedBy.String
+		line.CountedAt = timePtr(countedAt)
+		lines = append(lines, line)
+	}
+
+	return lines, rows.Err()
+}
+
+// CountSessionList is what count session lists can be sorted and filtered by.
+var CountSessionList = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"id":          {Column: "id", Type: listquery.UUID},
+		"reference":   {Column: "reference", Type: listquery.String},
+		"status":      {Column: "status", Type: listquery.String},
+		"created_at":  {Column: "created_at", Type: listquery.Time},
+		"freeze":      {Column: "freeze", Type: listquery.Bool},
+		"reason_code": {Column: "reason_code", Type: listquery.String},
+	},
+	Sort: []listquery.Sort{{Field: "created_at", Desc: true}},
+	Key:  "id",
+}
+
+func (d *DB) ListCountSessions(ctx context.Context, status models.CountStatus, lq *listquery.Query) ([]models.CountSession, *listquery.Page, error) {
+	var conditions []string
+	var args []interface{}
+	if status != "" {
+		args = append(args, string(status))
+		conditions = append(conditions, "status = $1")
+	}
+
+	if lq == nil {
+		lq = listquery.All(CountSessionList)
+	}
+
+	var ids []string
+	page, err := queryPage(ctx, d.conn, lq, "id", "count_sessions", conditions, args, func(row rowScanner) error {
+		var id string
+		if err := row.Scan(&id); err != nil {
+			return err
+		}
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var sessions []models.CountSession
+	for _, id := range ids {
+		item, err := d.GetCountSession(ctx, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		sessions = append(sessions, *item)
+	}
+
+	return sessions, page, nil
+}
+
+// SubmitCounts records counted quantities. Counting a line again replaces the
+// earlier count, and SKUs that were not expected on the shelf get a new line.
+func (d *DB) SubmitCounts(ctx context.Context, sessionID string, req *models.SubmitCountsRequest) (*models.CountSession, error) {
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		session, err := getCountSession(ctx, tx, sessionID, true)
+		if err != nil {
+			return err
+		}
+		if session.Status != models.CountOpen {
+			return fmt.Errorf("count session is %s", session.Status)
+		}
+
+		inSession := make(map[string]bool, len(session.ShelfIDs))
+		for _, shelfID := range session.ShelfIDs {
+			inSession[shelfID] = true
+		}
+
+		actor := actorFromContext(ctx)
+		for _, count := range req.Lines {
+			if !inSession[count.ShelfID] {
+				return fmt.Errorf("shelf %s is not part of this count", count.ShelfID)
+			}
+			product, err := getProductFields(ctx, tx, count.SKU)
+			if err != nil {
+				return fmt.Errorf("%s: %w", count.SKU, err)
+			}
+
+			// Units found beyond the snapshot go onto the shelf on approval,
+			// so serialized ones must be named now
+			var expected int
+			err = tx.QueryRowContext(ctx, `
+				SELECT expected_quantity FROM count_lines
+				WHERE session_id = $1 AND shelf_id = $2 AND sku = $3 AND lot_number = $4
+			`, sessionID, count.ShelfID, count.SKU, count.LotNumber).Scan(&expected)
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+			found := count.Quantity - expected
+			if found < 0 {
+				found = 0
+			}
+			if err := validateSerials(product, count.SerialNumbers, found); err != nil {
+				return fmt.Errorf("%s on shelf %s: %w", count.SKU, count.ShelfID, err)
+			}
+
+			query := `
+				INSERT INTO count_lines (id, session_id, shelf_id, sku, lot_number, expected_quantity,
+					counted_quantity, serial_numbers, counted_by, counted_at)
+				VALUES ($1, $2, $3, $4, $5, 0, $6, COALESCE($7, '{}'), $8, CURRENT_TIMESTAMP)
+				ON CONFLICT (session_id, shelf_id, sku, lot_number) DO UPDATE
+				SET counted_quantity = EXCLUDED.counted_quantity,
+				    serial_numbers = EXCLUDED.serial_numbers,
+				    counted_by = EXCLUDED.counted_by,
+				    counted_at = EXCLUDED.counted_at
+			`
+			_, err = tx.ExecContext(ctx, query, uuid.New().String(), sessionID, count.ShelfID, count.SKU,
+				count.LotNumber, count.Quantity, pq.Array(count.SerialNumbers), sql.NullString{String: actor, Valid: actor != ""})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d.GetCountSession(ctx, sessionID)
+}
+
+// ApproveCount closes a fully counted session and posts each variance to the
+// shelves as an adjustment carrying the reason code. Variances are applied
+// as deltas, so movements made since the snapshot on unfrozen shelves are
+// kept.
+func (d *DB) ApproveCount(ctx context.Context, sessionID string, req *models.ApproveCountRequest) (*models.CountSession, error) {
+	ctx = withReasonCode(ctx, string(req.ReasonCode))
+
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		session, err := getCountSession(ctx, tx, sessionID, true)
+		if err != nil {
+			return err
+		}
+		if session.Status != models.CountOpen {
+			return fmt.Errorf("count session is %s", session.Status)
+		}
+
+		var adjustments []models.CountLine
+		for _, line := range session.Lines {
+			if line.Variance == nil {
+				return fmt.Errorf("%s on shelf %s has not been counted", line.SKU, line.ShelfID)
+			}
+			if *line.Variance != 0 {
+				adjustments = append(adjustments, line)
+			}
+		}
+
+		// Closing the session first lifts its freeze for the adjustments
+		actor := actorFromContext(ctx)
+		_, err = tx.ExecContext(ctx, `
+			UPDATE count_sessions
+			SET status = $1, reason_code = $2, approved_by = $3, closed_at = CURRENT_TIMESTAMP
+			WHERE id = $4
+		`, models.CountApproved, req.ReasonCode, sql.NullString{String: actor, Valid: actor != ""}, sessionID)
+		if err != nil {
+			return err
+		}
+
+		// Take every product and then every shelf lock up front, so the
+		// adjustments keep the standard lock order between them. Shortfalls
+		// take stock away, so products are locked for update
+		skus := make([]string, len(adjustments))
+		for i, line := range adjustments {
+			skus[i] = line.SKU
+		}
+		if err := lockProducts(ctx, tx, skus, true); err != nil {
+			return err
+		}
+		if err := lockShelves(ctx, tx, session.ShelfIDs...); err != nil {
+			return err
+		}
+
+		// Costs are locked per SKU as adjustments post, so post in SKU order
+		sort.SliceStable(adjustments, func(i, j int) bool {
+			return adjustments[i].SKU < adjustments[j].SKU
+		})
+		for _, line := range adjustments {
+			if err := postCountAdjustment(ctx, tx, line); err != nil {
+				return fmt.Errorf("%s on shelf %s: %w", line.SKU, line.ShelfID, err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d.GetCountSession(ctx, sessionID)
+}
+
+// postCountAdjustment applies one line's variance through the regular shelf
+// mutations. Counted stock is physically there, so capacity is forced.
+func postCountAdjustment(ctx context.Context, q querier, line models.CountLine) error {
+	var itemID string
+	var quantity int
+	err := q.QueryRowContext(ctx, `
+		SELECT id, quantity FROM shelf_items WHERE shelf_id = $1 AND sku = $2 AND lot_number = $3
+	`, line.ShelfID, line.SKU, line.LotNumber).Scan(&itemID, &quantity)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	variance := *line.Variance
+	if variance > 0 {
+		req := &models.AddItemToShelfRequest{
+			SKU:           line.SKU,
+			Quantity:      variance,
+			LotNumber:     line.LotNumber,
+			SerialNumbers: line.SerialNumbers,
+			Force:         true,
+		}
+		_, err := addItemToShelf(ctx, q, line.ShelfID, req, models.MovementCount)
+		return err
+	}
+
+	if itemID == "" || quantity+variance < 0 {
+		return errors.New("stock has already left the shelf since the count opened")
+	}
+	if quantity+variance == 0 {
+		return removeItemFromShelf(ctx, q, itemID, models.MovementCount)
+	}
+	return setItemQuantity(ctx, q, itemID, quantity+variance, nil, true, models.MovementCount)
+}
+
+// CancelCount closes a session without touching stock.
+func (d *DB) CancelCount(ctx context.Context, sessionID string) (*models.CountSession, error) {
+	result, err := d.conn.ExecContext(ctx, `
+		UPDATE count_sessions SET status = $1, closed_at = CURRENT_TIMESTAMP WHERE id = $2 AND status = $3
+	`, models.CountCancelled, sessionID, models.CountOpen)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := d.GetCountSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if rows == 0 {
+		return nil, fmt.Errorf("count session is %s", session.Status)
+	}
+
+	return session, nil
+}
@@ -0,0 +1,494 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/aslam/backend/internal/listquery"
+	"github.com/aslam/backend/internal/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+func (d *DB) CreateInboundDocument(ctx context.Context, req *models.CreateInboundRequest) (*models.InboundDocument, error) {
+	var documentID string
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		documentID = uuid.New().String()
+		actor := actorFromContext(ctx)
+
+		var expectedAt sql.NullTime
+		if req.ExpectedAt != nil {
+			expectedAt = sql.NullTime{Time: *req.ExpectedAt, Valid: true}
+		}
+
+		query := `
+			INSERT INTO inbound_documents (id, type, reference, supplier, status, expected_at, created_by)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`
+		_, err := tx.ExecContext(ctx, query, documentID, req.Type, req.Reference, req.Supplier, models.InboundOpen,
+			expectedAt, sql.NullString{String: actor, Valid: actor != ""})
+		if err != nil {
+			return err
+		}
+
+		seen := make(map[string]bool, len(req.Lines))
+		for _, line := range req.Lines {
+			if seen[line.SKU] {
+				return fmt.Errorf("duplicate line for %s", line.SKU)
+			}
+			seen[line.SKU] = true
+
+			if _, err := getProductFields(ctx, tx, line.SKU); err != nil {
+				return fmt.Errorf("%s: %w", line.SKU, err)
+			}
+
+			query := `INSERT INTO inbound_lines (id, document_id, sku, expected_quantity, unit_cost) VALUES ($1, $2, $3, $4, $5)`
+			_, err := tx.ExecContext(ctx, query, uuid.New().String(), documentID, line.SKU, line.Quantity, line.UnitCost)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d.GetInboundDocument(ctx, documentID)
+}
+
+func (d *DB) GetInboundDocument(ctx context.Context, id string) (*models.InboundDocument, error) {
+	return getInboundDocument(ctx, d.conn, id, false)
+}
+
+// getInboundDocument loads a document with its lines, optionally locking the
+// document row so receipts against it are serialized.
+func getInboundDocument(ctx context.Context, q querier, id string, forUpdate bool) (*models.InboundDocument, error) {
+	query := `
+		SELECT id, type, reference, supplier, status, expected_at, created_by, created_at, updated_at, closed_at
+		FROM inbound_documents
+		WHERE id = $1
+	`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+
+	document := &models.InboundDocument{}
+	var expectedAt, closedAt sql.NullTime
+	var createdBy sql.NullString
+	err := q.QueryRowContext(ctx, query, id).Scan(&document.ID, &document.Type, &document.Reference, &document.Supplier,
+		&document.Status, &expectedAt, &createdBy, &document.CreatedAt, &document.UpdatedAt, &closedAt)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("inbound document not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	document.ExpectedAt = timePtr(expectedAt)
+	document.ClosedAt = timePtr(closedAt)
+	document.CreatedBy = createdBy.String
+
+	document.Lines, err = getInboundLines(ctx, q, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return document, nil
+}
+
+func getInboundLines(ctx context.Context, q querier, documentID string) ([]models.InboundLine, error) {
+	query := `
+		SELECT id, sku, expected_quantity, received_quantity, unit_cost
+		FROM inbound_lines
+		WHERE document_id = $1
+		ORDER BY created_at, id
+	`
+
+	rows, err := q.QueryContext(ctx, query, documentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := []models.InboundLine{}
+	for rows.Next() {
+		var line models.InboundLine
+		if err := rows.Scan(&line.ID, &line.SKU, &line.ExpectedQuantity, &line.ReceivedQuantity, &line.UnitCost); err != nil {
+			return nil, err
+		}
+
+		line.Variance = line.ReceivedQuantity - line.ExpectedQuantity
+		switch {
+		case line.Variance > 0:
+			line.Discrepancy = models.DiscrepancyOver
+		case line.Variance < 0:
+			line.Discrepancy = models.DiscrepancyUnder
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, rows.Err()
+}
+
+// InboundList is what inbound document lists can be sorted and filtered by.
+var InboundList = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"id":         {Column: "id", Type: listquery.UUID},
+		"type":       {Column: "type", Type: listquery.String},
+		"reference":  {Column: "reference", Type: listquery.String},
+		"supplier":   {Column: "supplier", Type: listquery.String},
+		"status":     {Column: "status", Type: listquery.String},
+		"created_at": {Column: "created_at", Type: listquery.Time},
+		"updated_at": {Column: "updated_at", Type: listquery.Time},
+	},
+	Sort: []listquery.Sort{{Field: "created_at", Desc: true}},
+	Key:  "id",
+}
+
+func (d *DB) ListInboundDocuments(ctx context.Context, status models.InboundStatus, lq *listquery.Query) ([]models.InboundDocument, *listquery.Page, error) {
+	var conditions []string
+	var args []interface{}
+	if status != "" {
+		args = append(args, string(status))
+		conditions = append(conditions, "status = $1")
+	}
+
+	if lq == nil {
+		lq = listquery.All(InboundList)
+	}
+
+	var ids []string
+	page, err := queryPage(ctx, d.conn, lq, "id", "inbound_documents", conditions, args, func(row rowScanner) error {
+		var id string
+		if err := row.Scan(&id); err != nil {
+			return err
+		}
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var documents []models.InboundDocument
+	for _, id := range ids {
+		item, err := d.GetInboundDocument(ctx, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		documents = append(documents, *item)
+	}
+
+	return documents, page, nil
+}
+
+// ReceiveInbound books delivered units against the document's lines and puts
+// them in the staging area. Quantities beyond what was expected are accepted
+// and show up as over-deliveries on the line.
+func (d *DB) ReceiveInbound(ctx context.Context, documentID string, req *models.ReceiveRequest) (*models.InboundDocument, error) {
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		document, err := getInboundDocument(ctx, tx, documentID, true)
+		if err != nil {
+			return err
+		}
+		if document.Status == models.InboundClosed {
+			return errors.New("inbound document is closed")
+		}
+
+		lines := make(map[string]models.InboundLine, len(document.Lines))
+		for _, line := range document.Lines {
+			lines[line.SKU] = line
+		}
+
+		// Lock the products in sorted order, so receipts sharing SKUs cannot
+		// deadlock. Shared keeps them from being archived while their units
+		// are staged; exclusive when serials come along, so two receipts
+		// cannot stage the same serial at once
+		skus := make([]string, len(req.Lines))
+		serialized := false
+		for i, receipt := range req.Lines {
+			if _, ok := lines[receipt.SKU]; !ok {
+				return fmt.Errorf("%s is not on this document", receipt.SKU)
+			}
+			skus[i] = receipt.SKU
+			serialized = serialized || len(receipt.SerialNumbers) > 0
+		}
+		if err := lockProducts(ctx, tx, skus, serialized); err != nil {
+			return err
+		}
+
+		actor := actorFromContext(ctx)
+		received := make(map[string]bool)
+		for _, receipt := range req.Lines {
+			line := lines[receipt.SKU]
+			unitCost := receipt.UnitCost
+			if unitCost == 0 {
+				unitCost = line.UnitCost
+			}
+
+			if receipt.ManufacturedAt != nil && receipt.ExpiresAt != nil && receipt.ExpiresAt.Before(*receipt.ManufacturedAt) {
+				return errors.New("expiry date cannot be before manufacturing date")
+			}
+
+			product, err := getProductFields(ctx, tx, receipt.SKU)
+			if err != nil {
+				return err
+			}
+			if product.ArchivedAt != nil {
+				return fmt.Errorf("%s is archived", receipt.SKU)
+			}
+			if err := validateSerials(product, receipt.SerialNumbers, receipt.Quantity); err != nil {
+				return err
+			}
+			for _, serial := range receipt.SerialNumbers {
+				if received[serial] {
+					return fmt.Errorf("duplicate serial number %s", serial)
+				}
+				received[serial] = true
+			}
+			if err := checkSerialsReceivable(ctx, tx, receipt.SKU, receipt.SerialNumbers); err != nil {
+				return err
+			}
+
+			var manufacturedAt, expiresAt sql.NullTime
+			if receipt.ManufacturedAt != nil {
+				manufacturedAt = sql.NullTime{Time: *receipt.ManufacturedAt, Valid: true}
+			}
+			if receipt.ExpiresAt != nil {
+				expiresAt = sql.NullTime{Time: *receipt.ExpiresAt, Valid: true}
+			}
+
+			query := `
+				INSERT INTO staged_items (id, document_id, line_id, sku, quantity, lot_number, manufactured_at, expires_at,
+					serial_numbers, unit_cost, received_by)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, COALESCE($9, '{}'), $10, $11)
+			`
+			_, err = tx.ExecContext(ctx, query, uuid.New().String(), documentID, line.ID, receipt.SKU, receipt.Quantity,
+				receipt.LotNumber, manufacturedAt, expiresAt, pq.Array(receipt.SerialNumbers), unitCost,
+				sql.NullString{String: actor, Valid: actor != ""})
+			if err != nil {
+				return err
+			}
+
+			query = `UPDATE inbound_lines SET received_quantity = received_quantity + $1 WHERE id = $2`
+			if _, err := tx.ExecContext(ctx, query, receipt.Quantity, line.ID); err != nil {
+				return err
+			}
+		}
+
+		query := `UPDATE inbound_documents SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
+		_, err = tx.ExecContext(ctx, query, models.InboundReceiving, documentID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d.GetInboundDocument(ctx, documentID)
+}
+
+// CloseInbound stops further receipts against the document. Its lines keep
+// their over- and under-delivery flags, and anything still in staging can
+// be put away afterwards.
+func (d *DB) CloseInbound(ctx context.Context, documentID string) (*models.InboundDocument, error) {
+	query := `
+		UPDATE inbound_documents
+		SET status = $1, closed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND status <> $1
+	`
+
+	result, err := d.conn.ExecContext(ctx, query, models.InboundClosed, documentID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	document, err := d.GetInboundDocument(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	if rows == 0 {
+		return nil, errors.New("inbound document is already closed")
+	}
+
+	return document, nil
+}
+
+// stagedItemColumns lists the staged_items columns, joined with products as
+// p, in the order scanStagedItem expects.
+const stagedItemColumns = `st.id, st.document_id, st.line_id, st.sku, p.name, st.quantity, st.lot_number,
+	st.manufactured_at, st.expires_at, st.serial_numbers, st.unit_cost, st.received_by, st.received_at`
+
+func scanStagedItem(row rowScanner, item *models.StagedItem) error {
+	var manufacturedAt, expiresAt sql.NullTime
+	var receivedBy sql.NullString
+	err := row.Scan(&item.ID, &item.DocumentID, &item.LineID, &item.SKU, &item.ProductName, &item.Quantity,
+		&item.LotNumber, &manufacturedAt, &expiresAt, pq.Array(&item.SerialNumbers), &item.UnitCost, &receivedBy, &item.ReceivedAt)
+	if err != nil {
+		return err
+	}
+
+	item.ManufacturedAt = timePtr(manufacturedAt)
+	item.ExpiresAt = timePtr(expiresAt)
+	item.ReceivedBy = receivedBy.String
+	return nil
+}
+
+// StagedItemList is what staged item lists can be sorted and filtered by.
+var StagedItemList = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"id":          {Column: "st.id", Type: listquery.UUID},
+		"sku":         {Column: "st.sku", Type: listquery.String},
+		"quantity":    {Column: "st.quantity", Type: listquery.Int},
+		"lot_number":  {Column: "st.lot_number", Type: listquery.String},
+		"received_at": {Column: "st.received_at", Type: listquery.Time},
+	},
+	Sort: []listquery.Sort{{Field: "received_at"}},
+	Key:  "id",
+}
+
+func (d *DB) ListStagedItems(ctx context.Context, documentID string, lq *listquery.Query) ([]models.StagedItem, *listquery.Page, error) {
+	var conditions []string
+	var args []interface{}
+	if documentID != "" {
+		args = append(args, documentID)
+		conditions = append(conditions, "st.document_id::text = $1")
+	}
+
+	if lq == nil {
+		lq = listquery.All(StagedItemList)
+	}
+
+	var items []models.StagedItem
+	from := "staged_items st JOIN products p ON p.sku = st.sku"
+	page, err := queryPage(ctx, d.conn, lq, stagedItemColumns, from, conditions, args, func(row rowScanner) error {
+		var item models.StagedItem
+		if err := scanStagedItem(row, &item); err != nil {
+			return err
+		}
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return items, page, nil
+}
+
+func getStagedItem(ctx context.Context, q querier, id string, forUpdate bool) (*models.StagedItem, error) {
+	query := `
+		SELECT ` + stagedItemColumns + `
+		FROM staged_items st
+		JOIN products p ON p.sku = st.sku
+		WHERE st.id = $1
+	`
+	if forUpdate {
+		query += ` FOR UPDATE OF st`
+	}
+
+	item := &models.StagedItem{}
+	err := scanStagedItem(q.QueryRowContext(ctx, query, id), item)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("staged item not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// PutawayStagedItem moves staged units onto a shelf through the same path as
+// a manual addition, so capacity, lot and serial rules all apply.
+func (d *DB) PutawayStagedItem(ctx context.Context, stagedID string, req *models.PutawayRequest) (*models.ShelfItem, error) {
+	var item *models.ShelfItem
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		staged, err := getStagedItem(ctx, tx, stagedID, true)
+		if err != nil {
+			return err
+		}
+
+		if req.Quantity > staged.Quantity {
+			return fmt.Errorf("only %d units are staged", staged.Quantity)
+		}
+
+		serials, remaining, err := pickStagedSerials(staged.SerialNumbers, req.SerialNumbers, req.Quantity)
+		if err != nil {
+			return err
+		}
+
+		addReq := &models.AddItemToShelfRequest{
+			SKU:            staged.SKU,
+			Quantity:       req.Quantity,
+			Force:          req.Force,
+			LotNumber:      staged.LotNumber,
+			ManufacturedAt: staged.ManufacturedAt,
+			ExpiresAt:      staged.ExpiresAt,
+			SerialNumbers:  serials,
+			UnitCost:       staged.UnitCost,
+		}
+		if item, err = addItemToShelf(ctx, tx, req.ShelfID, addReq, models.MovementPutaway); err != nil {
+			return err
+		}
+
+		if req.Quantity == staged.Quantity {
+			_, err = tx.ExecContext(ctx, `DELETE FROM staged_items WHERE id = $1`, stagedID)
+		} else {
+			_, err = tx.ExecContext(ctx, `UPDATE staged_items SET quantity = quantity - $1, serial_numbers = COALESCE($2, '{}') WHERE id = $3`,
+				req.Quantity, pq.Array(remaining), stagedID)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// pickStagedSerials splits the serials of a staged row into those going to
+// the shelf and those left behind. Without an explicit choice the earliest
+// received units go first.
+func pickStagedSerials(staged, requested []string, quantity int) (taken, remaining []string, err error) {
+	if len(staged) == 0 {
+		if len(requested) > 0 {
+			return nil, nil, errors.New("staged item has no serial numbers")
+		}
+		return nil, nil, nil
+	}
+
+	if len(requested) == 0 {
+		return staged[:quantity], staged[quantity:], nil
+	}
+	if len(requested) != quantity {
+		return nil, nil, fmt.Errorf("expected %d serial numbers, got %d", quantity, len(requested))
+	}
+
+	chosen := make(map[string]bool, len(requested))
+	for _, serial := range requested {
+		chosen[serial] = true
+	}
+	for _, serial := range staged {
+		if chosen[serial] {
+			taken = append(taken, serial)
+			delete(chosen, serial)
+		} else {
+			remaining = append(remaining, serial)
+		}
+	}
+	for _, serial := range requested {
+		if chosen[serial] {
+			return nil, nil, fmt.Errorf("serial number %s is not in this staged item", serial)
+		}
+	}
+
+	return taken, remaining, nil
+}
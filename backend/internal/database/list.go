@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aslam/backend/internal/listquery"
+)
+
+// withExtra scans a row's usual columns followed by extra ones.
+type withExtra struct {
+	row   rowScanner
+	extra []interface{}
+}
+
+func (w withExtra) Scan(dest ...interface{}) error {
+	return w.row.Scan(append(dest, w.extra...)...)
+}
+
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// queryPage selects columns from a list's tables, from being the FROM
+// clause and conditions the list's own filters, narrowed and ordered by the
+// list query. scan reads each row of the page.
+func queryPage(ctx context.Context, q querier, lq *listquery.Query, columns, from string, conditions []string, args []interface{}, scan func(rowScanner) error) (*listquery.Page, error) {
+	conditions, args = lq.FilterWhere(conditions, args)
+
+	page := &listquery.Page{}
+	err := q.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+from+whereClause(conditions), args...).Scan(&page.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	conditions, args = lq.AfterWhere(conditions, args)
+	query := `SELECT ` + columns + `, ` + lq.CursorColumn() + ` FROM ` + from + whereClause(conditions) + ` ` + lq.OrderBy()
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var n int
+	var last string
+	for rows.Next() {
+		// The row past the limit only shows that another page follows
+		if lq.Limit > 0 && n == lq.Limit {
+			next := lq.Cursor(last)
+			page.NextCursor = &next
+			break
+		}
+
+		if err := scan(withExtra{rows, []interface{}{&last}}); err != nil {
+			return nil, err
+		}
+		n++
+	}
+
+	return page, rows.Err()
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/aslam/backend/internal/listquery"
+	"github.com/aslam/backend/internal/models"
+)
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// ExpiringStockList is what expiring stock lists can be sorted and filtered
+// by.
+var ExpiringStockList = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"id":         {Column: "si.id", Type: listquery.UUID},
+		"shelf_id":   {Column: "si.shelf_id", Type: listquery.UUID},
+		"sku":        {Column: "si.sku", Type: listquery.String},
+		"quantity":   {Column: "si.quantity", Type: listquery.Int},
+		"lot_number": {Column: "si.lot_number", Type: listquery.String},
+		"expires_at": {Column: "si.expires_at", Type: listquery.Time},
+	},
+	Sort: []listquery.Sort{{Field: "expires_at"}},
+	Key:  "id",
+}
+
+// ListExpiringStock returns every shelf item whose lot expires within the
+// next days days, including lots that have already expired, soonest first.
+func (d *DB) ListExpiringStock(ctx context.Context, days int, lq *listquery.Query) ([]models.ShelfItem, *listquery.Page, error) {
+	conditions := []string{"si.expires_at IS NOT NULL AND si.expires_at <= CURRENT_DATE + $1::integer"}
+	args := []interface{}{days}
+
+	if lq == nil {
+		lq = listquery.All(ExpiringStockList)
+	}
+
+	var items []models.ShelfItem
+	from := "shelf_items si JOIN products p ON si.sku = p.sku"
+	page, err := queryPage(ctx, d.conn, lq, shelfItemColumns, from, conditions, args, func(row rowScanner) error {
+		var item models.ShelfItem
+		if err := scanShelfItem(row, &item); err != nil {
+			return err
+		}
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := describeQuantities(ctx, d.conn, items); err != nil {
+		return nil, nil, err
+	}
+
+	return items, page, nil
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/aslam/backend/internal/listquery"
+	"github.com/aslam/backend/internal/models"
+)
+
+// mediaJSON aggregates the product_media rows aliased m into the JSON of
+// []models.ProductMedia. Timestamps have no zone, which the driver reads as
+// UTC; the JSON gets the same zone so it parses as time.Time.
+const mediaJSON = `COALESCE(json_agg(json_build_object(
+		'id', m.id, 'sku', m.sku, 'kind', m.kind, 'filename', m.filename, 'content_type', m.content_type,
+		'size', m.size, 'url', m.url, 'thumbnail_url', m.thumbnail_url, 'created_at', m.created_at AT TIME ZONE 'UTC'
+	) ORDER BY m.created_at), '[]')`
+
+const mediaColumns = `id, sku, kind, filename, content_type, size, url, thumbnail_url, created_at, storage_key, thumbnail_key`
+
+func scanMedia(row rowScanner, m *models.ProductMedia) error {
+	return row.Scan(&m.ID, &m.SKU, &m.Kind, &m.Filename, &m.ContentType, &m.Size, &m.URL, &m.ThumbnailURL, &m.CreatedAt,
+		&m.StorageKey, &m.ThumbnailKey)
+}
+
+// MediaList is what product media lists can be sorted and filtered by.
+var MediaList = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"id":           {Column: "id", Type: listquery.UUID},
+		"kind":         {Column: "kind", Type: listquery.String},
+		"filename":     {Column: "filename", Type: listquery.String},
+		"content_type": {Column: "content_type", Type: listquery.String},
+		"size":         {Column: "size", Type: listquery.Int},
+		"created_at":   {Column: "created_at", Type: listquery.Time},
+	},
+	Sort: []listquery.Sort{{Field: "created_at"}},
+	Key:  "id",
+}
+
+func (d *DB) ListMedia(ctx context.Context, sku string, lq *listquery.Query) ([]models.ProductMedia, *listquery.Page, error) {
+	if _, err := getProductFields(ctx, d.conn, sku); err != nil {
+		return nil, nil, err
+	}
+
+	if lq == nil {
+		lq = listquery.All(MediaList)
+	}
+
+	media := []models.ProductMedia{}
+	page, err := queryPage(ctx, d.conn, lq, mediaColumns, "product_media", []string{"sku = $1"}, []interface{}{sku}, func(row rowScanner) error {
+		var m models.ProductMedia
+		if err := scanMedia(row, &m); err != nil {
+			return err
+		}
+		media = append(media, m)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return media, page, nil
+}
+
+// AddMedia records a file already put in storage. The ID is chosen by the
+// caller, since it is part of the storage keys.
+func (d *DB) AddMedia(ctx context.Context, m *models.ProductMedia) (*models.ProductMedia, error) {
+	media := &models.ProductMedia{}
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		// Shared, so uploads do not block each other but the product
+		// cannot be deleted under them
+		if _, err := lockProduct(ctx, tx, m.SKU, false); err != nil {
+			return err
+		}
+
+		return scanMedia(tx.QueryRowContext(ctx, `
+			INSERT INTO product_media (id, sku, kind, filename, content_type, size, url, thumbnail_url, storage_key, thumbnail_key)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			RETURNING `+mediaColumns,
+			m.ID, m.SKU, string(m.Kind), m.Filename, m.ContentType, m.Size, m.URL, m.ThumbnailURL, m.StorageKey, m.ThumbnailKey), media)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return media, nil
+}
+
+// DeleteMedia removes the record of a file and returns it, so the caller
+// can remove the file from storage.
+func (d *DB) DeleteMedia(ctx context.Context, sku, id string) (*models.ProductMedia, error) {
+	media := &models.ProductMedia{}
+	err := scanMedia(d.conn.QueryRowContext(ctx, `
+		DELETE FROM product_media WHERE sku = $1 AND id::text = $2
+		RETURNING `+mediaColumns, sku, id), media)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("media not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return media, nil
+}
@@ -0,0 +1,172 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/aslam/backend/internal/listquery"
+	"github.com/aslam/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx carrying the ID of the user performing the
+// request, so stock movements can be attributed to them.
+func WithActor(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, actorKey{}, userID)
+}
+
+func actorFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(actorKey{}).(string)
+	return userID
+}
+
+type reasonCodeKey struct{}
+
+// withReasonCode returns a copy of ctx whose stock movements are recorded
+// with the given reason code, such as why a count adjusted stock.
+func withReasonCode(ctx context.Context, code string) context.Context {
+	return context.WithValue(ctx, reasonCodeKey{}, code)
+}
+
+// recordMovement appends a row to the stock ledger, filling in its ID, acting
+// user and cost. It must be called with the same querier as the shelf mutation
+// it describes so both commit together.
+func recordMovement(ctx context.Context, q querier, movement *models.StockMovement) error {
+	if movement.QuantityDelta == 0 {
+		return nil
+	}
+
+	movement.ID = uuid.New().String()
+	movement.UserID = actorFromContext(ctx)
+	if movement.ReasonCode == "" {
+		movement.ReasonCode, _ = ctx.Value(reasonCodeKey{}).(string)
+	}
+	userID := sql.NullString{String: movement.UserID, Valid: movement.UserID != ""}
+
+	if err := costMovement(ctx, q, movement); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO stock_movements (id, sku, shelf_id, lot_number, quantity_delta, reason, reason_code, user_id,
+			unit_cost, total_cost)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+
+	_, err := q.ExecContext(ctx, query, movement.ID, movement.SKU, movement.ShelfID, movement.LotNumber,
+		movement.QuantityDelta, string(movement.Reason), movement.ReasonCode, userID, movement.UnitCost, movement.TotalCost)
+	if err != nil {
+		return err
+	}
+
+	for _, serial := range movement.SerialNumbers {
+		_, err := q.ExecContext(ctx, `INSERT INTO stock_movement_serials (movement_id, serial_number) VALUES ($1, $2)`,
+			movement.ID, serial)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// movementColumns lists the stock_movements columns, aliased as m, in the
+// order scanMovement expects.
+const movementColumns = `m.id, m.sku, m.shelf_id, m.lot_number, m.quantity_delta, m.reason, m.reason_code, m.user_id,
+	m.unit_cost, m.total_cost, m.created_at`
+
+func scanMovement(row rowScanner, movement *models.StockMovement) error {
+	var userID sql.NullString
+	err := row.Scan(&movement.ID, &movement.SKU, &movement.ShelfID, &movement.LotNumber, &movement.QuantityDelta,
+		&movement.Reason, &movement.ReasonCode, &userID, &movement.UnitCost, &movement.TotalCost, &movement.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	movement.UserID = userID.String
+	return nil
+}
+
+func queryMovements(ctx context.Context, q querier, query string, args ...interface{}) ([]models.StockMovement, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var movements []models.StockMovement
+	for rows.Next() {
+		var movement models.StockMovement
+		if err := scanMovement(rows, &movement); err != nil {
+			return nil, err
+		}
+		movements = append(movements, movement)
+	}
+
+	return movements, rows.Err()
+}
+
+// MovementList is what movement lists can be sorted and filtered by.
+var MovementList = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"id":             {Column: "m.id", Type: listquery.UUID},
+		"sku":            {Column: "m.sku", Type: listquery.String},
+		"quantity_delta": {Column: "m.quantity_delta", Type: listquery.Int},
+		"reason":         {Column: "m.reason", Type: listquery.String},
+		"reason_code":    {Column: "m.reason_code", Type: listquery.String},
+		"created_at":     {Column: "m.created_at", Type: listquery.Time},
+	},
+	Sort: []listquery.Sort{{Field: "created_at", Desc: true}},
+	Key:  "id",
+}
+
+func (d *DB) ListMovements(ctx context.Context, filter *models.MovementFilter, lq *listquery.Query) ([]models.StockMovement, *listquery.Page, error) {
+	var conditions []string
+	var args []interface{}
+
+	addCondition := func(clause string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(clause, len(args)))
+	}
+
+	if filter.SKU != "" {
+		addCondition("m.sku = $%d", filter.SKU)
+	}
+	if filter.ShelfID != "" {
+		addCondition("m.shelf_id = $%d", filter.ShelfID)
+	}
+	if filter.LotNumber != "" {
+		addCondition("m.lot_number = $%d", filter.LotNumber)
+	}
+	if filter.UserID != "" {
+		addCondition("m.user_id = $%d", filter.UserID)
+	}
+	if !filter.From.IsZero() {
+		addCondition("m.created_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("m.created_at <= $%d", filter.To)
+	}
+
+	if lq == nil {
+		lq = listquery.All(MovementList)
+	}
+
+	var movements []models.StockMovement
+	page, err := queryPage(ctx, d.conn, lq, movementColumns, "stock_movements m", conditions, args, func(row rowScanner) error {
+		var movement models.StockMovement
+		if err := scanMovement(row, &movement); err != nil {
+			return err
+		}
+		movements = append(movements, movement)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return movements, page, nil
+}
@@ -0,0 +1,511 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/aslam/backend/internal/listquery"
+	"github.com/aslam/backend/internal/models"
+	"github.com/aslam/backend/internal/routing"
+	"github.com/google/uuid"
+)
+
+func (d *DB) CreateOrder(ctx context.Context, req *models.CreateOrderRequest) (*models.Order, error) {
+	var orderID string
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		orderID = uuid.New().String()
+		actor := actorFromContext(ctx)
+
+		query := `INSERT INTO orders (id, reference, status, created_by) VALUES ($1, $2, $3, $4)`
+		_, err := tx.ExecContext(ctx, query, orderID, req.Reference, models.OrderOpen,
+			sql.NullString{String: actor, Valid: actor != ""})
+		if err != nil {
+			return err
+		}
+
+		for _, line := range req.Lines {
+			if _, err := getProductFields(ctx, tx, line.SKU); err != nil {
+				return fmt.Errorf("%s: %w", line.SKU, err)
+			}
+
+			query := `INSERT INTO order_lines (id, order_id, sku, quantity) VALUES ($1, $2, $3, $4)`
+			if _, err := tx.ExecContext(ctx, query, uuid.New().String(), orderID, line.SKU, line.Quantity); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d.GetOrder(ctx, orderID)
+}
+
+func (d *DB) GetOrder(ctx context.Context, id string) (*models.Order, error) {
+	return getOrder(ctx, d.conn, id, false)
+}
+
+// getOrder loads an order with its lines and pick steps, optionally locking
+// the order row so its status cannot change underneath the caller.
+func getOrder(ctx context.Context, q querier, id string, forUpdate bool) (*models.Order, error) {
+	query := `SELECT id, reference, status, created_by, created_at, updated_at FROM orders WHERE id = $1`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+
+	order := &models.Order{}
+	var createdBy sql.NullString
+	err := q.QueryRowContext(ctx, query, id).Scan(&order.ID, &order.Reference, &order.Status, &createdBy,
+		&order.CreatedAt, &order.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("order not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	order.CreatedBy = createdBy.String
+
+	if order.Lines, err = getOrderLines(ctx, q, id); err != nil {
+		return nil, err
+	}
+	if order.Steps, err = getPickSteps(ctx, q, id); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func getOrderLines(ctx context.Context, q querier, orderID string) ([]models.OrderLine, error) {
+	query := `
+		SELECT id, sku, quantity, picked_quantity
+		FROM order_lines
+		WHERE order_id = $1
+		ORDER BY created_at, id
+	`
+
+	rows, err := q.QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := []models.OrderLine{}
+	for rows.Next() {
+		var line models.OrderLine
+		if err := rows.Scan(&line.ID, &line.SKU, &line.Quantity, &line.PickedQuantity); err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, rows.Err()
+}
+
+func getPickSteps(ctx context.Context, q querier, orderID string) ([]models.PickStep, error) {
+	query := `
+		SELECT ps.id, ps.sequence, ps.line_id, ps.shelf_id, s.name, s.row_index, s.col_index,
+		       ps.sku, ps.quantity, ps.reservation_id, ps.status, ps.picked_at
+		FROM pick_steps ps
+		JOIN shelfs s ON s.id = ps.shelf_id
+		WHERE ps.order_id = $1
+		ORDER BY ps.sequence
+	`
+
+	rows, err := q.QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var steps []models.PickStep
+	for rows.Next() {
+		var step models.PickStep
+		var pickedAt sql.NullTime
+		err := rows.Scan(&step.ID, &step.Sequence, &step.LineID, &step.ShelfID, &step.ShelfName, &step.RowIndex,
+			&step.ColIndex, &step.SKU, &step.Quantity, &step.ReservationID, &step.Status, &pickedAt)
+		if err != nil {
+			return nil, err
+		}
+		step.PickedAt = timePtr(pickedAt)
+		steps = append(steps, step)
+	}
+
+	return steps, rows.Err()
+}
+
+// OrderList is what order lists can be sorted and filtered by.
+var OrderList = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"id":         {Column: "id", Type: listquery.UUID},
+		"reference":  {Column: "reference", Type: listquery.String},
+		"status":     {Column: "status", Type: listquery.String},
+		"created_at": {Column: "created_at", Type: listquery.Time},
+		"updated_at": {Column: "updated_at", Type: listquery.Time},
+	},
+	Sort: []listquery.Sort{{Field: "created_at", Desc: true}},
+	Key:  "id",
+}
+
+func (d *DB) ListOrders(ctx context.Context, status models.OrderStatus, lq *listquery.Query) ([]models.Order, *listquery.Page, error) {
+	var conditions []string
+	var args []interface{}
+	if status != "" {
+		args = append(args, string(status))
+		conditions = append(conditions, "status = $1")
+	}
+
+	if lq == nil {
+		lq = listquery.All(OrderList)
+	}
+
+	var ids []string
+	page, err := queryPage(ctx, d.conn, lq, "id", "orders", conditions, args, func(row rowScanner) error {
+		var id string
+		if err := row.Scan(&id); err != nil {
+			return err
+		}
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var orders []models.Order
+	for _, id := range ids {
+		item, err := d.GetOrder(ctx, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		orders = append(orders, *item)
+	}
+
+	return orders, page, nil
+}
+
+// shelfAllocation is the stock of one SKU on one shelf that is free to be
+// allocated to a pick.
+type shelfAllocation struct {
+	shelfID   string
+	available int
+}
+
+// CreatePicklist allocates stock for every line of an open order and turns
+// it into pick steps. Each step holds its units with a confirmed reservation
+// on the shelf, so the stock stays put until the step is picked.
+func (d *DB) CreatePicklist(ctx context.Context, orderID string) (*models.Order, error) {
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		order, err := getOrder(ctx, tx, orderID, true)
+		if err != nil {
+			return err
+		}
+		if order.Status != models.OrderOpen {
+			return fmt.Errorf("cannot create a pick list for an order that is %s", order.Status)
+		}
+
+		skus := make([]string, len(order.Lines))
+		for i, line := range order.Lines {
+			skus[i] = line.SKU
+		}
+		// Products are locked for update, like reservations, so no other
+		// allocation can claim the same units
+		if err := lockProducts(ctx, tx, skus, true); err != nil {
+			return err
+		}
+
+		stepQuery := `
+			INSERT INTO pick_steps (id, order_id, line_id, shelf_id, sku, quantity, reservation_id, status)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`
+		for _, line := range order.Lines {
+			onHand, reserved, err := stockLevels(ctx, tx, line.SKU, "")
+			if err != nil {
+				return err
+			}
+			if onHand-reserved < line.Quantity {
+				return fmt.Errorf("insufficient available stock for %s: %d available", line.SKU, onHand-reserved)
+			}
+
+			shelves, err := allocatableShelves(ctx, tx, line.SKU)
+			if err != nil {
+				return err
+			}
+
+			remaining := line.Quantity
+			for _, shelf := range shelves {
+				if remaining == 0 {
+					break
+				}
+
+				take := shelf.available
+				if take > remaining {
+					take = remaining
+				}
+
+				reservation := &models.Reservation{
+					SKU:       line.SKU,
+					ShelfID:   shelf.shelfID,
+					Quantity:  take,
+					Status:    models.ReservationConfirmed,
+					Reference: "order:" + order.ID,
+				}
+				if err := insertReservation(ctx, tx, reservation); err != nil {
+					return err
+				}
+
+				_, err := tx.ExecContext(ctx, stepQuery, uuid.New().String(), order.ID, line.ID, shelf.shelfID, line.SKU,
+					take, reservation.ID, models.PickPending)
+				if err != nil {
+					return err
+				}
+				remaining -= take
+			}
+
+			if remaining > 0 {
+				return fmt.Errorf("insufficient available stock for %s on shelves: %d short", line.SKU, remaining)
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE orders SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`,
+			models.OrderAllocated, order.ID); err != nil {
+			return err
+		}
+
+		return sequencePickSteps(ctx, tx, order.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d.GetOrder(ctx, orderID)
+}
+
+// allocatableShelves lists the shelves holding unreserved units of sku, with
+// the soonest-expiring stock first so orders ship FEFO. Shelves frozen by an
+// open count are passed over, since nothing may be picked from them.
+func allocatableShelves(ctx context.Context, q querier, sku string) ([]shelfAllocation, error) {
+	query := `
+		SELECT si.shelf_id, SUM(si.quantity) - COALESCE((
+			SELECT SUM(r.quantity) FROM reservations r
+			WHERE r.shelf_id = si.shelf_id AND r.sku = si.sku AND ` + reservationHolds + `
+		), 0) AS available
+		FROM shelf_items si
+		JOIN shelfs s ON s.id = si.shelf_id
+		WHERE si.sku = $1 AND NOT ` + shelfFrozen + `
+		GROUP BY si.shelf_id, si.sku, s.row_index, s.col_index
+		ORDER BY MIN(si.expires_at) ASC NULLS LAST, s.row_index, s.col_index
+	`
+
+	rows, err := q.QueryContext(ctx, query, sku)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shelves []shelfAllocation
+	for rows.Next() {
+		var shelf shelfAllocation
+		if err := rows.Scan(&shelf.shelfID, &shelf.available); err != nil {
+			return nil, err
+		}
+		if shelf.available > 0 {
+			shelves = append(shelves, shelf)
+		}
+	}
+
+	return shelves, rows.Err()
+}
+
+// sequencePickSteps numbers the order's steps along the shortest walk found
+// between its shelves, starting and ending at the default depot. Steps on the
+// same shelf are numbered by SKU.
+func sequencePickSteps(ctx context.Context, q querier, orderID string) error {
+	steps, err := getPickSteps(ctx, q, orderID)
+	if err != nil {
+		return err
+	}
+
+	shelfIDs := make([]string, len(steps))
+	for i, step := range steps {
+		shelfIDs[i] = step.ShelfID
+	}
+	shelfIDs = uniqueStrings(shelfIDs)
+
+	route, err := routeShelves(ctx, q, shelfIDs, routing.Best, defaultDepot, defaultDepot)
+	if err != nil {
+		return err
+	}
+
+	visit := make(map[string]int, len(route.Stops))
+	for _, stop := range route.Stops {
+		visit[stop.ShelfID] = stop.Sequence
+	}
+	sort.SliceStable(steps, func(i, j int) bool {
+		if visit[steps[i].ShelfID] != visit[steps[j].ShelfID] {
+			return visit[steps[i].ShelfID] < visit[steps[j].ShelfID]
+		}
+		return steps[i].SKU < steps[j].SKU
+	})
+
+	for i, step := range steps {
+		if _, err := q.ExecContext(ctx, `UPDATE pick_steps SET sequence = $1 WHERE id = $2`, i+1, step.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ConfirmPicks records the given pick steps as picked, taking their units off
+// the shelves through the same path as manual removals and consuming the
+// reservations that held them.
+func (d *DB) ConfirmPicks(ctx context.Context, orderID string, req *models.ConfirmPicksRequest) (*models.Order, error) {
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		order, err := getOrder(ctx, tx, orderID, true)
+		if err != nil {
+			return err
+		}
+		if order.Status != models.OrderAllocated {
+			return fmt.Errorf("cannot confirm picks for an order that is %s", order.Status)
+		}
+
+		requested := make(map[string]bool, len(req.StepIDs))
+		for _, id := range req.StepIDs {
+			requested[id] = true
+		}
+
+		var steps []models.PickStep
+		pending := 0
+		for _, step := range order.Steps {
+			if step.Status != models.PickPending {
+				if requested[step.ID] {
+					return fmt.Errorf("pick step %d is already %s", step.Sequence, step.Status)
+				}
+				continue
+			}
+
+			pending++
+			if len(requested) == 0 || requested[step.ID] {
+				steps = append(steps, step)
+				delete(requested, step.ID)
+			}
+		}
+		for _, id := range req.StepIDs {
+			if requested[id] {
+				return fmt.Errorf("pick step %s not found on order", id)
+			}
+		}
+		if len(steps) == 0 {
+			return errors.New("no pending pick steps")
+		}
+
+		// Products, then shelves, in the standard lock order. Picked units
+		// leave the warehouse, so products are locked for update
+		skus := make([]string, len(steps))
+		shelfIDs := make([]string, len(steps))
+		for i, step := range steps {
+			skus[i] = step.SKU
+			shelfIDs[i] = step.ShelfID
+		}
+		if err := lockProducts(ctx, tx, skus, true); err != nil {
+			return err
+		}
+		if err := lockShelves(ctx, tx, shelfIDs...); err != nil {
+			return err
+		}
+
+		// Costs are locked per SKU as steps are picked, so pick in SKU order
+		sort.SliceStable(steps, func(i, j int) bool {
+			return steps[i].SKU < steps[j].SKU
+		})
+		for _, step := range steps {
+			// The reservation is consumed first so it no longer guards the
+			// units this step takes
+			result, err := tx.ExecContext(ctx, `
+				UPDATE reservations SET status = $1, updated_at = CURRENT_TIMESTAMP
+				WHERE id = $2 AND status = $3
+			`, models.ReservationFulfilled, step.ReservationID, models.ReservationConfirmed)
+			if err != nil {
+				return err
+			}
+			if n, err := result.RowsAffected(); err != nil {
+				return err
+			} else if n == 0 {
+				return fmt.Errorf("pick step %d is no longer reserved", step.Sequence)
+			}
+
+			pick := stockPick{shelfID: step.ShelfID, sku: step.SKU, quantity: step.Quantity}
+			if _, err := takeItemFromShelf(ctx, tx, pick, models.MovementPick); err != nil {
+				return fmt.Errorf("pick step %d: %w", step.Sequence, err)
+			}
+
+			_, err = tx.ExecContext(ctx, `UPDATE pick_steps SET status = $1, picked_at = CURRENT_TIMESTAMP WHERE id = $2`,
+				models.PickPicked, step.ID)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, `UPDATE order_lines SET picked_quantity = picked_quantity + $1 WHERE id = $2`,
+				step.Quantity, step.LineID)
+			if err != nil {
+				return err
+			}
+		}
+
+		status := models.OrderAllocated
+		if len(steps) == pending {
+			status = models.OrderPicked
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE orders SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`,
+			status, orderID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d.GetOrder(ctx, orderID)
+}
+
+// CancelOrder cancels an order that has not been fully picked, releasing the
+// stock held for its pending steps. Units already picked stay picked.
+func (d *DB) CancelOrder(ctx context.Context, orderID string) (*models.Order, error) {
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		order, err := getOrder(ctx, tx, orderID, true)
+		if err != nil {
+			return err
+		}
+		if order.Status != models.OrderOpen && order.Status != models.OrderAllocated {
+			return fmt.Errorf("cannot cancel an order that is %s", order.Status)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE reservations SET status = $1, updated_at = CURRENT_TIMESTAMP
+			WHERE id IN (SELECT reservation_id FROM pick_steps WHERE order_id = $2 AND status = $3)
+			  AND status IN ('active', 'confirmed')
+		`, models.ReservationReleased, orderID, models.PickPending)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE pick_steps SET status = $1 WHERE order_id = $2 AND status = $3`,
+			models.PickCancelled, orderID, models.PickPending)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE orders SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`,
+			models.OrderCancelled, orderID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d.GetOrder(ctx, orderID)
+}
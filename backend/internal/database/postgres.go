@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
@@ -10,6 +11,18 @@ import (
 
 type DB struct {
 	conn *sql.DB
+
+	// dsn is kept for connections that cannot come from the pool, such as
+	// the stock level listener.
+	dsn string
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx, so repository helpers
+// can run either standalone or as part of a larger transaction.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
 }
 
 func New(dsn string) (*DB, error) {
@@ -25,7 +38,7 @@ func New(dsn string) (*DB, error) {
 	db.SetMaxOpenConns(25)
 	db.SetMaxIdleConns(5)
 
-	return &DB{conn: db}, nil
+	return &DB{conn: db, dsn: dsn}, nil
 }
 
 func (d *DB) Close() error {
@@ -36,12 +49,47 @@ func (d *DB) GetConnection() *sql.DB {
 	return d.conn
 }
 
+// withTx runs fn inside a transaction, committing on success and rolling
+// back on any error.
+func (d *DB) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := d.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func (d *DB) RunMigrations() error {
 	migrations := []string{
 		createUsersTable,
 		createProductsTable,
 		createShelfsTable,
 		createShelfItemsTable,
+		createStockMovementsTable,
+		addShelfsMaxWeight,
+		addDimensions,
+		addShelfItemLots,
+		addShelfItemsUniqueLot,
+		addSerialNumbers,
+		createReservationsTable,
+		createOrdersTables,
+		createInboundTables,
+		createCountTables,
+		addStockLevels,
+		addCosting,
+		createProductUnitsTable,
+		createProductBarcodesTable,
+		createCategoriesTable,
+		addProductAttributes,
+		createProductMediaTable,
+		addProductSearch,
+		addArchiving,
 	}
 
 	for _, migration := range migrations {
@@ -108,4 +156,477 @@ const (
 		CREATE INDEX IF NOT EXISTS idx_shelf_items_shelf_id ON shelf_items(shelf_id);
 		CREATE INDEX IF NOT EXISTS idx_shelf_items_sku ON shelf_items(sku);
 	`
+
+	createStockMovementsTable = `
+		CREATE TABLE IF NOT EXISTS stock_movements (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			sku VARCHAR(50) NOT NULL,
+			shelf_id UUID NOT NULL,
+			quantity_delta INTEGER NOT NULL,
+			reason VARCHAR(50) NOT NULL,
+			user_id UUID,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			CONSTRAINT stock_movement_delta_nonzero CHECK (quantity_delta <> 0)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_stock_movements_sku ON stock_movements(sku);
+		CREATE INDEX IF NOT EXISTS idx_stock_movements_shelf_id ON stock_movements(shelf_id);
+		CREATE INDEX IF NOT EXISTS idx_stock_movements_user_id ON stock_movements(user_id);
+		CREATE INDEX IF NOT EXISTS idx_stock_movements_created_at ON stock_movements(created_at);
+
+		CREATE OR REPLACE FUNCTION stock_movements_append_only() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'stock_movements is append-only';
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER IF EXISTS trg_stock_movements_append_only ON stock_movements;
+		CREATE TRIGGER trg_stock_movements_append_only
+			BEFORE UPDATE OR DELETE ON stock_movements
+			FOR EACH ROW EXECUTE FUNCTION stock_movements_append_only();
+	`
+
+	// A max_weight of 0 means the shelf has no weight limit.
+	addShelfsMaxWeight = `
+		ALTER TABLE shelfs ADD COLUMN IF NOT EXISTS max_weight DECIMAL(10, 2) NOT NULL DEFAULT 0;
+	`
+
+	// Dimensions of 0 mean unknown, in which case capacity falls back to the
+	// scalar volume check.
+	addDimensions = `
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS length DECIMAL(10, 2) NOT NULL DEFAULT 0;
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS width DECIMAL(10, 2) NOT NULL DEFAULT 0;
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS height DECIMAL(10, 2) NOT NULL DEFAULT 0;
+
+		ALTER TABLE shelfs ADD COLUMN IF NOT EXISTS length DECIMAL(10, 2) NOT NULL DEFAULT 0;
+		ALTER TABLE shelfs ADD COLUMN IF NOT EXISTS width DECIMAL(10, 2) NOT NULL DEFAULT 0;
+		ALTER TABLE shelfs ADD COLUMN IF NOT EXISTS height DECIMAL(10, 2) NOT NULL DEFAULT 0;
+	`
+
+	// Lots without a number share the empty lot, so stock added before lot
+	// tracking keeps merging as it did. Replaces the per-SKU unique index
+	// with the per-lot one below.
+	addShelfItemLots = `
+		ALTER TABLE shelf_items ADD COLUMN IF NOT EXISTS lot_number VARCHAR(100) NOT NULL DEFAULT '';
+		ALTER TABLE shelf_items ADD COLUMN IF NOT EXISTS manufactured_at DATE;
+		ALTER TABLE shelf_items ADD COLUMN IF NOT EXISTS expires_at DATE;
+
+		DROP INDEX IF EXISTS uq_shelf_items_shelf_sku;
+		CREATE INDEX IF NOT EXISTS idx_shelf_items_expires_at ON shelf_items(expires_at) WHERE expires_at IS NOT NULL;
+
+		ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS lot_number VARCHAR(100) NOT NULL DEFAULT '';
+	`
+
+	// Merges any duplicate rows left over from before the constraint existed,
+	// then enforces one row per SKU and lot per shelf.
+	addShelfItemsUniqueLot = `
+		WITH duplicates AS (
+			SELECT shelf_id, sku, lot_number, SUM(quantity) AS total, (array_agg(id ORDER BY created_at, id))[1] AS keep_id
+			FROM shelf_items
+			GROUP BY shelf_id, sku, lot_number
+			HAVING COUNT(*) > 1
+		), merged AS (
+			UPDATE shelf_items si
+			SET quantity = d.total
+			FROM duplicates d
+			WHERE si.id = d.keep_id
+		)
+		DELETE FROM shelf_items si
+		USING duplicates d
+		WHERE si.shelf_id = d.shelf_id AND si.sku = d.sku AND si.lot_number = d.lot_number AND si.id <> d.keep_id;
+
+		CREATE UNIQUE INDEX IF NOT EXISTS uq_shelf_items_shelf_sku_lot ON shelf_items(shelf_id, sku, lot_number);
+	`
+	// A serial with no shelf_item_id has left the warehouse; it may be
+	// received again later.
+	addSerialNumbers = `
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS serialized BOOLEAN NOT NULL DEFAULT FALSE;
+
+		CREATE TABLE IF NOT EXISTS serial_numbers (
+			serial_number VARCHAR(100) PRIMARY KEY,
+			sku VARCHAR(50) NOT NULL REFERENCES products(sku) ON DELETE RESTRICT,
+			shelf_item_id UUID REFERENCES shelf_items(id) ON DELETE SET NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_serial_numbers_shelf_item_id ON serial_numbers(shelf_item_id);
+
+		CREATE TABLE IF NOT EXISTS stock_movement_serials (
+			movement_id UUID NOT NULL,
+			serial_number VARCHAR(100) NOT NULL,
+			PRIMARY KEY (movement_id, serial_number)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_stock_movement_serials_serial ON stock_movement_serials(serial_number);
+	`
+	// Reservations without a shelf_id hold stock anywhere in the warehouse.
+	createReservationsTable = `
+		CREATE TABLE IF NOT EXISTS reservations (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			sku VARCHAR(50) NOT NULL REFERENCES products(sku) ON DELETE RESTRICT,
+			shelf_id UUID REFERENCES shelfs(id) ON DELETE CASCADE,
+			quantity INTEGER NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'active',
+			reference VARCHAR(100) NOT NULL DEFAULT '',
+			expires_at TIMESTAMP,
+			created_by UUID,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			CONSTRAINT reservation_quantity_positive CHECK (quantity > 0)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_reservations_sku ON reservations(sku);
+		CREATE INDEX IF NOT EXISTS idx_reservations_shelf_id ON reservations(shelf_id);
+		CREATE INDEX IF NOT EXISTS idx_reservations_status ON reservations(status);
+	`
+	// Each pick step holds its units through a confirmed reservation on the
+	// step's shelf until it is picked.
+	createOrdersTables = `
+		CREATE TABLE IF NOT EXISTS orders (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			reference VARCHAR(100) NOT NULL DEFAULT '',
+			status VARCHAR(20) NOT NULL DEFAULT 'open',
+			created_by UUID,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS order_lines (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+			sku VARCHAR(50) NOT NULL REFERENCES products(sku) ON DELETE RESTRICT,
+			quantity INTEGER NOT NULL,
+			picked_quantity INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			CONSTRAINT order_line_quantity_positive CHECK (quantity > 0)
+		);
+
+		CREATE TABLE IF NOT EXISTS pick_steps (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+			line_id UUID NOT NULL REFERENCES order_lines(id) ON DELETE CASCADE,
+			sequence INTEGER NOT NULL DEFAULT 0,
+			shelf_id UUID NOT NULL REFERENCES shelfs(id) ON DELETE CASCADE,
+			sku VARCHAR(50) NOT NULL REFERENCES products(sku) ON DELETE RESTRICT,
+			quantity INTEGER NOT NULL,
+			reservation_id UUID NOT NULL REFERENCES reservations(id) ON DELETE CASCADE,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			picked_at TIMESTAMP,
+			CONSTRAINT pick_step_quantity_positive CHECK (quantity > 0)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_orders_status ON orders(status);
+		CREATE INDEX IF NOT EXISTS idx_order_lines_order_id ON order_lines(order_id);
+		CREATE INDEX IF NOT EXISTS idx_pick_steps_order_id ON pick_steps(order_id);
+	`
+	// Received units wait in staged_items, off any shelf, until putaway.
+	createInboundTables = `
+		CREATE TABLE IF NOT EXISTS inbound_documents (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			type VARCHAR(10) NOT NULL,
+			reference VARCHAR(100) NOT NULL,
+			supplier VARCHAR(255) NOT NULL DEFAULT '',
+			status VARCHAR(20) NOT NULL DEFAULT 'open',
+			expected_at TIMESTAMP,
+			created_by UUID,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			closed_at TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS inbound_lines (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			document_id UUID NOT NULL REFERENCES inbound_documents(id) ON DELETE CASCADE,
+			sku VARCHAR(50) NOT NULL REFERENCES products(sku) ON DELETE RESTRICT,
+			expected_quantity INTEGER NOT NULL,
+			received_quantity INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			CONSTRAINT inbound_line_expected_positive CHECK (expected_quantity > 0),
+			UNIQUE (document_id, sku)
+		);
+
+		CREATE TABLE IF NOT EXISTS staged_items (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			document_id UUID NOT NULL REFERENCES inbound_documents(id) ON DELETE RESTRICT,
+			line_id UUID NOT NULL REFERENCES inbound_lines(id) ON DELETE RESTRICT,
+			sku VARCHAR(50) NOT NULL REFERENCES products(sku) ON DELETE RESTRICT,
+			quantity INTEGER NOT NULL,
+			lot_number VARCHAR(100) NOT NULL DEFAULT '',
+			manufactured_at DATE,
+			expires_at DATE,
+			serial_numbers TEXT[] NOT NULL DEFAULT '{}',
+			received_by UUID,
+			received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			CONSTRAINT staged_quantity_positive CHECK (quantity > 0)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_inbound_documents_status ON inbound_documents(status);
+		CREATE INDEX IF NOT EXISTS idx_inbound_lines_document_id ON inbound_lines(document_id);
+		CREATE INDEX IF NOT EXISTS idx_staged_items_document_id ON staged_items(document_id);
+	`
+	// count_lines snapshot shelf_items when a session opens; counted_quantity
+	// stays NULL until the line is counted. Adjustments posted on approval
+	// record the session's reason code in the ledger.
+	createCountTables = `
+		CREATE TABLE IF NOT EXISTS count_sessions (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			reference VARCHAR(100) NOT NULL DEFAULT '',
+			status VARCHAR(20) NOT NULL DEFAULT 'open',
+			freeze BOOLEAN NOT NULL DEFAULT FALSE,
+			reason_code VARCHAR(50) NOT NULL DEFAULT '',
+			created_by UUID,
+			approved_by UUID,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			closed_at TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS count_session_shelves (
+			session_id UUID NOT NULL REFERENCES count_sessions(id) ON DELETE CASCADE,
+			shelf_id UUID NOT NULL REFERENCES shelfs(id) ON DELETE CASCADE,
+			PRIMARY KEY (session_id, shelf_id)
+		);
+
+		CREATE TABLE IF NOT EXISTS count_lines (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			session_id UUID NOT NULL REFERENCES count_sessions(id) ON DELETE CASCADE,
+			shelf_id UUID NOT NULL REFERENCES shelfs(id) ON DELETE CASCADE,
+			sku VARCHAR(50) NOT NULL REFERENCES products(sku) ON DELETE CASCADE,
+			lot_number VARCHAR(100) NOT NULL DEFAULT '',
+			expected_quantity INTEGER NOT NULL,
+			counted_quantity INTEGER,
+			serial_numbers TEXT[] NOT NULL DEFAULT '{}',
+			counted_by UUID,
+			counted_at TIMESTAMP,
+			CONSTRAINT count_line_counted_nonnegative CHECK (counted_quantity >= 0),
+			UNIQUE (session_id, shelf_id, sku, lot_number)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_count_sessions_status ON count_sessions(status);
+		CREATE INDEX IF NOT EXISTS idx_count_session_shelves_shelf_id ON count_session_shelves(shelf_id);
+
+		ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS reason_code VARCHAR(50) NOT NULL DEFAULT '';
+	`
+	// Ledger inserts and level changes notify the stock level checker on
+	// commit; stock_alerts keeps at most one open alert per SKU and kind.
+	addStockLevels = `
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS min_stock INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS reorder_point INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS max_stock INTEGER NOT NULL DEFAULT 0;
+
+		CREATE TABLE IF NOT EXISTS stock_alerts (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			sku VARCHAR(50) NOT NULL REFERENCES products(sku) ON DELETE CASCADE,
+			kind VARCHAR(20) NOT NULL,
+			on_hand INTEGER NOT NULL,
+			threshold INTEGER NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			resolved_at TIMESTAMP
+		);
+
+		CREATE UNIQUE INDEX IF NOT EXISTS uq_stock_alerts_open ON stock_alerts(sku, kind) WHERE resolved_at IS NULL;
+
+		CREATE OR REPLACE FUNCTION notify_stock_level() RETURNS trigger AS $$
+		BEGIN
+			PERFORM pg_notify('stock_levels', NEW.sku);
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER IF EXISTS trg_stock_movements_notify ON stock_movements;
+		CREATE TRIGGER trg_stock_movements_notify
+			AFTER INSERT ON stock_movements
+			FOR EACH ROW EXECUTE FUNCTION notify_stock_level();
+
+		DROP TRIGGER IF EXISTS trg_products_levels_notify ON products;
+		CREATE TRIGGER trg_products_levels_notify
+			AFTER UPDATE OF min_stock, reorder_point, max_stock ON products
+			FOR EACH ROW EXECUTE FUNCTION notify_stock_level();
+	`
+	// product_costs holds each SKU's moving average over the units it has
+	// costed; cost_layers holds what is left of each receipt for FIFO. Stock
+	// that predates costing opens at zero cost.
+	addCosting = `
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS costing_method VARCHAR(10) NOT NULL DEFAULT 'average';
+		ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS unit_cost DECIMAL(14, 4) NOT NULL DEFAULT 0;
+		ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS total_cost DECIMAL(16, 4) NOT NULL DEFAULT 0;
+		ALTER TABLE inbound_lines ADD COLUMN IF NOT EXISTS unit_cost DECIMAL(14, 4) NOT NULL DEFAULT 0;
+		ALTER TABLE staged_items ADD COLUMN IF NOT EXISTS unit_cost DECIMAL(14, 4) NOT NULL DEFAULT 0;
+
+		CREATE TABLE IF NOT EXISTS product_costs (
+			sku VARCHAR(50) PRIMARY KEY REFERENCES products(sku) ON DELETE CASCADE,
+			average_cost DECIMAL(14, 4) NOT NULL DEFAULT 0,
+			quantity INTEGER NOT NULL DEFAULT 0
+		);
+
+		CREATE TABLE IF NOT EXISTS cost_layers (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			sku VARCHAR(50) NOT NULL REFERENCES products(sku) ON DELETE CASCADE,
+			movement_id UUID,
+			quantity INTEGER NOT NULL,
+			remaining INTEGER NOT NULL,
+			unit_cost DECIMAL(14, 4) NOT NULL,
+			created_at TIMESTAMP DEFAULT clock_timestamp(),
+			CONSTRAINT cost_layer_remaining_valid CHECK (remaining >= 0 AND remaining <= quantity)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_cost_layers_open ON cost_layers(sku, created_at) WHERE remaining > 0;
+
+		INSERT INTO product_costs (sku, quantity)
+		SELECT sku, SUM(quantity) FROM shelf_items GROUP BY sku
+		ON CONFLICT DO NOTHING;
+
+		INSERT INTO cost_layers (sku, quantity, remaining, unit_cost)
+		SELECT si.sku, SUM(si.quantity), SUM(si.quantity), 0
+		FROM shelf_items si
+		WHERE NOT EXISTS (SELECT 1 FROM cost_layers cl WHERE cl.sku = si.sku)
+		GROUP BY si.sku;
+	`
+	// Pack levels above the base unit. A volume or weight of 0 means the
+	// level is reported as factor times the product's own figure.
+	createProductUnitsTable = `
+		CREATE TABLE IF NOT EXISTS product_units (
+			sku VARCHAR(50) NOT NULL REFERENCES products(sku) ON DELETE CASCADE,
+			unit VARCHAR(20) NOT NULL,
+			factor INTEGER NOT NULL,
+			volume DECIMAL(10, 2) NOT NULL DEFAULT 0,
+			weight DECIMAL(10, 2) NOT NULL DEFAULT 0,
+			PRIMARY KEY (sku, unit),
+			CONSTRAINT product_unit_factor_valid CHECK (factor > 1)
+		);
+	`
+	// gtin holds GTIN barcodes in their 14-digit form, so the same item
+	// printed as UPC-A and EAN-13 is recognised as one code.
+	createProductBarcodesTable = `
+		CREATE TABLE IF NOT EXISTS product_barcodes (
+			code VARCHAR(80) PRIMARY KEY,
+			sku VARCHAR(50) NOT NULL REFERENCES products(sku) ON DELETE CASCADE,
+			type VARCHAR(10) NOT NULL,
+			gtin VARCHAR(14) UNIQUE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_product_barcodes_sku ON product_barcodes(sku);
+	`
+	// Sibling categories cannot share a name; roots count as siblings of
+	// each other. Products whose category is deleted are reassigned by
+	// DeleteCategory before the row goes.
+	createCategoriesTable = `
+		CREATE TABLE IF NOT EXISTS categories (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			name VARCHAR(100) NOT NULL,
+			parent_id UUID REFERENCES categories(id) ON DELETE RESTRICT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE UNIQUE INDEX IF NOT EXISTS uq_categories_sibling_name
+			ON categories(COALESCE(parent_id, '00000000-0000-0000-0000-000000000000'::uuid), lower(name));
+		CREATE INDEX IF NOT EXISTS idx_categories_parent_id ON categories(parent_id);
+
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS category_id UUID REFERENCES categories(id) ON DELETE SET NULL;
+		CREATE INDEX IF NOT EXISTS idx_products_category_id ON products(category_id);
+	`
+	// Attribute values live on the product as JSONB; category_attributes
+	// holds the schema each category adds for itself and its descendants.
+	addProductAttributes = `
+		CREATE TABLE IF NOT EXISTS category_attributes (
+			category_id UUID NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+			name VARCHAR(50) NOT NULL,
+			type VARCHAR(10) NOT NULL,
+			required BOOLEAN NOT NULL DEFAULT FALSE,
+			enum_values TEXT[] NOT NULL DEFAULT '{}',
+			unit VARCHAR(20) NOT NULL DEFAULT '',
+			PRIMARY KEY (category_id, name)
+		);
+
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS attributes JSONB NOT NULL DEFAULT '{}';
+		CREATE INDEX IF NOT EXISTS idx_products_attributes ON products USING GIN (attributes);
+	`
+	// The files themselves are kept by the storage driver; rows hold their
+	// keys and the URLs clients fetch them from.
+	createProductMediaTable = `
+		CREATE TABLE IF NOT EXISTS product_media (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			sku VARCHAR(50) NOT NULL REFERENCES products(sku) ON DELETE CASCADE,
+			kind VARCHAR(10) NOT NULL,
+			filename VARCHAR(255) NOT NULL,
+			content_type VARCHAR(100) NOT NULL,
+			size BIGINT NOT NULL,
+			storage_key TEXT NOT NULL,
+			thumbnail_key TEXT NOT NULL DEFAULT '',
+			url TEXT NOT NULL,
+			thumbnail_url TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_product_media_sku ON product_media(sku);
+	`
+	// search_text gathers what a product can be found by: SKU, name,
+	// barcodes and attribute values. Triggers keep it current, and it is
+	// indexed both for full-text search and for trigram similarity, which
+	// catches misspellings.
+	addProductSearch = `
+		CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS search_text TEXT NOT NULL DEFAULT '';
+
+		CREATE OR REPLACE FUNCTION product_search_text(p_sku TEXT, p_name TEXT, p_attributes JSONB) RETURNS TEXT AS $$
+			SELECT concat_ws(' ', p_sku, p_name,
+				(SELECT string_agg(b.code, ' ' ORDER BY b.created_at) FROM product_barcodes b WHERE b.sku = p_sku),
+				(SELECT string_agg(v #>> '{}', ' ') FROM jsonb_path_query(p_attributes, 'lax $.*[*]') v))
+		$$ LANGUAGE sql STABLE;
+
+		CREATE OR REPLACE FUNCTION products_search_text() RETURNS trigger AS $$
+		BEGIN
+			NEW.search_text := product_search_text(NEW.sku, NEW.name, NEW.attributes);
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER IF EXISTS trg_products_search_text ON products;
+		CREATE TRIGGER trg_products_search_text
+			BEFORE INSERT OR UPDATE OF sku, name, attributes ON products
+			FOR EACH ROW EXECUTE FUNCTION products_search_text();
+
+		CREATE OR REPLACE FUNCTION product_barcodes_search_text() RETURNS trigger AS $$
+		BEGIN
+			IF TG_OP <> 'DELETE' THEN
+				UPDATE products SET search_text = product_search_text(sku, name, attributes) WHERE sku = NEW.sku;
+			END IF;
+			IF TG_OP <> 'INSERT' THEN
+				UPDATE products SET search_text = product_search_text(sku, name, attributes) WHERE sku = OLD.sku;
+			END IF;
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER IF EXISTS trg_product_barcodes_search_text ON product_barcodes;
+		CREATE TRIGGER trg_product_barcodes_search_text
+			AFTER INSERT OR UPDATE OR DELETE ON product_barcodes
+			FOR EACH ROW EXECUTE FUNCTION product_barcodes_search_text();
+
+		UPDATE products SET search_text = product_search_text(sku, name, attributes) WHERE search_text = '';
+
+		CREATE INDEX IF NOT EXISTS idx_products_search_fts ON products USING GIN (to_tsvector('simple', search_text));
+		CREATE INDEX IF NOT EXISTS idx_products_search_trgm ON products USING GIN (search_text gin_trgm_ops);
+	`
+	// Products and shelves are archived rather than deleted, so their
+	// history stays intact. Shelf items no longer cascade with their shelf:
+	// stock must never disappear along with a shelf row.
+	addArchiving = `
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP;
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS archived_by UUID;
+		ALTER TABLE shelfs ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP;
+		ALTER TABLE shelfs ADD COLUMN IF NOT EXISTS archived_by UUID;
+
+		DO $$
+		BEGIN
+			IF EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'shelf_items_shelf_id_fkey' AND confdeltype = 'c') THEN
+				ALTER TABLE shelf_items DROP CONSTRAINT shelf_items_shelf_id_fkey;
+				ALTER TABLE shelf_items ADD CONSTRAINT shelf_items_shelf_id_fkey
+					FOREIGN KEY (shelf_id) REFERENCES shelfs(id) ON DELETE RESTRICT;
+			END IF;
+		END $$;
+	`
 )
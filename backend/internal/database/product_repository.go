@@ -3,22 +3,103 @@ package database
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
+	"sort"
 
+	"github.com/aslam/backend/internal/listquery"
 	"github.com/aslam/backend/internal/models"
+	"github.com/lib/pq"
 )
 
+// productFields lists the products table's own columns in the order
+// scanProductFields expects. Locks and internal lookups read only these.
+const productFields = `sku, name, volume, weight, length, width, height, serialized, category_id, attributes, min_stock, reorder_point, max_stock, costing_method,
+	archived_at, archived_by, created_at, updated_at`
+
+// productColumns adds the product's total on-hand quantity across all
+// shelves, its barcodes and its media to productFields, in the order
+// scanProduct expects. The subqueries are only worth running for responses.
+const productColumns = productFields + `,
+	COALESCE((SELECT SUM(si.quantity) FROM shelf_items si WHERE si.sku = products.sku), 0),
+	ARRAY(SELECT b.code FROM product_barcodes b WHERE b.sku = products.sku ORDER BY b.created_at),
+	(SELECT ` + mediaJSON + ` FROM product_media m WHERE m.sku = products.sku)`
+
+func scanProduct(row rowScanner, product *models.Product) error {
+	var media []byte
+	err := scanProductFields(withExtra{row, []interface{}{&product.OnHand, pq.Array(&product.Barcodes), &media}}, product)
+	if err != nil {
+		return err
+	}
+
+	product.Media = nil
+	return json.Unmarshal(media, &product.Media)
+}
+
+func scanProductFields(row rowScanner, product *models.Product) error {
+	var categoryID, archivedBy sql.NullString
+	var archivedAt sql.NullTime
+	var attributes []byte
+	err := row.Scan(&product.SKU, &product.Name, &product.Volume, &product.Weight, &product.Length, &product.Width, &product.Height, &product.Serialized,
+		&categoryID, &attributes, &product.MinStock, &product.ReorderPoint, &product.MaxStock, &product.CostingMethod,
+		&archivedAt, &archivedBy, &product.CreatedAt, &product.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	product.CategoryID = nil
+	if categoryID.Valid {
+		product.CategoryID = &categoryID.String
+	}
+	product.ArchivedAt = timePtr(archivedAt)
+	product.ArchivedBy = nil
+	if archivedBy.Valid {
+		product.ArchivedBy = &archivedBy.String
+	}
+	product.Attributes = nil
+	return json.Unmarshal(attributes, &product.Attributes)
+}
+
+// validateStockLevels checks that the levels that are set run minimum, then
+// reorder point, then maximum.
+func validateStockLevels(minStock, reorderPoint, maxStock int) error {
+	if minStock > 0 && reorderPoint > 0 && reorderPoint < minStock {
+		return errors.New("reorder point cannot be below the minimum stock level")
+	}
+	if maxStock > 0 && (maxStock < minStock || maxStock < reorderPoint) {
+		return errors.New("maximum stock level cannot be below the minimum or reorder point")
+	}
+	return nil
+}
+
 func (d *DB) CreateProduct(ctx context.Context, req *models.CreateProductRequest) (*models.Product, error) {
+	if err := validateStockLevels(req.MinStock, req.ReorderPoint, req.MaxStock); err != nil {
+		return nil, err
+	}
+	if err := checkCategory(ctx, d.conn, req.CategoryID); err != nil {
+		return nil, err
+	}
+	if err := validateAttributes(ctx, d.conn, req.CategoryID, req.Attributes); err != nil {
+		return nil, err
+	}
+
+	attributes, err := marshalAttributes(req.Attributes)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
-		INSERT INTO products (sku, name, volume, weight)
-		VALUES ($1, $2, $3, $4)
-		RETURNING sku, name, volume, weight, created_at, updated_at
-	`
+		INSERT INTO products (sku, name, volume, weight, length, width, height, serialized, min_stock, reorder_point, max_stock,
+			costing_method, category_id, attributes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, COALESCE(NULLIF($12, ''), 'average'), NULLIF($13, '')::uuid,
+			COALESCE($14::jsonb, '{}'))
+		RETURNING ` + productColumns
 
 	product := &models.Product{}
-	err := d.conn.QueryRowContext(ctx, query, req.SKU, req.Name, req.Volume, req.Weight).
-		Scan(&product.SKU, &product.Name, &product.Volume, &product.Weight, &product.CreatedAt, &product.UpdatedAt)
-
+	err = scanProduct(d.conn.QueryRowContext(ctx, query, req.SKU, req.Name, req.Volume, req.Weight, req.Length, req.Width, req.Height, req.Serialized,
+		req.MinStock, req.ReorderPoint, req.MaxStock, string(req.CostingMethod), req.CategoryID, attributes), product)
 	if err != nil {
 		if err.Error() == "pq: duplicate key value violates unique constraint \"products_pkey\"" {
 			return nil, errors.New("product with this SKU already exists")
@@ -30,16 +111,73 @@ func (d *DB) CreateProduct(ctx context.Context, req *models.CreateProductRequest
 }
 
 func (d *DB) GetProductBySKU(ctx context.Context, sku string) (*models.Product, error) {
-	query := `
-		SELECT sku, name, volume, weight, created_at, updated_at
-		FROM products
-		WHERE sku = $1
-	`
+	return getProductBySKU(ctx, d.conn, sku)
+}
 
-	product := &models.Product{}
-	err := d.conn.QueryRowContext(ctx, query, sku).
-		Scan(&product.SKU, &product.Name, &product.Volume, &product.Weight, &product.CreatedAt, &product.UpdatedAt)
+func getProductBySKU(ctx context.Context, q querier, sku string) (*models.Product, error) {
+	return queryProduct(ctx, q, scanProduct, `SELECT `+productColumns+` FROM products WHERE sku = $1`, sku)
+}
+
+// getProductFields reads a product without its on-hand total, barcodes or
+// media, for lookups that only need the product itself.
+func getProductFields(ctx context.Context, q querier, sku string) (*models.Product, error) {
+	return queryProduct(ctx, q, scanProductFields, `SELECT `+productFields+` FROM products WHERE sku = $1`, sku)
+}
+
+// lockProduct reads a product while locking its row: exclusively when the
+// caller is about to change it or take its stock off a shelf, shared when the
+// caller only depends on its dimensions staying put until commit.
+func lockProduct(ctx context.Context, q querier, sku string, forUpdate bool) (*models.Product, error) {
+	query := `SELECT ` + productFields + ` FROM products WHERE sku = $1`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	} else {
+		query += ` FOR SHARE`
+	}
+
+	return queryProduct(ctx, q, scanProductFields, query, sku)
+}
+
+// lockProducts locks the products of the given SKUs in sorted order, so
+// mutations touching several products cannot deadlock.
+func lockProducts(ctx context.Context, q querier, skus []string, forUpdate bool) error {
+	sorted := uniqueStrings(skus)
+	sort.Strings(sorted)
+
+	for _, sku := range sorted {
+		if _, err := lockProduct(ctx, q, sku, forUpdate); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// marshalAttributes encodes attribute values for the JSONB column. Nil
+// stays NULL, so updates can tell "unchanged" from "cleared".
+func marshalAttributes(values map[string]interface{}) (sql.NullString, error) {
+	if values == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(values)
+	return sql.NullString{String: string(data), Valid: true}, err
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var unique []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
 
+func queryProduct(ctx context.Context, q querier, scan func(rowScanner, *models.Product) error, query string, args ...interface{}) (*models.Product, error) {
+	product := &models.Product{}
+	err := scan(q.QueryRowContext(ctx, query, args...), product)
 	if err == sql.ErrNoRows {
 		return nil, errors.New("product not found")
 	}
@@ -50,30 +188,67 @@ func (d *DB) GetProductBySKU(ctx context.Context, sku string) (*models.Product,
 	return product, nil
 }
 
-func (d *DB) ListProducts(ctx context.Context) ([]models.Product, error) {
-	query := `
-		SELECT sku, name, volume, weight, created_at, updated_at
-		FROM products
-		ORDER BY name ASC
-	`
+// ProductList is what product lists can be sorted and filtered by.
+var ProductList = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"sku":            {Column: "sku", Type: listquery.String},
+		"name":           {Column: "name", Type: listquery.String},
+		"volume":         {Column: "volume", Type: listquery.Number},
+		"weight":         {Column: "weight", Type: listquery.Number},
+		"serialized":     {Column: "serialized", Type: listquery.Bool},
+		"min_stock":      {Column: "min_stock", Type: listquery.Int},
+		"reorder_point":  {Column: "reorder_point", Type: listquery.Int},
+		"max_stock":      {Column: "max_stock", Type: listquery.Int},
+		"on_hand":        {Column: "COALESCE((SELECT SUM(si.quantity) FROM shelf_items si WHERE si.sku = products.sku), 0)", Type: listquery.Int},
+		"costing_method": {Column: "costing_method", Type: listquery.String},
+		"created_at":     {Column: "created_at", Type: listquery.Time},
+		"updated_at":     {Column: "updated_at", Type: listquery.Time},
+	},
+	Sort: []listquery.Sort{{Field: "name"}},
+	Key:  "sku",
+}
 
-	rows, err := d.conn.QueryContext(ctx, query)
-	if err != nil {
-		return nil, err
+func (d *DB) ListProducts(ctx context.Context, filter *models.ProductFilter, lq *listquery.Query) ([]models.Product, *listquery.Page, error) {
+	conditions := []string{`archived_at IS NULL`}
+	if filter.Archived {
+		conditions[0] = `archived_at IS NOT NULL`
+	}
+	var args []interface{}
+
+	if filter.Category != "" {
+		args = append(args, filter.Category)
+		conditions = append(conditions, `category_id IN (`+categorySubtree(len(args))+`)`)
+	}
+
+	// Sorted so the same filter always builds the same query
+	names := make([]string, 0, len(filter.Attributes))
+	for name := range filter.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, name, filter.Attributes[name])
+		conditions = append(conditions, fmt.Sprintf(`(attributes->>$%[1]d::text = $%[2]d::text OR attributes->$%[1]d::text ? $%[2]d::text)`, len(args)-1, len(args)))
+	}
+
+	if lq == nil {
+		lq = listquery.All(ProductList)
 	}
-	defer rows.Close()
 
 	var products []models.Product
-	for rows.Next() {
+	page, err := queryPage(ctx, d.conn, lq, productColumns, "products", conditions, args, func(row rowScanner) error {
 		var product models.Product
-		err := rows.Scan(&product.SKU, &product.Name, &product.Volume, &product.Weight, &product.CreatedAt, &product.UpdatedAt)
-		if err != nil {
-			return nil, err
+		if err := scanProduct(row, &product); err != nil {
+			return err
 		}
 		products = append(products, product)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return products, rows.Err()
+	return products, page, nil
 }
 
 func (d *DB) UpdateProduct(ctx context.Context, sku string, req *models.UpdateProductRequest) (*models.Product, error) {
@@ -82,18 +257,88 @@ func (d *DB) UpdateProduct(ctx context.Context, sku string, req *models.UpdatePr
 		SET name = COALESCE(NULLIF($1, ''), name),
 		    volume = CASE WHEN $2 > 0 THEN $2 ELSE volume END,
 		    weight = CASE WHEN $3 > 0 THEN $3 ELSE weight END,
+		    length = CASE WHEN $4 > 0 THEN $4 ELSE length END,
+		    width = CASE WHEN $5 > 0 THEN $5 ELSE width END,
+		    height = CASE WHEN $6 > 0 THEN $6 ELSE height END,
+		    serialized = COALESCE($7, serialized),
+		    min_stock = COALESCE($8, min_stock),
+		    reorder_point = COALESCE($9, reorder_point),
+		    max_stock = COALESCE($10, max_stock),
+		    costing_method = COALESCE(NULLIF($11, ''), costing_method),
+		    category_id = CASE WHEN $13::text IS NULL THEN category_id ELSE NULLIF($13, '')::uuid END,
+		    attributes = COALESCE($14::jsonb, attributes),
 		    updated_at = CURRENT_TIMESTAMP
-		WHERE sku = $4
-		RETURNING sku, name, volume, weight, created_at, updated_at
-	`
+		WHERE sku = $12
+		RETURNING ` + productColumns
 
 	product := &models.Product{}
-	err := d.conn.QueryRowContext(ctx, query, req.Name, req.Volume, req.Weight, sku).
-		Scan(&product.SKU, &product.Name, &product.Volume, &product.Weight, &product.CreatedAt, &product.UpdatedAt)
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		current, err := lockProduct(ctx, tx, sku, true)
+		if err != nil {
+			return err
+		}
 
-	if err == sql.ErrNoRows {
-		return nil, errors.New("product not found")
-	}
+		if req.Serialized != nil && *req.Serialized != current.Serialized {
+			var count int
+			err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM shelf_items WHERE sku = $1`, sku).Scan(&count)
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return errors.New("cannot change serial tracking of a product that is in stock")
+			}
+		}
+
+		minStock, reorderPoint, maxStock := current.MinStock, current.ReorderPoint, current.MaxStock
+		if req.MinStock != nil {
+			minStock = *req.MinStock
+		}
+		if req.ReorderPoint != nil {
+			reorderPoint = *req.ReorderPoint
+		}
+		if req.MaxStock != nil {
+			maxStock = *req.MaxStock
+		}
+		if err := validateStockLevels(minStock, reorderPoint, maxStock); err != nil {
+			return err
+		}
+		// A new category or new values are checked against the schema the
+		// product ends up with
+		categoryID, values := "", current.Attributes
+		if current.CategoryID != nil {
+			categoryID = *current.CategoryID
+		}
+		if req.CategoryID != nil {
+			categoryID = *req.CategoryID
+			if err := checkCategory(ctx, tx, categoryID); err != nil {
+				return err
+			}
+		}
+		if req.Attributes != nil {
+			values = req.Attributes
+		}
+		if req.CategoryID != nil || req.Attributes != nil {
+			if err := validateAttributes(ctx, tx, categoryID, values); err != nil {
+				return err
+			}
+		}
+
+		attributes, err := marshalAttributes(req.Attributes)
+		if err != nil {
+			return err
+		}
+
+		volumeDelta := math.Max(req.Volume-current.Volume, 0)
+		weightDelta := math.Max(req.Weight-current.Weight, 0)
+		if volumeDelta > 0 || weightDelta > 0 {
+			if err := validateProductGrowth(ctx, tx, sku, volumeDelta, weightDelta, req.Force); err != nil {
+				return err
+			}
+		}
+
+		return scanProduct(tx.QueryRowContext(ctx, query, req.Name, req.Volume, req.Weight, req.Length, req.Width, req.Height, req.Serialized,
+			req.MinStock, req.ReorderPoint, req.MaxStock, string(req.CostingMethod), sku, req.CategoryID, attributes), product)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -101,33 +346,125 @@ func (d *DB) UpdateProduct(ctx context.Context, sku string, req *models.UpdatePr
 	return product, nil
 }
 
-func (d *DB) DeleteProduct(ctx context.Context, sku string) error {
-	// Check if product is in use
-	checkQuery := `SELECT COUNT(*) FROM shelf_items WHERE sku = $1`
-	var count int
-	err := d.conn.QueryRowContext(ctx, checkQuery, sku).Scan(&count)
+// validateProductGrowth checks every shelf holding sku against the extra
+// volume and weight each unit would add after a product update.
+func validateProductGrowth(ctx context.Context, q querier, sku string, volumeDelta, weightDelta float64, force bool) error {
+	rows, err := q.QueryContext(ctx, `SELECT shelf_id, SUM(quantity) FROM shelf_items WHERE sku = $1 GROUP BY shelf_id`, sku)
 	if err != nil {
 		return err
 	}
 
-	if count > 0 {
-		return errors.New("cannot delete product that is in use on shelves")
+	quantities := make(map[string]int)
+	var shelfIDs []string
+	for rows.Next() {
+		var shelfID string
+		var quantity int
+		if err := rows.Scan(&shelfID, &quantity); err != nil {
+			rows.Close()
+			return err
+		}
+		quantities[shelfID] = quantity
+		shelfIDs = append(shelfIDs, shelfID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
 	}
 
-	query := `DELETE FROM products WHERE sku = $1`
-	result, err := d.conn.ExecContext(ctx, query, sku)
-	if err != nil {
+	if err := lockShelves(ctx, q, shelfIDs...); err != nil {
 		return err
 	}
 
-	rows, err := result.RowsAffected()
-	if err != nil {
+	loads := make([]shelfLoad, 0, len(shelfIDs))
+	for _, shelfID := range shelfIDs {
+		shelf, err := getShelf(ctx, q, shelfID)
+		if err != nil {
+			return err
+		}
+
+		load := newShelfLoad(shelf)
+		load.volume += volumeDelta * float64(quantities[shelfID])
+		load.weight += weightDelta * float64(quantities[shelfID])
+		loads = append(loads, load)
+	}
+
+	return validateCapacity(loads, force)
+}
+
+// ArchiveProduct takes a product out of use while keeping its history.
+// Products with stock on any shelf, units waiting in staging or lines on
+// open inbound documents cannot be archived, since those units could no
+// longer be put away.
+func (d *DB) ArchiveProduct(ctx context.Context, sku string) (*models.Product, error) {
+	var product *models.Product
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		current, err := lockProduct(ctx, tx, sku, true)
+		if err != nil {
+			return err
+		}
+		if current.ArchivedAt != nil {
+			return errors.New("product is already archived")
+		}
+
+		var shelved, staged, inbound bool
+		err = tx.QueryRowContext(ctx, `
+			SELECT
+				EXISTS (SELECT 1 FROM shelf_items WHERE sku = $1),
+				EXISTS (SELECT 1 FROM staged_items WHERE sku = $1),
+				EXISTS (
+					SELECT 1 FROM inbound_lines l
+					JOIN inbound_documents d ON d.id = l.document_id
+					WHERE l.sku = $1 AND d.status <> $2
+				)
+		`, sku, models.InboundClosed).Scan(&shelved, &staged, &inbound)
+		if err != nil {
+			return err
+		}
+		if shelved {
+			return errors.New("cannot archive product that is in use on shelves")
+		}
+		if staged {
+			return errors.New("cannot archive product with received units awaiting putaway")
+		}
+		if inbound {
+			return errors.New("cannot archive product on an open inbound document")
+		}
+
+		actor := actorFromContext(ctx)
+		product, err = queryProduct(ctx, tx, scanProduct, `
+			UPDATE products SET archived_at = CURRENT_TIMESTAMP, archived_by = $2, updated_at = CURRENT_TIMESTAMP
+			WHERE sku = $1
+			RETURNING `+productColumns, sku, sql.NullString{String: actor, Valid: actor != ""})
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if rows == 0 {
-		return errors.New("product not found")
+	return product, nil
+}
+
+// RestoreProduct puts an archived product back into use.
+func (d *DB) RestoreProduct(ctx context.Context, sku string) (*models.Product, error) {
+	var product *models.Product
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		current, err := lockProduct(ctx, tx, sku, true)
+		if err != nil {
+			return err
+		}
+		if current.ArchivedAt == nil {
+			return errors.New("product is not archived")
+		}
+
+		product, err = queryProduct(ctx, tx, scanProduct, `
+			UPDATE products SET archived_at = NULL, archived_by = NULL, updated_at = CURRENT_TIMESTAMP
+			WHERE sku = $1
+			RETURNING `+productColumns, sku)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return product, nil
 }
@@ -0,0 +1,202 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/aslam/backend/internal/models"
+	"github.com/aslam/backend/internal/routing"
+)
+
+// defaultSuggestionLimit caps the suggestions returned when none is asked for.
+const defaultSuggestionLimit = 5
+
+// SuggestPutaway ranks the shelves that can take the whole quantity under the
+// capacity rules, best first according to the strategy.
+func (d *DB) SuggestPutaway(ctx context.Context, req *models.PutawaySuggestRequest) ([]models.PutawaySuggestion, error) {
+	suggestions, err := d.rankPutaway(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultSuggestionLimit
+	}
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+
+	return suggestions, nil
+}
+
+func (d *DB) rankPutaway(ctx context.Context, req *models.PutawaySuggestRequest) ([]models.PutawaySuggestion, error) {
+	product, err := getProductFields(ctx, d.conn, req.SKU)
+	if err != nil {
+		return nil, err
+	}
+	if product.ArchivedAt != nil {
+		return nil, errors.New("product is archived")
+	}
+
+	dock := defaultDepot
+	if req.Dock != nil {
+		dock = routing.Location{Row: req.Dock.Row, Col: req.Dock.Col}
+	}
+
+	grid, err := warehouseGrid(ctx, d.conn)
+	if err != nil {
+		return nil, err
+	}
+
+	shelfs, _, err := d.ListShelfs(ctx, &models.ShelfFilter{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	frozen, err := frozenShelves(ctx, d.conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var suggestions []models.PutawaySuggestion
+	for i := range shelfs {
+		shelf := &shelfs[i]
+		if frozen[shelf.ID] {
+			continue
+		}
+
+		// The same check addItemToShelf applies, without the locks
+		load := newShelfLoad(shelf)
+		load.volume += product.Volume * float64(req.Quantity)
+		load.weight += product.Weight * float64(req.Quantity)
+		if err := checkFit(ctx, d.conn, &load, product, req.Quantity); err != nil {
+			return nil, err
+		}
+		if len(load.exceeds()) > 0 {
+			continue
+		}
+
+		existing := 0
+		for _, item := range shelf.Items {
+			if item.SKU == req.SKU {
+				existing += item.Quantity
+			}
+		}
+
+		suggestions = append(suggestions, models.PutawaySuggestion{
+			ShelfID:          shelf.ID,
+			ShelfName:        shelf.Name,
+			RowIndex:         shelf.RowIndex,
+			ColIndex:         shelf.ColIndex,
+			FreeVolume:       shelf.MaxVolume - shelf.UsedVolume,
+			FreeVolumeAfter:  load.maxVolume - load.volume,
+			ExistingQuantity: existing,
+			Empty:            len(shelf.Items) == 0,
+			Distance:         grid.Distance(dock, routing.Location{Row: shelf.RowIndex, Col: shelf.ColIndex}),
+		})
+	}
+
+	sort.SliceStable(suggestions, putawayOrder(req.Strategy, suggestions))
+	for i := range suggestions {
+		suggestions[i].Rank = i + 1
+	}
+
+	return suggestions, nil
+}
+
+// putawayOrder returns the comparison ranking suggestions for strategy. Every
+// strategy breaks ties by distance from the dock.
+func putawayOrder(strategy models.PutawayStrategy, s []models.PutawaySuggestion) func(i, j int) bool {
+	closer := func(i, j int) bool {
+		return s[i].Distance < s[j].Distance
+	}
+
+	switch strategy {
+	case models.PutawayClosest:
+		return func(i, j int) bool {
+			if s[i].Distance != s[j].Distance {
+				return closer(i, j)
+			}
+			return s[i].FreeVolumeAfter > s[j].FreeVolumeAfter
+		}
+	case models.PutawayBestFit:
+		return func(i, j int) bool {
+			if s[i].FreeVolumeAfter != s[j].FreeVolumeAfter {
+				return s[i].FreeVolumeAfter < s[j].FreeVolumeAfter
+			}
+			return closer(i, j)
+		}
+	case models.PutawayEmptyFirst:
+		return func(i, j int) bool {
+			if s[i].Empty != s[j].Empty {
+				return s[i].Empty
+			}
+			return closer(i, j)
+		}
+	default:
+		return func(i, j int) bool {
+			if s[i].ExistingQuantity != s[j].ExistingQuantity {
+				return s[i].ExistingQuantity > s[j].ExistingQuantity
+			}
+			return closer(i, j)
+		}
+	}
+}
+
+// ApplyPutaway stores the units on the best suggested shelf. Suggestions are
+// ranked without locks, so if another mutation fills or a count freezes a
+// shelf first the next suggestion is tried.
+func (d *DB) ApplyPutaway(ctx context.Context, req *models.ApplyPutawayRequest) (*models.ApplyPutawayResponse, error) {
+	if req.StagedItemID != "" {
+		staged, err := getStagedItem(ctx, d.conn, req.StagedItemID, false)
+		if err != nil {
+			return nil, err
+		}
+		if staged.SKU != req.SKU {
+			return nil, errors.New("staged item holds a different SKU")
+		}
+	}
+
+	suggestions, err := d.rankPutaway(ctx, &req.PutawaySuggestRequest)
+	if err != nil {
+		return nil, err
+	}
+	if len(suggestions) == 0 {
+		return nil, errors.New("no shelf can hold the requested quantity")
+	}
+
+	for _, suggestion := range suggestions {
+		var item *models.ShelfItem
+		if req.StagedItemID != "" {
+			item, err = d.PutawayStagedItem(ctx, req.StagedItemID, &models.PutawayRequest{
+				ShelfID:       suggestion.ShelfID,
+				Quantity:      req.Quantity,
+				SerialNumbers: req.SerialNumbers,
+			})
+		} else {
+			item, err = d.AddItemToShelf(ctx, suggestion.ShelfID, &models.AddItemToShelfRequest{
+				SKU:            req.SKU,
+				Quantity:       req.Quantity,
+				LotNumber:      req.LotNumber,
+				ManufacturedAt: req.ManufacturedAt,
+				ExpiresAt:      req.ExpiresAt,
+				SerialNumbers:  req.SerialNumbers,
+				UnitCost:       req.UnitCost,
+			})
+		}
+
+		var capacityErr *CapacityError
+		var frozenErr *FrozenError
+		if errors.As(err, &capacityErr) || errors.As(err, &frozenErr) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return &models.ApplyPutawayResponse{Suggestion: suggestion, Item: item}, nil
+	}
+
+	return nil, err
+}
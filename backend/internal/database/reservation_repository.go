@@ -0,0 +1,269 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aslam/backend/internal/listquery"
+	"github.com/aslam/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+// defaultReservationTTL applies when a reservation is created without an
+// explicit expiry.
+const defaultReservationTTL = 24 * time.Hour
+
+// reservationHolds is true for reservations, aliased as r, that currently
+// hold stock.
+const reservationHolds = `(r.status = 'confirmed' OR (r.status = 'active' AND r.expires_at > CURRENT_TIMESTAMP))`
+
+// reservationColumns lists the reservations columns, aliased as r, in the
+// order scanReservation expects. Lapsed active holds read as expired.
+const reservationColumns = `r.id, r.sku, r.shelf_id, r.quantity,
+	CASE WHEN r.status = 'active' AND r.expires_at <= CURRENT_TIMESTAMP THEN 'expired' ELSE r.status END,
+	r.reference, r.expires_at, r.created_by, r.created_at, r.updated_at`
+
+func scanReservation(row rowScanner, reservation *models.Reservation) error {
+	var shelfID, createdBy sql.NullString
+	var expiresAt sql.NullTime
+	err := row.Scan(&reservation.ID, &reservation.SKU, &shelfID, &reservation.Quantity, &reservation.Status,
+		&reservation.Reference, &expiresAt, &createdBy, &reservation.CreatedAt, &reservation.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	reservation.ShelfID = shelfID.String
+	reservation.CreatedBy = createdBy.String
+	reservation.ExpiresAt = timePtr(expiresAt)
+	return nil
+}
+
+// stockLevels reports on-hand and reserved units of sku, on one shelf when
+// shelfID is set and across the warehouse otherwise.
+func stockLevels(ctx context.Context, q querier, sku, shelfID string) (onHand, reserved int, err error) {
+	query := `
+		SELECT
+			COALESCE((SELECT SUM(si.quantity) FROM shelf_items si WHERE si.sku = $1 AND ($2 = '' OR si.shelf_id::text = $2)), 0),
+			COALESCE((SELECT SUM(r.quantity) FROM reservations r WHERE r.sku = $1 AND ($2 = '' OR r.shelf_id::text = $2) AND ` + reservationHolds + `), 0)
+	`
+
+	err = q.QueryRowContext(ctx, query, sku, shelfID).Scan(&onHand, &reserved)
+	return onHand, reserved, err
+}
+
+// checkReservations fails if taking quantity units of sku off the shelf would
+// leave less stock than is reserved on that shelf or, when the units leave
+// the warehouse, less than is reserved overall.
+func checkReservations(ctx context.Context, q querier, shelfID, sku string, quantity int, leaving bool) error {
+	scopes := []string{shelfID}
+	if leaving {
+		scopes = append(scopes, "")
+	}
+
+	for _, scope := range scopes {
+		onHand, reserved, err := stockLevels(ctx, q, sku, scope)
+		if err != nil {
+			return err
+		}
+
+		if onHand-quantity < reserved {
+			return fmt.Errorf("cannot remove reserved stock: %d of %d units are reserved", reserved, onHand)
+		}
+	}
+
+	return nil
+}
+
+func getShelfAllocated(ctx context.Context, q querier, shelfID string) (int, error) {
+	query := `SELECT COALESCE(SUM(r.quantity), 0) FROM reservations r WHERE r.shelf_id = $1 AND ` + reservationHolds
+
+	var allocated int
+	err := q.QueryRowContext(ctx, query, shelfID).Scan(&allocated)
+	return allocated, err
+}
+
+func (d *DB) CreateReservation(ctx context.Context, req *models.CreateReservationRequest) (*models.Reservation, error) {
+	expiresAt := time.Now().Add(defaultReservationTTL)
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			return nil, errors.New("expiry must be in the future")
+		}
+		expiresAt = *req.ExpiresAt
+	}
+
+	reservation := &models.Reservation{}
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		// Reservations for a SKU are serialized on its product row
+		if _, err := lockProduct(ctx, tx, req.SKU, true); err != nil {
+			return err
+		}
+
+		scopes := []string{""}
+		if req.ShelfID != "" {
+			if err := lockShelves(ctx, tx, req.ShelfID); err != nil {
+				return err
+			}
+			scopes = append(scopes, req.ShelfID)
+		}
+
+		for _, scope := range scopes {
+			onHand, reserved, err := stockLevels(ctx, tx, req.SKU, scope)
+			if err != nil {
+				return err
+			}
+
+			if onHand-reserved < req.Quantity {
+				return fmt.Errorf("insufficient available stock: %d available", onHand-reserved)
+			}
+		}
+
+		reservation.SKU = req.SKU
+		reservation.ShelfID = req.ShelfID
+		reservation.Quantity = req.Quantity
+		reservation.Status = models.ReservationActive
+		reservation.Reference = req.Reference
+		reservation.ExpiresAt = &expiresAt
+		return insertReservation(ctx, tx, reservation)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reservation, nil
+}
+
+// insertReservation stores reservation as given, without checking stock, and
+// reads back its generated fields. Callers must hold the product lock.
+func insertReservation(ctx context.Context, q querier, reservation *models.Reservation) error {
+	actor := actorFromContext(ctx)
+	query := `
+		INSERT INTO reservations AS r (id, sku, shelf_id, quantity, status, reference, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING ` + reservationColumns
+
+	var expiresAt sql.NullTime
+	if reservation.ExpiresAt != nil {
+		expiresAt = sql.NullTime{Time: *reservation.ExpiresAt, Valid: true}
+	}
+
+	return scanReservation(q.QueryRowContext(ctx, query, uuid.New().String(), reservation.SKU,
+		sql.NullString{String: reservation.ShelfID, Valid: reservation.ShelfID != ""}, reservation.Quantity,
+		reservation.Status, reservation.Reference, expiresAt, sql.NullString{String: actor, Valid: actor != ""}), reservation)
+}
+
+func (d *DB) GetReservation(ctx context.Context, id string) (*models.Reservation, error) {
+	query := `SELECT ` + reservationColumns + ` FROM reservations r WHERE r.id = $1`
+
+	reservation := &models.Reservation{}
+	err := scanReservation(d.conn.QueryRowContext(ctx, query, id), reservation)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("reservation not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return reservation, nil
+}
+
+// ReservationList is what reservation lists can be sorted and filtered by.
+var ReservationList = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"id":         {Column: "r.id", Type: listquery.UUID},
+		"sku":        {Column: "r.sku", Type: listquery.String},
+		"quantity":   {Column: "r.quantity", Type: listquery.Int},
+		"reference":  {Column: "r.reference", Type: listquery.String},
+		"created_at": {Column: "r.created_at", Type: listquery.Time},
+		"updated_at": {Column: "r.updated_at", Type: listquery.Time},
+	},
+	Sort: []listquery.Sort{{Field: "created_at", Desc: true}},
+	Key:  "id",
+}
+
+func (d *DB) ListReservations(ctx context.Context, filter *models.ReservationFilter, lq *listquery.Query) ([]models.Reservation, *listquery.Page, error) {
+	var conditions []string
+	var args []interface{}
+
+	addCondition := func(clause string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(clause, len(args)))
+	}
+
+	if filter.SKU != "" {
+		addCondition("r.sku = $%d", filter.SKU)
+	}
+	if filter.ShelfID != "" {
+		addCondition("r.shelf_id = $%d", filter.ShelfID)
+	}
+
+	switch filter.Status {
+	case "":
+	case models.ReservationActive:
+		conditions = append(conditions, "r.status = 'active' AND r.expires_at > CURRENT_TIMESTAMP")
+	case models.ReservationExpired:
+		conditions = append(conditions, "r.status = 'active' AND r.expires_at <= CURRENT_TIMESTAMP")
+	default:
+		addCondition("r.status = $%d", filter.Status)
+	}
+
+	if lq == nil {
+		lq = listquery.All(ReservationList)
+	}
+
+	var reservations []models.Reservation
+	page, err := queryPage(ctx, d.conn, lq, reservationColumns, "reservations r", conditions, args, func(row rowScanner) error {
+		var reservation models.Reservation
+		if err := scanReservation(row, &reservation); err != nil {
+			return err
+		}
+		reservations = append(reservations, reservation)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return reservations, page, nil
+}
+
+// ConfirmReservation turns an active hold into a firm one that no longer
+// expires.
+func (d *DB) ConfirmReservation(ctx context.Context, id string) (*models.Reservation, error) {
+	query := `
+		UPDATE reservations r
+		SET status = 'confirmed', expires_at = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE r.id = $1 AND r.status = 'active' AND r.expires_at > CURRENT_TIMESTAMP
+		RETURNING ` + reservationColumns
+
+	return d.transitionReservation(ctx, id, query, "only active reservations can be confirmed")
+}
+
+// ReleaseReservation frees the stock held by a reservation.
+func (d *DB) ReleaseReservation(ctx context.Context, id string) (*models.Reservation, error) {
+	return d.transitionReservation(ctx, id, releaseReservationQuery, "reservation is no longer holding stock")
+}
+
+const releaseReservationQuery = `
+	UPDATE reservations r
+	SET status = 'released', updated_at = CURRENT_TIMESTAMP
+	WHERE r.id = $1 AND r.status IN ('active', 'confirmed')
+	RETURNING ` + reservationColumns
+
+func (d *DB) transitionReservation(ctx context.Context, id, query, conflict string) (*models.Reservation, error) {
+	reservation := &models.Reservation{}
+	err := scanReservation(d.conn.QueryRowContext(ctx, query, id), reservation)
+	if err == sql.ErrNoRows {
+		if _, getErr := d.GetReservation(ctx, id); getErr != nil {
+			return nil, getErr
+		}
+		return nil, errors.New(conflict)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return reservation, nil
+}
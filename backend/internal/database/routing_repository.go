@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aslam/backend/internal/models"
+	"github.com/aslam/backend/internal/routing"
+	"github.com/lib/pq"
+)
+
+// defaultDepot is the front end of the first aisle.
+var defaultDepot = routing.Location{Row: 0, Col: -1}
+
+func (d *DB) OptimizeRoute(ctx context.Context, req *models.RouteRequest) (*models.RouteResponse, error) {
+	start, end := defaultDepot, defaultDepot
+	if req.Start != nil {
+		start = routing.Location{Row: req.Start.Row, Col: req.Start.Col}
+	}
+	if req.End != nil {
+		end = routing.Location{Row: req.End.Row, Col: req.End.Col}
+	}
+
+	return routeShelves(ctx, d.conn, req.ShelfIDs, routing.Strategy(req.Strategy), start, end)
+}
+
+// routeShelves orders the given shelves into a walk between the depots.
+func routeShelves(ctx context.Context, q querier, shelfIDs []string, strategy routing.Strategy, start, end routing.Location) (*models.RouteResponse, error) {
+	grid, err := warehouseGrid(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + shelfColumns + ` FROM shelfs WHERE id::text = ANY($1)`
+	rows, err := q.QueryContext(ctx, query, pq.Array(shelfIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shelfs := make(map[string]models.Shelf)
+	var stops []routing.Stop
+	for rows.Next() {
+		var shelf models.Shelf
+		if err := scanShelf(rows, &shelf); err != nil {
+			return nil, err
+		}
+		shelfs[shelf.ID] = shelf
+		stops = append(stops, routing.Stop{ID: shelf.ID, Location: routing.Location{Row: shelf.RowIndex, Col: shelf.ColIndex}})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range shelfIDs {
+		if _, ok := shelfs[id]; !ok {
+			return nil, fmt.Errorf("shelf %s not found", id)
+		}
+	}
+
+	route, err := routing.Optimize(grid, start, end, stops, strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.RouteResponse{Strategy: string(route.Strategy), Distance: route.Distance}
+	for i, stop := range route.Stops {
+		shelf := shelfs[stop.ID]
+		response.Stops = append(response.Stops, models.RouteStop{
+			Sequence: i + 1,
+			ShelfID:  shelf.ID,
+			Name:     shelf.Name,
+			RowIndex: shelf.RowIndex,
+			ColIndex: shelf.ColIndex,
+		})
+	}
+
+	return response, nil
+}
+
+// warehouseGrid sizes the grid to the shelves on it, so the back cross aisle
+// runs just past the last column.
+func warehouseGrid(ctx context.Context, q querier) (routing.Grid, error) {
+	var cols int
+	err := q.QueryRowContext(ctx, `SELECT COALESCE(MAX(col_index) + 1, 0) FROM shelfs`).Scan(&cols)
+	return routing.Grid{Cols: cols}, err
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aslam/backend/internal/models"
+	"github.com/aslam/backend/internal/search"
+)
+
+const defaultSearchLimit = 20
+
+// SearchProducts finds products by SKU, name, barcodes and attribute
+// values. Every word of the query must match, either as the start of a
+// word in full-text search or as a near spelling by trigram similarity.
+// Exact SKU and barcode matches rank first, then full-text and trigram
+// relevance.
+func (d *DB) SearchProducts(ctx context.Context, q *models.ProductSearchQuery) ([]models.ProductSearchResult, error) {
+	terms := search.Terms(q.Q)
+	if len(terms) == 0 {
+		return nil, errors.New("search query has no words to match")
+	}
+
+	limit := q.Limit
+	if limit == 0 {
+		limit = defaultSearchLimit
+	}
+
+	prefixes := make([]string, len(terms))
+	for i, term := range terms {
+		prefixes[i] = term + ":*"
+	}
+	args := []interface{}{strings.TrimSpace(q.Q), strings.Join(prefixes, " & "), limit}
+
+	// Terms hold only letters and digits, so they are safe in tsquery
+	// syntax
+	var conditions, similarities []string
+	for _, term := range terms {
+		args = append(args, term)
+		n := len(args)
+		conditions = append(conditions, fmt.Sprintf(
+			`(to_tsvector('simple', search_text) @@ to_tsquery('simple', $%[1]d::text || ':*') OR $%[1]d::text <%% search_text)`, n))
+		similarities = append(similarities, fmt.Sprintf(`word_similarity($%d::text, search_text)`, n))
+	}
+
+	query := `
+		SELECT ` + productColumns + `,
+			CASE WHEN lower(sku) = lower($1::text)
+				OR EXISTS (SELECT 1 FROM product_barcodes b WHERE b.sku = products.sku AND b.code = $1::text)
+				THEN 1 ELSE 0 END
+			+ ts_rank(to_tsvector('simple', search_text), to_tsquery('simple', $2))
+			+ (` + strings.Join(similarities, " + ") + `) / ` + strconv.Itoa(len(terms)) + ` AS rank
+		FROM products
+		WHERE archived_at IS NULL AND ` + strings.Join(conditions, " AND ") + `
+		ORDER BY rank DESC, name ASC
+		LIMIT $3
+	`
+
+	rows, err := d.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []models.ProductSearchResult{}
+	for rows.Next() {
+		var result models.ProductSearchResult
+		if err := scanProduct(withExtra{rows, []interface{}{&result.Rank}}, &result.Product); err != nil {
+			return nil, err
+		}
+		result.Highlights = highlightProduct(&result.Product, terms)
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// highlightProduct marks the matched words in each field of the product,
+// leaving out fields without any.
+func highlightProduct(product *models.Product, terms []string) map[string]string {
+	highlights := make(map[string]string)
+	add := func(field, text string) {
+		if marked, ok := search.Highlight(text, terms); ok {
+			highlights[field] = marked
+		}
+	}
+
+	add("sku", product.SKU)
+	add("name", product.Name)
+
+	var barcodes []string
+	for _, code := range product.Barcodes {
+		if marked, ok := search.Highlight(code, terms); ok {
+			barcodes = append(barcodes, marked)
+		}
+	}
+	if len(barcodes) > 0 {
+		highlights["barcodes"] = strings.Join(barcodes, ", ")
+	}
+
+	names := make([]string, 0, len(product.Attributes))
+	for name := range product.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		add("attributes."+name, attributeText(product.Attributes[name]))
+	}
+
+	return highlights
+}
+
+// attributeText renders an attribute value as the text it is searched by.
+func attributeText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = attributeText(item)
+		}
+		return strings.Join(items, ", ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
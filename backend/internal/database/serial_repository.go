@@ -0,0 +1,254 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aslam/backend/internal/models"
+	"github.com/lib/pq"
+)
+
+// validateSerials checks the serial numbers supplied for a change of quantity
+// units: serialized products need exactly one distinct serial per unit, other
+// products take none.
+func validateSerials(product *models.Product, serials []string, quantity int) error {
+	if !product.Serialized {
+		if len(serials) > 0 {
+			return errors.New("product is not serialized")
+		}
+		return nil
+	}
+
+	if len(serials) != quantity {
+		return fmt.Errorf("serialized product requires %d serial numbers, got %d", quantity, len(serials))
+	}
+
+	seen := make(map[string]bool, len(serials))
+	for _, serial := range serials {
+		if strings.TrimSpace(serial) == "" {
+			return errors.New("serial numbers cannot be empty")
+		}
+		if seen[serial] {
+			return fmt.Errorf("duplicate serial number %s", serial)
+		}
+		seen[serial] = true
+	}
+
+	return nil
+}
+
+// checkSerialsReceivable rejects serials that are in stock, waiting in
+// staging or recorded against another product, so a receipt cannot stage
+// units that putaway would refuse later.
+func checkSerialsReceivable(ctx context.Context, q querier, sku string, serials []string) error {
+	if len(serials) == 0 {
+		return nil
+	}
+
+	query := `
+		SELECT serial_number FROM serial_numbers
+		WHERE serial_number = ANY($1) AND (shelf_item_id IS NOT NULL OR sku <> $2)
+		UNION ALL
+		SELECT serial FROM staged_items, unnest(serial_numbers) AS serial
+		WHERE serial = ANY($1)
+		LIMIT 1
+	`
+
+	var serial string
+	err := q.QueryRowContext(ctx, query, pq.Array(serials), sku).Scan(&serial)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return fmt.Errorf("serial number %s is already in stock, staged or belongs to another product", serial)
+}
+
+// attachSerials records serials as sitting in the given shelf item. A serial
+// can only be attached while it is not in stock anywhere else in the
+// warehouse.
+func attachSerials(ctx context.Context, q querier, sku, itemID string, serials []string) error {
+	query := `
+		INSERT INTO serial_numbers (serial_number, sku, shelf_item_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (serial_number) DO UPDATE
+		SET shelf_item_id = EXCLUDED.shelf_item_id, updated_at = CURRENT_TIMESTAMP
+		WHERE serial_numbers.shelf_item_id IS NULL AND serial_numbers.sku = EXCLUDED.sku
+	`
+
+	for _, serial := range serials {
+		result, err := q.ExecContext(ctx, query, serial, sku, itemID)
+		if err != nil {
+			return err
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return fmt.Errorf("serial number %s is already in stock or belongs to another product", serial)
+		}
+	}
+
+	return nil
+}
+
+// detachSerials takes serials out of the given shelf item. When serials is
+// empty it picks count of them, oldest first. It returns the serials taken.
+func detachSerials(ctx context.Context, q querier, itemID string, serials []string, count int) ([]string, error) {
+	if len(serials) == 0 {
+		query := `
+			UPDATE serial_numbers
+			SET shelf_item_id = NULL, updated_at = CURRENT_TIMESTAMP
+			WHERE serial_number IN (
+				SELECT serial_number FROM serial_numbers
+				WHERE shelf_item_id = $1
+				ORDER BY created_at ASC, serial_number ASC
+				LIMIT $2
+				FOR UPDATE
+			)
+			RETURNING serial_number
+		`
+		return querySerials(ctx, q, query, itemID, count)
+	}
+
+	query := `
+		UPDATE serial_numbers
+		SET shelf_item_id = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE shelf_item_id = $1 AND serial_number = ANY($2)
+		RETURNING serial_number
+	`
+
+	detached, err := querySerials(ctx, q, query, itemID, pq.Array(serials))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(detached) != len(serials) {
+		return nil, errors.New("serial number not found on this shelf item")
+	}
+
+	return detached, nil
+}
+
+// detachAllSerials takes every serial out of the given shelf item.
+func detachAllSerials(ctx context.Context, q querier, itemID string) ([]string, error) {
+	query := `
+		UPDATE serial_numbers
+		SET shelf_item_id = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE shelf_item_id = $1
+		RETURNING serial_number
+	`
+	return querySerials(ctx, q, query, itemID)
+}
+
+// locateSerials finds which shelf item on the shelf holds each serial,
+// failing if any of them is not in stock there.
+func locateSerials(ctx context.Context, q querier, shelfID, sku string, serials []string) (map[string][]string, error) {
+	query := `
+		SELECT sn.shelf_item_id, sn.serial_number
+		FROM serial_numbers sn
+		JOIN shelf_items si ON si.id = sn.shelf_item_id
+		WHERE si.shelf_id = $1 AND si.sku = $2 AND sn.serial_number = ANY($3)
+	`
+
+	rows, err := q.QueryContext(ctx, query, shelfID, sku, pq.Array(serials))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byItem := make(map[string][]string)
+	found := 0
+	for rows.Next() {
+		var itemID, serial string
+		if err := rows.Scan(&itemID, &serial); err != nil {
+			return nil, err
+		}
+		byItem[itemID] = append(byItem[itemID], serial)
+		found++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if found != len(serials) {
+		return nil, errors.New("serial number not found on shelf")
+	}
+
+	return byItem, nil
+}
+
+func querySerials(ctx context.Context, q querier, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var serials []string
+	for rows.Next() {
+		var serial string
+		if err := rows.Scan(&serial); err != nil {
+			return nil, err
+		}
+		serials = append(serials, serial)
+	}
+
+	return serials, rows.Err()
+}
+
+func (d *DB) GetSerial(ctx context.Context, serial string) (*models.SerialLookup, error) {
+	query := `
+		SELECT sn.serial_number, sn.sku, si.shelf_id, si.lot_number
+		FROM serial_numbers sn
+		LEFT JOIN shelf_items si ON si.id = sn.shelf_item_id
+		WHERE sn.serial_number = $1
+	`
+
+	lookup := &models.SerialLookup{}
+	var sku string
+	var shelfID, lotNumber sql.NullString
+	err := d.conn.QueryRowContext(ctx, query, serial).Scan(&lookup.SerialNumber, &sku, &shelfID, &lotNumber)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("serial number not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if lookup.Product, err = d.GetProductBySKU(ctx, sku); err != nil {
+		return nil, err
+	}
+
+	if shelfID.Valid {
+		lookup.InStock = true
+		lookup.LotNumber = lotNumber.String
+		lookup.Shelf = &models.Shelf{}
+		shelfQuery := `SELECT ` + shelfColumns + ` FROM shelfs WHERE id = $1`
+		if err := scanShelf(d.conn.QueryRowContext(ctx, shelfQuery, shelfID.String), lookup.Shelf); err != nil {
+			return nil, err
+		}
+	}
+
+	movementsQuery := `
+		SELECT ` + movementColumns + `
+		FROM stock_movements m
+		JOIN stock_movement_serials ms ON ms.movement_id = m.id
+		WHERE ms.serial_number = $1
+		ORDER BY m.created_at DESC
+	`
+	lookup.Movements, err = queryMovements(ctx, d.conn, movementsQuery, serial)
+	if err != nil {
+		return nil, err
+	}
+
+	return lookup, nil
+}
@@ -4,24 +4,84 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"sort"
+	"time"
 
+	"github.com/aslam/backend/internal/listquery"
 	"github.com/aslam/backend/internal/models"
 	"github.com/google/uuid"
 )
 
+// shelfColumns lists the shelfs columns in the order scanShelf expects.
+const shelfColumns = `id, name, row_index, col_index, max_volume, max_weight, length, width, height, archived_at, archived_by, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanShelf(row rowScanner, shelf *models.Shelf) error {
+	var archivedAt sql.NullTime
+	var archivedBy sql.NullString
+	err := row.Scan(&shelf.ID, &shelf.Name, &shelf.RowIndex, &shelf.ColIndex, &shelf.MaxVolume, &shelf.MaxWeight, &shelf.Length, &shelf.Width, &shelf.Height,
+		&archivedAt, &archivedBy, &shelf.CreatedAt, &shelf.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	shelf.ArchivedAt = timePtr(archivedAt)
+	shelf.ArchivedBy = nil
+	if archivedBy.Valid {
+		shelf.ArchivedBy = &archivedBy.String
+	}
+	return nil
+}
+
+// newShelfResponse combines a shelf with its items and reserved units and
+// derives the load and stock totals.
+func newShelfResponse(shelf *models.Shelf, items []models.ShelfItem, allocated int) *models.ShelfResponse {
+	usedVolume, usedWeight := 0.0, 0.0
+	onHand := 0
+	for _, item := range items {
+		usedVolume += item.Volume
+		usedWeight += item.Weight
+		onHand += item.Quantity
+	}
+
+	return &models.ShelfResponse{
+		ID:           shelf.ID,
+		Name:         shelf.Name,
+		RowIndex:     shelf.RowIndex,
+		ColIndex:     shelf.ColIndex,
+		MaxVolume:    shelf.MaxVolume,
+		UsedVolume:   usedVolume,
+		MaxWeight:    shelf.MaxWeight,
+		UsedWeight:   usedWeight,
+		Length:       shelf.Length,
+		Width:        shelf.Width,
+		Height:       shelf.Height,
+		OverCapacity: usedVolume > shelf.MaxVolume || (shelf.MaxWeight > 0 && usedWeight > shelf.MaxWeight),
+		OnHand:       onHand,
+		Allocated:    allocated,
+		Available:    onHand - allocated,
+		Items:        items,
+		ArchivedAt:   shelf.ArchivedAt,
+		ArchivedBy:   shelf.ArchivedBy,
+		CreatedAt:    shelf.CreatedAt,
+		UpdatedAt:    shelf.UpdatedAt,
+	}
+}
+
 func (d *DB) CreateShelf(ctx context.Context, req *models.CreateShelfRequest) (*models.Shelf, error) {
 	id := uuid.New().String()
 
 	query := `
-		INSERT INTO shelfs (id, name, row_index, col_index, max_volume)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, name, row_index, col_index, max_volume, created_at, updated_at
-	`
+		INSERT INTO shelfs (id, name, row_index, col_index, max_volume, max_weight, length, width, height)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING ` + shelfColumns
 
 	shelf := &models.Shelf{}
-	err := d.conn.QueryRowContext(ctx, query, id, req.Name, req.RowIndex, req.ColIndex, req.MaxVolume).
-		Scan(&shelf.ID, &shelf.Name, &shelf.RowIndex, &shelf.ColIndex, &shelf.MaxVolume, &shelf.CreatedAt, &shelf.UpdatedAt)
-
+	err := scanShelf(d.conn.QueryRowContext(ctx, query, id, req.Name, req.RowIndex, req.ColIndex, req.MaxVolume, req.MaxWeight, req.Length, req.Width, req.Height), shelf)
 	if err != nil {
 		return nil, err
 	}
@@ -30,16 +90,14 @@ func (d *DB) CreateShelf(ctx context.Context, req *models.CreateShelfRequest) (*
 }
 
 func (d *DB) GetShelfByID(ctx context.Context, id string) (*models.ShelfResponse, error) {
-	shelfQuery := `
-		SELECT id, name, row_index, col_index, max_volume, created_at, updated_at
-		FROM shelfs
-		WHERE id = $1
-	`
+	return getShelf(ctx, d.conn, id)
+}
 
-	shelf := &models.Shelf{}
-	err := d.conn.QueryRowContext(ctx, shelfQuery, id).
-		Scan(&shelf.ID, &shelf.Name, &shelf.RowIndex, &shelf.ColIndex, &shelf.MaxVolume, &shelf.CreatedAt, &shelf.UpdatedAt)
+func getShelf(ctx context.Context, q querier, id string) (*models.ShelfResponse, error) {
+	shelfQuery := `SELECT ` + shelfColumns + ` FROM shelfs WHERE id = $1`
 
+	shelf := &models.Shelf{}
+	err := scanShelf(q.QueryRowContext(ctx, shelfQuery, id), shelf)
 	if err == sql.ErrNoRows {
 		return nil, errors.New("shelf not found")
 	}
@@ -48,42 +106,72 @@ func (d *DB) GetShelfByID(ctx context.Context, id string) (*models.ShelfResponse
 	}
 
 	// Get items
-	items, err := d.getShelfItems(ctx, id)
+	items, err := getShelfItems(ctx, q, id)
 	if err != nil {
 		return nil, err
 	}
 
-	// Calculate used volume
-	usedVolume := 0.0
-	for _, item := range items {
-		usedVolume += item.Volume
+	allocated, err := getShelfAllocated(ctx, q, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return newShelfResponse(shelf, items, allocated), nil
+}
+
+// shelfItemColumns lists the shelf_items columns, joined with products as p,
+// in the order scanShelfItem expects.
+const shelfItemColumns = `si.id, si.shelf_id, si.sku, p.name, si.quantity, (p.volume * si.quantity) as volume,
+	(p.weight * si.quantity) as weight, si.created_at, si.lot_number, si.manufactured_at, si.expires_at`
+
+func scanShelfItem(row rowScanner, item *models.ShelfItem) error {
+	var manufacturedAt, expiresAt sql.NullTime
+	err := row.Scan(&item.ID, &item.ShelfID, &item.SKU, &item.ProductName, &item.Quantity, &item.Volume,
+		&item.Weight, &item.CreatedAt, &item.LotNumber, &manufacturedAt, &expiresAt)
+	if err != nil {
+		return err
+	}
+
+	item.ManufacturedAt = timePtr(manufacturedAt)
+	item.ExpiresAt = timePtr(expiresAt)
+	return nil
+}
+
+func getShelfItem(ctx context.Context, q querier, itemID string) (*models.ShelfItem, error) {
+	query := `
+		SELECT ` + shelfItemColumns + `
+		FROM shelf_items si
+		JOIN products p ON si.sku = p.sku
+		WHERE si.id = $1
+	`
+
+	item := &models.ShelfItem{}
+	err := scanShelfItem(q.QueryRowContext(ctx, query, itemID), item)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("item not found")
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	response := &models.ShelfResponse{
-		ID:         shelf.ID,
-		Name:       shelf.Name,
-		RowIndex:   shelf.RowIndex,
-		ColIndex:   shelf.ColIndex,
-		MaxVolume:  shelf.MaxVolume,
-		UsedVolume: usedVolume,
-		Items:      items,
-		CreatedAt:  shelf.CreatedAt,
-		UpdatedAt:  shelf.UpdatedAt,
+	items := []models.ShelfItem{*item}
+	if err := describeQuantities(ctx, q, items); err != nil {
+		return nil, err
 	}
 
-	return response, nil
+	return &items[0], nil
 }
 
-func (d *DB) getShelfItems(ctx context.Context, shelfID string) ([]models.ShelfItem, error) {
+func getShelfItems(ctx context.Context, q querier, shelfID string) ([]models.ShelfItem, error) {
 	query := `
-		SELECT si.id, si.shelf_id, si.sku, p.name, si.quantity, (p.volume * si.quantity) as volume, si.created_at
+		SELECT ` + shelfItemColumns + `
 		FROM shelf_items si
 		JOIN products p ON si.sku = p.sku
 		WHERE si.shelf_id = $1
 		ORDER BY si.created_at ASC
 	`
 
-	rows, err := d.conn.QueryContext(ctx, query, shelfID)
+	rows, err := q.QueryContext(ctx, query, shelfID)
 	if err != nil {
 		return nil, err
 	}
@@ -92,62 +180,81 @@ func (d *DB) getShelfItems(ctx context.Context, shelfID string) ([]models.ShelfI
 	var items []models.ShelfItem
 	for rows.Next() {
 		var item models.ShelfItem
-		err := rows.Scan(&item.ID, &item.ShelfID, &item.SKU, &item.ProductName, &item.Quantity, &item.Volume, &item.CreatedAt)
-		if err != nil {
+		if err := scanShelfItem(rows, &item); err != nil {
 			return nil, err
 		}
 		items = append(items, item)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	return items, rows.Err()
+	return items, describeQuantities(ctx, q, items)
 }
 
-func (d *DB) ListShelfs(ctx context.Context) ([]models.ShelfResponse, error) {
-	query := `
-		SELECT id, name, row_index, col_index, max_volume, created_at, updated_at
-		FROM shelfs
-		ORDER BY row_index ASC, col_index ASC
-	`
+// ShelfList is what shelf lists can be sorted and filtered by.
+var ShelfList = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"id":         {Column: "id", Type: listquery.UUID},
+		"name":       {Column: "name", Type: listquery.String},
+		"row_index":  {Column: "row_index", Type: listquery.Int},
+		"col_index":  {Column: "col_index", Type: listquery.Int},
+		"max_volume": {Column: "max_volume", Type: listquery.Number},
+		"max_weight": {Column: "max_weight", Type: listquery.Number},
+		"created_at": {Column: "created_at", Type: listquery.Time},
+		"updated_at": {Column: "updated_at", Type: listquery.Time},
+	},
+	Sort: []listquery.Sort{{Field: "row_index"}, {Field: "col_index"}},
+	Key:  "id",
+}
 
-	rows, err := d.conn.QueryContext(ctx, query)
-	if err != nil {
-		return nil, err
+func (d *DB) ListShelfs(ctx context.Context, filter *models.ShelfFilter, lq *listquery.Query) ([]models.ShelfResponse, *listquery.Page, error) {
+	conditions := []string{`archived_at IS NULL`}
+	if filter.Archived {
+		conditions[0] = `archived_at IS NOT NULL`
+	}
+	var args []interface{}
+	if filter.Category != "" {
+		args = append(args, filter.Category)
+		conditions = append(conditions, `
+			EXISTS (
+				SELECT 1
+				FROM shelf_items si
+				JOIN products p ON p.sku = si.sku
+				WHERE si.shelf_id = shelfs.id AND p.category_id IN (`+categorySubtree(1)+`)
+			)`)
+	}
+
+	if lq == nil {
+		lq = listquery.All(ShelfList)
 	}
-	defer rows.Close()
 
 	var shelfs []models.ShelfResponse
-	for rows.Next() {
+	page, err := queryPage(ctx, d.conn, lq, shelfColumns, "shelfs", conditions, args, func(row rowScanner) error {
 		var shelf models.Shelf
-		err := rows.Scan(&shelf.ID, &shelf.Name, &shelf.RowIndex, &shelf.ColIndex, &shelf.MaxVolume, &shelf.CreatedAt, &shelf.UpdatedAt)
-		if err != nil {
-			return nil, err
+		if err := scanShelf(row, &shelf); err != nil {
+			return err
 		}
 
 		// Get items and used volume
-		items, err := d.getShelfItems(ctx, shelf.ID)
+		items, err := getShelfItems(ctx, d.conn, shelf.ID)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		usedVolume := 0.0
-		for _, item := range items {
-			usedVolume += item.Volume
+		allocated, err := getShelfAllocated(ctx, d.conn, shelf.ID)
+		if err != nil {
+			return err
 		}
 
-		shelfs = append(shelfs, models.ShelfResponse{
-			ID:         shelf.ID,
-			Name:       shelf.Name,
-			RowIndex:   shelf.RowIndex,
-			ColIndex:   shelf.ColIndex,
-			MaxVolume:  shelf.MaxVolume,
-			UsedVolume: usedVolume,
-			Items:      items,
-			CreatedAt:  shelf.CreatedAt,
-			UpdatedAt:  shelf.UpdatedAt,
-		})
+		shelfs = append(shelfs, *newShelfResponse(&shelf, items, allocated))
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return shelfs, rows.Err()
+	return shelfs, page, nil
 }
 
 func (d *DB) UpdateShelf(ctx context.Context, id string, req *models.UpdateShelfRequest) (*models.Shelf, error) {
@@ -155,18 +262,38 @@ func (d *DB) UpdateShelf(ctx context.Context, id string, req *models.UpdateShelf
 		UPDATE shelfs
 		SET name = COALESCE(NULLIF($1, ''), name),
 		    max_volume = CASE WHEN $2 > 0 THEN $2 ELSE max_volume END,
+		    max_weight = COALESCE($3, max_weight),
+		    length = CASE WHEN $4 > 0 THEN $4 ELSE length END,
+		    width = CASE WHEN $5 > 0 THEN $5 ELSE width END,
+		    height = CASE WHEN $6 > 0 THEN $6 ELSE height END,
 		    updated_at = CURRENT_TIMESTAMP
-		WHERE id = $3
-		RETURNING id, name, row_index, col_index, max_volume, created_at, updated_at
-	`
+		WHERE id = $7
+		RETURNING ` + shelfColumns
 
 	shelf := &models.Shelf{}
-	err := d.conn.QueryRowContext(ctx, query, req.Name, req.MaxVolume, id).
-		Scan(&shelf.ID, &shelf.Name, &shelf.RowIndex, &shelf.ColIndex, &shelf.MaxVolume, &shelf.CreatedAt, &shelf.UpdatedAt)
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		if err := lockShelves(ctx, tx, id); err != nil {
+			return err
+		}
 
-	if err == sql.ErrNoRows {
-		return nil, errors.New("shelf not found")
-	}
+		current, err := getShelf(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		load := newShelfLoad(current)
+		if req.MaxVolume > 0 {
+			load.maxVolume = req.MaxVolume
+		}
+		if req.MaxWeight != nil {
+			load.maxWeight = *req.MaxWeight
+		}
+		if err := validateCapacity([]shelfLoad{load}, req.Force); err != nil {
+			return err
+		}
+
+		return scanShelf(tx.QueryRowContext(ctx, query, req.Name, req.MaxVolume, req.MaxWeight, req.Length, req.Width, req.Height, id), shelf)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -174,137 +301,584 @@ func (d *DB) UpdateShelf(ctx context.Context, id string, req *models.UpdateShelf
 	return shelf, nil
 }
 
-func (d *DB) DeleteShelf(ctx context.Context, id string) error {
-	query := `DELETE FROM shelfs WHERE id = $1`
-	result, err := d.conn.ExecContext(ctx, query, id)
-	if err != nil {
+// ArchiveShelf takes a shelf out of use while keeping its history. A shelf
+// that still holds stock cannot be archived; its stock has to be
+// transferred to another shelf first.
+func (d *DB) ArchiveShelf(ctx context.Context, id string) (*models.ShelfResponse, error) {
+	var shelf *models.ShelfResponse
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		if err := lockShelves(ctx, tx, id); err != nil {
+			return err
+		}
+
+		current, err := getShelf(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if current.ArchivedAt != nil {
+			return errors.New("shelf is already archived")
+		}
+		if len(current.Items) > 0 {
+			return errors.New("shelf holds stock; transfer it to another shelf before archiving")
+		}
+
+		actor := actorFromContext(ctx)
+		_, err = tx.ExecContext(ctx, `
+			UPDATE shelfs SET archived_at = CURRENT_TIMESTAMP, archived_by = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1
+		`, id, sql.NullString{String: actor, Valid: actor != ""})
+		if err != nil {
+			return err
+		}
+
+		shelf, err = getShelf(ctx, tx, id)
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	rows, err := result.RowsAffected()
-	if err != nil {
+	return shelf, nil
+}
+
+// RestoreShelf puts an archived shelf back into use.
+func (d *DB) RestoreShelf(ctx context.Context, id string) (*models.ShelfResponse, error) {
+	var shelf *models.ShelfResponse
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		if err := lockShelves(ctx, tx, id); err != nil {
+			return err
+		}
+
+		current, err := getShelf(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if current.ArchivedAt == nil {
+			return errors.New("shelf is not archived")
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE shelfs SET archived_at = NULL, archived_by = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = $1
+		`, id)
+		if err != nil {
+			return err
+		}
+
+		shelf, err = getShelf(ctx, tx, id)
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if rows == 0 {
-		return errors.New("shelf not found")
+	return shelf, nil
+}
+
+func (d *DB) AddItemToShelf(ctx context.Context, shelfID string, req *models.AddItemToShelfRequest) (*models.ShelfItem, error) {
+	var item *models.ShelfItem
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		item, err = addItemToShelf(ctx, tx, shelfID, req, models.MovementAdd)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return item, nil
 }
 
-func (d *DB) AddItemToShelf(ctx context.Context, shelfID, sku string, quantity int) (*models.ShelfItem, error) {
+// addItemToShelf stores the requested units on the shelf, merging into an
+// existing row when there is one, and records the movement under reason.
+func addItemToShelf(ctx context.Context, q querier, shelfID string, req *models.AddItemToShelfRequest, reason models.MovementReason) (*models.ShelfItem, error) {
+	sku := req.SKU
+
+	if req.ManufacturedAt != nil && req.ExpiresAt != nil && req.ExpiresAt.Before(*req.ManufacturedAt) {
+		return nil, errors.New("expiry date cannot be before manufacturing date")
+	}
+
 	// Get product to verify existence and get volume
-	product, err := d.GetProductBySKU(ctx, sku)
+	product, err := lockProduct(ctx, q, sku, false)
 	if err != nil {
-		return nil, errors.New("product not found")
+		return nil, err
+	}
+	if product.ArchivedAt != nil {
+		return nil, errors.New("product is archived")
 	}
 
-	// Get shelf to check volume
-	shelf, err := d.GetShelfByID(ctx, shelfID)
+	quantity, err := toBaseQuantity(ctx, q, sku, req.Unit, req.Quantity)
+	if err != nil {
+		return nil, err
+	}
+	volume, weight, err := unitLoad(ctx, q, product, req.Unit, req.Quantity)
 	if err != nil {
 		return nil, err
 	}
 
-	// Check if item already exists
-	checkQuery := `SELECT id, quantity FROM shelf_items WHERE shelf_id = $1 AND sku = $2`
-	var existingID string
-	var existingQuantity int
-	err = d.conn.QueryRowContext(ctx, checkQuery, shelfID, sku).Scan(&existingID, &existingQuantity)
+	if err := validateSerials(product, req.SerialNumbers, quantity); err != nil {
+		return nil, err
+	}
 
-	if err == nil {
-		// Item exists, update quantity
-		newQuantity := existingQuantity + quantity
-		volumeAdded := product.Volume * float64(quantity)
+	// Lock the shelf so concurrent additions see each other's volume
+	if err := lockShelves(ctx, q, shelfID); err != nil {
+		return nil, err
+	}
+	if err := checkNotFrozen(ctx, q, shelfID); err != nil {
+		return nil, err
+	}
 
-		if shelf.UsedVolume+volumeAdded > shelf.MaxVolume {
-			return nil, errors.New("insufficient shelf volume")
-		}
+	// Get shelf to check volume
+	shelf, err := getShelf(ctx, q, shelfID)
+	if err != nil {
+		return nil, err
+	}
+	if shelf.ArchivedAt != nil {
+		return nil, errors.New("shelf is archived")
+	}
 
-		updateQuery := `
-			UPDATE shelf_items
-			SET quantity = $1
-			WHERE id = $2
-			RETURNING id, shelf_id, sku, quantity, created_at
-		`
+	load := newShelfLoad(shelf)
+	load.volume += volume
+	load.weight += weight
+	if err := checkFit(ctx, q, &load, product, quantity); err != nil {
+		return nil, err
+	}
+	if err := validateCapacity([]shelfLoad{load}, req.Force); err != nil {
+		return nil, err
+	}
 
-		item := &models.ShelfItem{}
-		err := d.conn.QueryRowContext(ctx, updateQuery, newQuantity, existingID).
-			Scan(&item.ID, &item.ShelfID, &item.SKU, &item.Quantity, &item.CreatedAt)
+	// A lot has one expiry date; merging units that disagree would misplace
+	// them in FEFO order
+	var storedExpiry time.Time
+	err = q.QueryRowContext(ctx, `
+		SELECT expires_at FROM shelf_items
+		WHERE shelf_id = $1 AND sku = $2 AND lot_number = $3 AND expires_at <> $4::date
+	`, shelfID, sku, req.LotNumber, req.ExpiresAt).Scan(&storedExpiry)
+	if err == nil {
+		return nil, fmt.Errorf("lot %q is already on the shelf with expiry date %s", req.LotNumber, storedExpiry.Format("2006-01-02"))
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
 
-		if err != nil {
-			return nil, err
-		}
+	// Insert, or merge into the existing row for this SKU and lot
+	upsertQuery := `
+		INSERT INTO shelf_items (id, shelf_id, sku, quantity, lot_number, manufactured_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (shelf_id, sku, lot_number) DO UPDATE
+		SET quantity = shelf_items.quantity + EXCLUDED.quantity,
+		    manufactured_at = COALESCE(shelf_items.manufactured_at, EXCLUDED.manufactured_at),
+		    expires_at = COALESCE(shelf_items.expires_at, EXCLUDED.expires_at)
+		RETURNING id
+	`
 
-		item.ProductName = product.Name
-		item.Volume = product.Volume * float64(item.Quantity)
-		return item, nil
+	var itemID string
+	err = q.QueryRowContext(ctx, upsertQuery, uuid.New().String(), shelfID, sku, quantity,
+		req.LotNumber, req.ManufacturedAt, req.ExpiresAt).Scan(&itemID)
+	if err != nil {
+		return nil, err
 	}
 
-	// New item
-	volumeNeeded := product.Volume * float64(quantity)
-	if shelf.UsedVolume+volumeNeeded > shelf.MaxVolume {
-		return nil, errors.New("insufficient shelf volume")
+	if err := attachSerials(ctx, q, sku, itemID, req.SerialNumbers); err != nil {
+		return nil, err
 	}
 
-	id := uuid.New().String()
-	insertQuery := `
-		INSERT INTO shelf_items (id, shelf_id, sku, quantity)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, shelf_id, sku, quantity, created_at
-	`
-
-	item := &models.ShelfItem{}
-	err = d.conn.QueryRowContext(ctx, insertQuery, id, shelfID, sku, quantity).
-		Scan(&item.ID, &item.ShelfID, &item.SKU, &item.Quantity, &item.CreatedAt)
+	err = recordMovement(ctx, q, &models.StockMovement{
+		SKU:           sku,
+		ShelfID:       shelfID,
+		LotNumber:     req.LotNumber,
+		QuantityDelta: quantity,
+		Reason:        reason,
+		SerialNumbers: req.SerialNumbers,
+		UnitCost:      req.UnitCost,
+	})
+	if err != nil {
+		return nil, err
+	}
 
+	item, err := getShelfItem(ctx, q, itemID)
 	if err != nil {
 		return nil, err
 	}
 
-	item.ProductName = product.Name
-	item.Volume = product.Volume * float64(item.Quantity)
+	item.CapacityCheck = load.check
 	return item, nil
 }
 
 func (d *DB) RemoveItemFromShelf(ctx context.Context, itemID string) error {
-	query := `DELETE FROM shelf_items WHERE id = $1`
-	result, err := d.conn.ExecContext(ctx, query, itemID)
+	return d.withTx(ctx, func(tx *sql.Tx) error {
+		return removeItemFromShelf(ctx, tx, itemID, models.MovementRemove)
+	})
+}
+
+func removeItemFromShelf(ctx context.Context, q querier, itemID string, reason models.MovementReason) error {
+	shelfID, product, err := lockItem(ctx, q, itemID)
+	if err != nil {
+		return err
+	}
+
+	var quantity int
+	err = q.QueryRowContext(ctx, `SELECT quantity FROM shelf_items WHERE id = $1 FOR UPDATE`, itemID).Scan(&quantity)
+	if err == sql.ErrNoRows {
+		return errors.New("item not found")
+	}
 	if err != nil {
 		return err
 	}
 
-	rows, err := result.RowsAffected()
+	if err := checkReservations(ctx, q, shelfID, product.SKU, quantity, true); err != nil {
+		return err
+	}
+
+	serials, err := detachAllSerials(ctx, q, itemID)
 	if err != nil {
 		return err
 	}
 
-	if rows == 0 {
+	query := `DELETE FROM shelf_items WHERE id = $1 RETURNING shelf_id, sku, lot_number, quantity`
+
+	movement := &models.StockMovement{Reason: reason, SerialNumbers: serials}
+	err = q.QueryRowContext(ctx, query, itemID).Scan(&movement.ShelfID, &movement.SKU, &movement.LotNumber, &quantity)
+	if err == sql.ErrNoRows {
 		return errors.New("item not found")
 	}
+	if err != nil {
+		return err
+	}
 
-	return nil
+	movement.QuantityDelta = -quantity
+	return recordMovement(ctx, q, movement)
+}
+
+// stockPick selects units of a SKU on one shelf to take out.
+type stockPick struct {
+	shelfID  string
+	sku      string
+	quantity int
+
+	// lotNumber restricts the pick to one lot when set; otherwise lots are
+	// drawn in strategy order.
+	lotNumber string
+	strategy  models.PickStrategy
+
+	// serialNumbers picks exact units of a serialized product, overriding
+	// the strategy. Otherwise the oldest serials of each lot are taken.
+	serialNumbers []string
+}
+
+// pickOrder is the ORDER BY clause that ranks lots for a pick strategy,
+// defaulting to first-expired-first-out.
+func pickOrder(strategy models.PickStrategy) string {
+	if strategy == models.PickFIFO {
+		return `si.created_at ASC, si.id ASC`
+	}
+	return `si.expires_at ASC NULLS LAST, si.created_at ASC, si.id ASC`
+}
+
+// takeItemFromShelf removes units from the shelf as selected by pick, deleting
+// rows once they are empty and recording one movement per lot under reason.
+// It returns the quantity taken from each lot.
+func takeItemFromShelf(ctx context.Context, q querier, pick stockPick, reason models.MovementReason) ([]models.LotQuantity, error) {
+	if err := lockShelves(ctx, q, pick.shelfID); err != nil {
+		return nil, err
+	}
+	if err := checkNotFrozen(ctx, q, pick.shelfID); err != nil {
+		return nil, err
+	}
+
+	var serialsByItem map[string][]string
+	if len(pick.serialNumbers) > 0 {
+		if len(pick.serialNumbers) != pick.quantity {
+			return nil, fmt.Errorf("expected %d serial numbers, got %d", pick.quantity, len(pick.serialNumbers))
+		}
+
+		var err error
+		if serialsByItem, err = locateSerials(ctx, q, pick.shelfID, pick.sku, pick.serialNumbers); err != nil {
+			return nil, err
+		}
+	}
+
+	args := []interface{}{pick.shelfID, pick.sku}
+	query := `
+		SELECT si.id, si.lot_number, si.manufactured_at, si.expires_at, si.quantity
+		FROM shelf_items si
+		WHERE si.shelf_id = $1 AND si.sku = $2
+	`
+	if pick.lotNumber != "" {
+		args = append(args, pick.lotNumber)
+		query += ` AND si.lot_number = $3`
+	}
+	query += ` ORDER BY ` + pickOrder(pick.strategy) + ` FOR UPDATE`
+
+	type lotRow struct {
+		id  string
+		lot models.LotQuantity
+	}
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var lots []lotRow
+	available := 0
+	for rows.Next() {
+		var row lotRow
+		var manufacturedAt, expiresAt sql.NullTime
+		if err := rows.Scan(&row.id, &row.lot.LotNumber, &manufacturedAt, &expiresAt, &row.lot.Quantity); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		row.lot.ManufacturedAt = timePtr(manufacturedAt)
+		row.lot.ExpiresAt = timePtr(expiresAt)
+		lots = append(lots, row)
+		available += row.lot.Quantity
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(lots) == 0 {
+		return nil, errors.New("item not found on shelf")
+	}
+	if available < pick.quantity {
+		return nil, errors.New("insufficient quantity on shelf")
+	}
+
+	// Transferred units stay in the warehouse, so only shelf holds apply
+	leaving := reason != models.MovementTransferOut
+	if err := checkReservations(ctx, q, pick.shelfID, pick.sku, pick.quantity, leaving); err != nil {
+		return nil, err
+	}
+
+	var taken []models.LotQuantity
+	remaining := pick.quantity
+	for _, row := range lots {
+		if remaining == 0 {
+			break
+		}
+
+		take := row.lot.Quantity
+		if take > remaining {
+			take = remaining
+		}
+		if serialsByItem != nil {
+			take = len(serialsByItem[row.id])
+			if take == 0 {
+				continue
+			}
+		}
+
+		serials, err := detachSerials(ctx, q, row.id, serialsByItem[row.id], take)
+		if err != nil {
+			return nil, err
+		}
+
+		if take == row.lot.Quantity {
+			_, err = q.ExecContext(ctx, `DELETE FROM shelf_items WHERE id = $1`, row.id)
+		} else {
+			_, err = q.ExecContext(ctx, `UPDATE shelf_items SET quantity = quantity - $1 WHERE id = $2`, take, row.id)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		err = recordMovement(ctx, q, &models.StockMovement{
+			SKU:           pick.sku,
+			ShelfID:       pick.shelfID,
+			LotNumber:     row.lot.LotNumber,
+			QuantityDelta: -take,
+			Reason:        reason,
+			SerialNumbers: serials,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		portion := row.lot
+		portion.Quantity = take
+		portion.SerialNumbers = serials
+		taken = append(taken, portion)
+		remaining -= take
+	}
+
+	return taken, nil
+}
+
+func (d *DB) UpdateItemQuantity(ctx context.Context, itemID string, req *models.UpdateItemQuantityRequest) error {
+	return d.withTx(ctx, func(tx *sql.Tx) error {
+		item, err := getShelfItem(ctx, tx, itemID)
+		if err != nil {
+			return err
+		}
+		quantity, err := toBaseQuantity(ctx, tx, item.SKU, req.Unit, req.Quantity)
+		if err != nil {
+			return err
+		}
+
+		return setItemQuantity(ctx, tx, itemID, quantity, req.SerialNumbers, req.Force, models.MovementAdjust)
+	})
 }
 
-func (d *DB) UpdateItemQuantity(ctx context.Context, itemID string, quantity int) error {
+func setItemQuantity(ctx context.Context, q querier, itemID string, quantity int, serialNumbers []string, force bool, reason models.MovementReason) error {
 	if quantity <= 0 {
-		return d.RemoveItemFromShelf(ctx, itemID)
+		return removeItemFromShelf(ctx, q, itemID, reason)
 	}
 
-	query := `UPDATE shelf_items SET quantity = $1 WHERE id = $2`
-	result, err := d.conn.ExecContext(ctx, query, quantity, itemID)
+	shelfID, product, err := lockItem(ctx, q, itemID)
+	if err != nil {
+		return err
+	}
+	sku := product.SKU
+
+	var lotNumber string
+	var currentQuantity int
+	err = q.QueryRowContext(ctx, `SELECT lot_number, quantity FROM shelf_items WHERE id = $1 FOR UPDATE`, itemID).
+		Scan(&lotNumber, &currentQuantity)
+	if err == sql.ErrNoRows {
+		return errors.New("item not found")
+	}
 	if err != nil {
 		return err
 	}
 
-	rows, err := result.RowsAffected()
+	if quantity < currentQuantity {
+		if err := checkReservations(ctx, q, shelfID, sku, currentQuantity-quantity, true); err != nil {
+			return err
+		}
+	}
+
+	shelf, err := getShelf(ctx, q, shelfID)
 	if err != nil {
 		return err
 	}
 
-	if rows == 0 {
-		return errors.New("item not found")
+	delta := quantity - currentQuantity
+	load := newShelfLoad(shelf)
+	load.volume += product.Volume * float64(delta)
+	load.weight += product.Weight * float64(delta)
+	if delta > 0 {
+		// Added units must fit physically, as on any other add
+		if err := checkFit(ctx, q, &load, product, delta); err != nil {
+			return err
+		}
+	}
+	if err := validateCapacity([]shelfLoad{load}, force); err != nil {
+		return err
+	}
+
+	serials := serialNumbers
+	switch {
+	case !product.Serialized || delta == 0:
+		if err := validateSerials(product, serialNumbers, 0); err != nil {
+			return err
+		}
+	case delta > 0:
+		if err := validateSerials(product, serialNumbers, delta); err != nil {
+			return err
+		}
+		if err := attachSerials(ctx, q, sku, itemID, serialNumbers); err != nil {
+			return err
+		}
+	default:
+		// Decreases take the named serials, or the oldest ones if none given
+		if len(serialNumbers) > 0 {
+			if err := validateSerials(product, serialNumbers, -delta); err != nil {
+				return err
+			}
+		}
+		if serials, err = detachSerials(ctx, q, itemID, serialNumbers, -delta); err != nil {
+			return err
+		}
+	}
+
+	query := `UPDATE shelf_items SET quantity = $1 WHERE id = $2`
+	if _, err := q.ExecContext(ctx, query, quantity, itemID); err != nil {
+		return err
+	}
+
+	return recordMovement(ctx, q, &models.StockMovement{
+		SKU:           sku,
+		ShelfID:       shelfID,
+		LotNumber:     lotNumber,
+		QuantityDelta: delta,
+		Reason:        reason,
+		SerialNumbers: serials,
+	})
+}
+
+// lockShelves takes a row lock on each shelf for the rest of the transaction.
+// Locks are acquired in a stable order so that concurrent mutations touching
+// several shelves cannot deadlock each other. Callers that also lock product
+// rows must do so before locking shelves.
+func lockShelves(ctx context.Context, q querier, ids ...string) error {
+	sorted := append([]string(nil), ids...)
+	sort.Strings(sorted)
+
+	for _, id := range sorted {
+		var lockedID string
+		err := q.QueryRowContext(ctx, `SELECT id FROM shelfs WHERE id = $1 FOR UPDATE`, id).Scan(&lockedID)
+		if err == sql.ErrNoRows {
+			return errors.New("shelf not found")
+		}
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
+
+// lockItem locks the product and then the shelf of the given item, in the
+// standard order, returning the item's shelf ID and product. It fails if the
+// shelf is frozen for a count. The product is locked for update because the
+// caller may take stock away, and the warehouse-wide reservation check only
+// holds while no other shelf can release units of the same SKU.
+func lockItem(ctx context.Context, q querier, itemID string) (string, *models.Product, error) {
+	var shelfID, sku string
+	err := q.QueryRowContext(ctx, `SELECT shelf_id, sku FROM shelf_items WHERE id = $1`, itemID).Scan(&shelfID, &sku)
+	if err == sql.ErrNoRows {
+		return "", nil, errors.New("item not found")
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	product, err := lockProduct(ctx, q, sku, true)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err := lockShelves(ctx, q, shelfID); err != nil {
+		return "", nil, err
+	}
+
+	return shelfID, product, checkNotFrozen(ctx, q, shelfID)
+}
+
+// ListShelvesInRows returns the active shelves from row fromRow to row toRow
+// inclusive, in grid order.
+func (d *DB) ListShelvesInRows(ctx context.Context, fromRow, toRow int) ([]models.Shelf, error) {
+	query := `
+		SELECT ` + shelfColumns + `
+		FROM shelfs
+		WHERE row_index BETWEEN $1 AND $2 AND archived_at IS NULL
+		ORDER BY row_index ASC, col_index ASC
+	`
+
+	rows, err := d.conn.QueryContext(ctx, query, fromRow, toRow)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shelfs []models.Shelf
+	for rows.Next() {
+		var shelf models.Shelf
+		if err := scanShelf(rows, &shelf); err != nil {
+			return nil, err
+		}
+		shelfs = append(shelfs, shelf)
+	}
+
+	return shelfs, rows.Err()
+}
@@ -0,0 +1,248 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/aslam/backend/internal/listquery"
+	"github.com/aslam/backend/internal/models"
+	"github.com/lib/pq"
+)
+
+// stockLevelChannel is notified with a SKU whenever its stock or levels
+// change.
+const stockLevelChannel = "stock_levels"
+
+// ReorderList is what reorder suggestion lists can be sorted and filtered
+// by. Shortfall is how far on-hand stock is below the reorder point.
+var ReorderList = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"sku":           {Column: "p.sku", Type: listquery.String},
+		"name":          {Column: "p.name", Type: listquery.String},
+		"on_hand":       {Column: "p.on_hand", Type: listquery.Int},
+		"on_order":      {Column: "p.on_order", Type: listquery.Int},
+		"reorder_point": {Column: "p.reorder_point", Type: listquery.Int},
+		"shortfall":     {Column: "p.reorder_point - p.on_hand", Type: listquery.Int},
+	},
+	Sort: []listquery.Sort{{Field: "shortfall", Desc: true}},
+	Key:  "sku",
+}
+
+// ListBelowReorder lists SKUs whose on-hand total is below their reorder
+// point. The suggested quantity tops stock up to the maximum, or to the
+// reorder point when no maximum is set, net of what is still expected on open
+// inbound documents.
+func (d *DB) ListBelowReorder(ctx context.Context, lq *listquery.Query) ([]models.ReorderSuggestion, *listquery.Page, error) {
+	from := `(
+		SELECT products.sku, products.name, products.min_stock, products.reorder_point, products.max_stock,
+			COALESCE((SELECT SUM(si.quantity) FROM shelf_items si WHERE si.sku = products.sku), 0) AS on_hand,
+			COALESCE((
+				SELECT SUM(GREATEST(il.expected_quantity - il.received_quantity, 0))
+				FROM inbound_lines il
+				JOIN inbound_documents idoc ON idoc.id = il.document_id
+				WHERE il.sku = products.sku AND idoc.status <> 'closed'
+			), 0) AS on_order
+		FROM products
+		WHERE products.reorder_point > 0 AND products.archived_at IS NULL
+	) p`
+
+	if lq == nil {
+		lq = listquery.All(ReorderList)
+	}
+
+	var suggestions []models.ReorderSuggestion
+	columns := `p.sku, p.name, p.on_hand, p.on_order, p.min_stock, p.reorder_point, p.max_stock`
+	page, err := queryPage(ctx, d.conn, lq, columns, from, []string{"p.on_hand < p.reorder_point"}, nil, func(row rowScanner) error {
+		var s models.ReorderSuggestion
+		if err := row.Scan(&s.SKU, &s.Name, &s.OnHand, &s.OnOrder, &s.MinStock, &s.ReorderPoint, &s.MaxStock); err != nil {
+			return err
+		}
+
+		target := s.MaxStock
+		if target == 0 {
+			target = s.ReorderPoint
+		}
+		if s.SuggestedQuantity = target - s.OnHand - s.OnOrder; s.SuggestedQuantity < 0 {
+			s.SuggestedQuantity = 0
+		}
+		suggestions = append(suggestions, s)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return suggestions, page, nil
+}
+
+// StockAlertList is what stock alert lists can be sorted and filtered by.
+var StockAlertList = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"id":         {Column: "id", Type: listquery.UUID},
+		"sku":        {Column: "sku", Type: listquery.String},
+		"kind":       {Column: "kind", Type: listquery.String},
+		"on_hand":    {Column: "on_hand", Type: listquery.Int},
+		"threshold":  {Column: "threshold", Type: listquery.Int},
+		"created_at": {Column: "created_at", Type: listquery.Time},
+	},
+	Sort: []listquery.Sort{{Field: "created_at", Desc: true}},
+	Key:  "id",
+}
+
+func (d *DB) ListStockAlerts(ctx context.Context, includeResolved bool, lq *listquery.Query) ([]models.StockAlert, *listquery.Page, error) {
+	var conditions []string
+	if !includeResolved {
+		conditions = append(conditions, "resolved_at IS NULL")
+	}
+
+	if lq == nil {
+		lq = listquery.All(StockAlertList)
+	}
+
+	var alerts []models.StockAlert
+	columns := `id, sku, kind, on_hand, threshold, created_at, resolved_at`
+	page, err := queryPage(ctx, d.conn, lq, columns, "stock_alerts", conditions, nil, func(row rowScanner) error {
+		var alert models.StockAlert
+		var resolvedAt sql.NullTime
+		err := row.Scan(&alert.ID, &alert.SKU, &alert.Kind, &alert.OnHand, &alert.Threshold, &alert.CreatedAt, &resolvedAt)
+		if err != nil {
+			return err
+		}
+		alert.ResolvedAt = timePtr(resolvedAt)
+		alerts = append(alerts, alert)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return alerts, page, nil
+}
+
+// CheckStockLevels raises an alert for every level the given SKUs have
+// crossed and resolves alerts for levels they are back within. With no SKUs
+// it checks every product that has levels set or alerts open. Archived
+// products raise no alerts, and their open ones are resolved.
+func (d *DB) CheckStockLevels(ctx context.Context, skus ...string) error {
+	if len(skus) == 0 {
+		rows, err := d.conn.QueryContext(ctx, `
+			SELECT sku FROM products WHERE (min_stock > 0 OR reorder_point > 0 OR max_stock > 0) AND archived_at IS NULL
+			UNION
+			SELECT sku FROM stock_alerts WHERE resolved_at IS NULL
+		`)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var sku string
+			if err := rows.Scan(&sku); err != nil {
+				rows.Close()
+				return err
+			}
+			skus = append(skus, sku)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	for _, sku := range skus {
+		if err := d.checkStockLevel(ctx, sku); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *DB) checkStockLevel(ctx context.Context, sku string) error {
+	product, err := getProductFields(ctx, d.conn, sku)
+	if err != nil {
+		return err
+	}
+	err = d.conn.QueryRowContext(ctx, `SELECT COALESCE(SUM(quantity), 0) FROM shelf_items WHERE sku = $1`, sku).Scan(&product.OnHand)
+	if err != nil {
+		return err
+	}
+
+	active := product.ArchivedAt == nil
+	levels := []struct {
+		kind      models.StockAlertKind
+		threshold int
+		crossed   bool
+	}{
+		{models.AlertBelowMinimum, product.MinStock, active && product.MinStock > 0 && product.OnHand < product.MinStock},
+		{models.AlertBelowReorder, product.ReorderPoint, active && product.ReorderPoint > 0 && product.OnHand < product.ReorderPoint},
+		{models.AlertAboveMaximum, product.MaxStock, active && product.MaxStock > 0 && product.OnHand > product.MaxStock},
+	}
+
+	for _, level := range levels {
+		// The partial unique index keeps a single open alert per level,
+		// even with several servers checking at once
+		if level.crossed {
+			_, err = d.conn.ExecContext(ctx, `
+				INSERT INTO stock_alerts (sku, kind, on_hand, threshold)
+				VALUES ($1, $2, $3, $4)
+				ON CONFLICT (sku, kind) WHERE resolved_at IS NULL DO NOTHING
+			`, sku, level.kind, product.OnHand, level.threshold)
+		} else {
+			_, err = d.conn.ExecContext(ctx, `
+				UPDATE stock_alerts SET resolved_at = CURRENT_TIMESTAMP
+				WHERE sku = $1 AND kind = $2 AND resolved_at IS NULL
+			`, sku, level.kind)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WatchStockLevels checks stock levels in the background until ctx is done.
+// Every committed shelf mutation notifies it of the SKU involved; a full
+// sweep runs every interval and after reconnects, in case notifications
+// were missed.
+func (d *DB) WatchStockLevels(ctx context.Context, interval time.Duration) {
+	listener := pq.NewListener(d.dsn, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("stock level listener: %v", err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(stockLevelChannel); err != nil {
+		log.Printf("stock level listener: %v", err)
+	}
+
+	sweep := func() {
+		if err := d.CheckStockLevels(ctx); err != nil {
+			log.Printf("stock level sweep: %v", err)
+		}
+	}
+	sweep()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-listener.Notify:
+			// A nil notification means the connection was re-established
+			if n == nil {
+				sweep()
+				continue
+			}
+			if err := d.CheckStockLevels(ctx, n.Extra); err != nil {
+				log.Printf("stock level check for %s: %v", n.Extra, err)
+			}
+		case <-ticker.C:
+			sweep()
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/aslam/backend/internal/models"
+)
+
+// TransferItems moves stock between two shelves in a single transaction, so a
+// failure on the destination never loses the units taken from the source.
+func (d *DB) TransferItems(ctx context.Context, req *models.TransferRequest) (*models.TransferResponse, error) {
+	if req.FromShelfID == req.ToShelfID {
+		return nil, errors.New("source and destination shelves must differ")
+	}
+
+	response := &models.TransferResponse{}
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		// Lock the product, then both shelves in a stable order, so opposite
+		// transfers between the same pair cannot deadlock. Stock leaves the
+		// source, so the product is locked for update like any removal
+		if _, err := lockProduct(ctx, tx, req.SKU, true); err != nil {
+			return err
+		}
+		if err := lockShelves(ctx, tx, req.FromShelfID, req.ToShelfID); err != nil {
+			return err
+		}
+
+		quantity, err := toBaseQuantity(ctx, tx, req.SKU, req.Unit, req.Quantity)
+		if err != nil {
+			return err
+		}
+
+		pick := stockPick{
+			shelfID:   req.FromShelfID,
+			sku:       req.SKU,
+			quantity:  quantity,
+			lotNumber: req.LotNumber,
+			strategy:  req.Strategy,
+
+			serialNumbers: req.SerialNumbers,
+		}
+		lots, err := takeItemFromShelf(ctx, tx, pick, models.MovementTransferOut)
+		if err != nil {
+			return err
+		}
+
+		// Units keep their lot identity on the destination shelf
+		for _, lot := range lots {
+			addReq := &models.AddItemToShelfRequest{
+				SKU:            req.SKU,
+				Quantity:       lot.Quantity,
+				LotNumber:      lot.LotNumber,
+				ManufacturedAt: lot.ManufacturedAt,
+				ExpiresAt:      lot.ExpiresAt,
+				SerialNumbers:  lot.SerialNumbers,
+			}
+			if _, err := addItemToShelf(ctx, tx, req.ToShelfID, addReq, models.MovementTransferIn); err != nil {
+				return err
+			}
+		}
+
+		if response.From, err = getShelf(ctx, tx, req.FromShelfID); err != nil {
+			return err
+		}
+		response.To, err = getShelf(ctx, tx, req.ToShelfID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
@@ -0,0 +1,244 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aslam/backend/internal/models"
+	"github.com/lib/pq"
+)
+
+// ListProductUnits returns the product's pack hierarchy from the base unit
+// up, largest last.
+func (d *DB) ListProductUnits(ctx context.Context, sku string) ([]models.ProductUnit, error) {
+	product, err := getProductFields(ctx, d.conn, sku)
+	if err != nil {
+		return nil, err
+	}
+
+	return listProductUnits(ctx, d.conn, product)
+}
+
+func listProductUnits(ctx context.Context, q querier, product *models.Product) ([]models.ProductUnit, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT unit, factor, volume, weight
+		FROM product_units
+		WHERE sku = $1
+		ORDER BY factor ASC
+	`, product.SKU)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	units := []models.ProductUnit{{
+		SKU:    product.SKU,
+		Unit:   models.BaseUnit,
+		Factor: 1,
+		Volume: product.Volume,
+		Weight: product.Weight,
+	}}
+	for rows.Next() {
+		unit := models.ProductUnit{SKU: product.SKU}
+		if err := rows.Scan(&unit.Unit, &unit.Factor, &unit.Volume, &unit.Weight); err != nil {
+			return nil, err
+		}
+		if unit.Volume == 0 {
+			unit.Volume = product.Volume * float64(unit.Factor)
+		}
+		if unit.Weight == 0 {
+			unit.Weight = product.Weight * float64(unit.Factor)
+		}
+		units = append(units, unit)
+	}
+
+	return units, rows.Err()
+}
+
+// SetProductUnits replaces the product's pack hierarchy. Stock is held in
+// base units, so changing the hierarchy never touches shelf quantities.
+func (d *DB) SetProductUnits(ctx context.Context, sku string, req *models.SetProductUnitsRequest) ([]models.ProductUnit, error) {
+	if err := validateProductUnits(req.Units); err != nil {
+		return nil, err
+	}
+
+	var units []models.ProductUnit
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		product, err := lockProduct(ctx, tx, sku, true)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM product_units WHERE sku = $1`, sku); err != nil {
+			return err
+		}
+
+		for _, unit := range req.Units {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO product_units (sku, unit, factor, volume, weight)
+				VALUES ($1, $2, $3, $4, $5)
+			`, sku, strings.ToLower(unit.Unit), unit.Factor, unit.Volume, unit.Weight)
+			if err != nil {
+				return err
+			}
+		}
+
+		units, err = listProductUnits(ctx, tx, product)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return units, nil
+}
+
+// validateProductUnits checks that unit names are distinct and that each
+// level packs a whole number of the level below it.
+func validateProductUnits(units []models.ProductUnitRequest) error {
+	sorted := make([]models.ProductUnitRequest, len(units))
+	copy(sorted, units)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Factor < sorted[j].Factor })
+
+	seen := map[string]bool{models.BaseUnit: true}
+	below := 1
+	for _, unit := range sorted {
+		name := strings.ToLower(unit.Unit)
+		if seen[name] {
+			return fmt.Errorf("unit %q is defined more than once", unit.Unit)
+		}
+		seen[name] = true
+
+		if unit.Factor == below {
+			return fmt.Errorf("unit %q has the same factor as the level below it", unit.Unit)
+		}
+		if unit.Factor%below != 0 {
+			return fmt.Errorf("unit %q does not hold a whole number of the level below it", unit.Unit)
+		}
+		below = unit.Factor
+	}
+
+	return nil
+}
+
+// toBaseQuantity converts quantity given in unit into base units. An empty
+// unit is the base unit.
+func toBaseQuantity(ctx context.Context, q querier, sku, unit string, quantity int) (int, error) {
+	unit = strings.ToLower(unit)
+	if unit == "" || unit == models.BaseUnit {
+		return quantity, nil
+	}
+
+	var factor int
+	err := q.QueryRowContext(ctx, `SELECT factor FROM product_units WHERE sku = $1 AND unit = $2`, sku, unit).Scan(&factor)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("unit %q is not defined for product %s", unit, sku)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return quantity * factor, nil
+}
+
+// unitLoad returns the volume and weight of quantity packs of unit. Sealed
+// packs are checked at their packed size when it is larger, but never below
+// the base units they hold, since that is what the shelf is charged once
+// the stock is stored.
+func unitLoad(ctx context.Context, q querier, product *models.Product, unit string, quantity int) (volume, weight float64, err error) {
+	unit = strings.ToLower(unit)
+	if unit == "" || unit == models.BaseUnit {
+		return product.Volume * float64(quantity), product.Weight * float64(quantity), nil
+	}
+
+	var factor int
+	err = q.QueryRowContext(ctx, `SELECT factor, volume, weight FROM product_units WHERE sku = $1 AND unit = $2`,
+		product.SKU, unit).Scan(&factor, &volume, &weight)
+	if err == sql.ErrNoRows {
+		return 0, 0, fmt.Errorf("unit %q is not defined for product %s", unit, product.SKU)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	volume = math.Max(volume, product.Volume*float64(factor))
+	weight = math.Max(weight, product.Weight*float64(factor))
+	return volume * float64(quantity), weight * float64(quantity), nil
+}
+
+// describeQuantities fills in each item's quantity broken down by its
+// product's pack hierarchy.
+func describeQuantities(ctx context.Context, q querier, items []models.ShelfItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	skus := make([]string, 0, len(items))
+	for _, item := range items {
+		skus = append(skus, item.SKU)
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT sku, unit, factor
+		FROM product_units
+		WHERE sku = ANY($1)
+		ORDER BY sku, factor DESC
+	`, pq.Array(uniqueStrings(skus)))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	units := make(map[string][]models.ProductUnit)
+	for rows.Next() {
+		var unit models.ProductUnit
+		if err := rows.Scan(&unit.SKU, &unit.Unit, &unit.Factor); err != nil {
+			return err
+		}
+		units[unit.SKU] = append(units[unit.SKU], unit)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range items {
+		items[i].QuantityBreakdown = breakdownQuantity(items[i].Quantity, units[items[i].SKU])
+	}
+
+	return nil
+}
+
+// breakdownQuantity spells quantity out from the largest unit down, given
+// units sorted by descending factor. Levels with nothing in them are left
+// out.
+func breakdownQuantity(quantity int, units []models.ProductUnit) string {
+	var parts []string
+	for _, unit := range units {
+		if count := quantity / unit.Factor; count > 0 {
+			parts = append(parts, strconv.Itoa(count)+" "+pluralUnit(unit.Unit, count))
+			quantity %= unit.Factor
+		}
+	}
+	if quantity > 0 || len(parts) == 0 {
+		parts = append(parts, strconv.Itoa(quantity)+" "+models.BaseUnit)
+	}
+
+	return strings.Join(parts, " + ")
+}
+
+func pluralUnit(unit string, count int) string {
+	if count == 1 {
+		return unit
+	}
+	for _, suffix := range []string{"s", "x", "ch", "sh"} {
+		if strings.HasSuffix(unit, suffix) {
+			return unit + "es"
+		}
+	}
+	return unit + "s"
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 
+	"github.com/aslam/backend/internal/listquery"
 	"github.com/aslam/backend/internal/models"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
@@ -133,28 +134,36 @@ func (d *DB) DeleteUser(ctx context.Context, id string) error {
 	return nil
 }
 
-func (d *DB) ListUsers(ctx context.Context) ([]models.User, error) {
-	query := `
-		SELECT id, email, role, created_at, updated_at
-		FROM users
-		ORDER BY created_at DESC
-	`
+// UserList is what user lists can be sorted and filtered by.
+var UserList = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"id":         {Column: "id", Type: listquery.UUID},
+		"email":      {Column: "email", Type: listquery.String},
+		"role":       {Column: "role", Type: listquery.String},
+		"created_at": {Column: "created_at", Type: listquery.Time},
+		"updated_at": {Column: "updated_at", Type: listquery.Time},
+	},
+	Sort: []listquery.Sort{{Field: "created_at", Desc: true}},
+	Key:  "id",
+}
 
-	rows, err := d.conn.QueryContext(ctx, query)
-	if err != nil {
-		return nil, err
+func (d *DB) ListUsers(ctx context.Context, lq *listquery.Query) ([]models.User, *listquery.Page, error) {
+	if lq == nil {
+		lq = listquery.All(UserList)
 	}
-	defer rows.Close()
 
 	var users []models.User
-	for rows.Next() {
+	page, err := queryPage(ctx, d.conn, lq, `id, email, role, created_at, updated_at`, "users", nil, nil, func(row rowScanner) error {
 		var user models.User
-		err := rows.Scan(&user.ID, &user.Email, &user.Role, &user.CreatedAt, &user.UpdatedAt)
-		if err != nil {
-			return nil, err
+		if err := row.Scan(&user.ID, &user.Email, &user.Role, &user.CreatedAt, &user.UpdatedAt); err != nil {
+			return err
 		}
 		users = append(users, user)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return users, rows.Err()
+	return users, page, nil
 }
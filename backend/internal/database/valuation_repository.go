@@ -0,0 +1,273 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aslam/backend/internal/listquery"
+	"github.com/aslam/backend/internal/models"
+)
+
+// costMovement values a movement that changes the warehouse total and keeps
+// the SKU's moving average and FIFO layers current. Both are maintained for
+// every product, so switching costing methods needs no backfill; the
+// product's method decides which one values outgoing units. Transfers only
+// move stock between shelves and are not costed.
+//
+// The SKU's product_costs row is locked until commit, after the product and
+// shelf locks. Transactions costing several SKUs must do so in SKU order.
+func costMovement(ctx context.Context, q querier, movement *models.StockMovement) error {
+	if movement.Reason == models.MovementTransferOut || movement.Reason == models.MovementTransferIn {
+		return nil
+	}
+
+	_, err := q.ExecContext(ctx, `INSERT INTO product_costs (sku) VALUES ($1) ON CONFLICT DO NOTHING`, movement.SKU)
+	if err != nil {
+		return err
+	}
+
+	var averageCost float64
+	var quantity int
+	var method models.CostingMethod
+	err = q.QueryRowContext(ctx, `
+		SELECT pc.average_cost, pc.quantity, p.costing_method
+		FROM product_costs pc
+		JOIN products p ON p.sku = pc.sku
+		WHERE pc.sku = $1
+		FOR UPDATE OF pc
+	`, movement.SKU).Scan(&averageCost, &quantity, &method)
+	if err != nil {
+		return err
+	}
+
+	if movement.QuantityDelta > 0 {
+		received := movement.QuantityDelta
+		if movement.UnitCost == 0 {
+			movement.UnitCost = averageCost
+		}
+		movement.TotalCost = movement.UnitCost * float64(received)
+
+		if held := max(quantity, 0); held+received > 0 {
+			averageCost = (averageCost*float64(held) + movement.TotalCost) / float64(held+received)
+		}
+		quantity += received
+
+		_, err := q.ExecContext(ctx, `
+			INSERT INTO cost_layers (sku, movement_id, quantity, remaining, unit_cost)
+			VALUES ($1, $2, $3, $3, $4)
+		`, movement.SKU, movement.ID, received, movement.UnitCost)
+		if err != nil {
+			return err
+		}
+	} else {
+		issued := -movement.QuantityDelta
+		fifoCost, err := consumeLayers(ctx, q, movement.SKU, issued, averageCost)
+		if err != nil {
+			return err
+		}
+
+		cost := averageCost * float64(issued)
+		if method == models.CostingFIFO {
+			cost = fifoCost
+		}
+		movement.UnitCost = cost / float64(issued)
+		movement.TotalCost = -cost
+		quantity -= issued
+	}
+
+	_, err = q.ExecContext(ctx, `UPDATE product_costs SET average_cost = $1, quantity = $2 WHERE sku = $3`,
+		averageCost, quantity, movement.SKU)
+	return err
+}
+
+// consumeLayers draws quantity units from the SKU's oldest cost layers and
+// returns their cost. Units beyond what the layers hold are valued at
+// fallback.
+func consumeLayers(ctx context.Context, q querier, sku string, quantity int, fallback float64) (float64, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, remaining, unit_cost
+		FROM cost_layers
+		WHERE sku = $1 AND remaining > 0
+		ORDER BY created_at, id
+	`, sku)
+	if err != nil {
+		return 0, err
+	}
+
+	type layer struct {
+		id        string
+		remaining int
+		unitCost  float64
+	}
+
+	var layers []layer
+	for rows.Next() {
+		var l layer
+		if err := rows.Scan(&l.id, &l.remaining, &l.unitCost); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		layers = append(layers, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	cost := 0.0
+	for _, l := range layers {
+		if quantity == 0 {
+			break
+		}
+
+		take := min(l.remaining, quantity)
+		if _, err := q.ExecContext(ctx, `UPDATE cost_layers SET remaining = remaining - $1 WHERE id = $2`, take, l.id); err != nil {
+			return 0, err
+		}
+		cost += l.unitCost * float64(take)
+		quantity -= take
+	}
+
+	return cost + fallback*float64(quantity), nil
+}
+
+// GetValuation values the stock on the shelves per SKU, per shelf and in
+// total. Shelves are valued at the unit value of each SKU they hold, so the
+// three views always add up.
+func (d *DB) GetValuation(ctx context.Context, filter *models.ValuationFilter) (*models.ValuationReport, error) {
+	query := `
+		SELECT p.sku, p.name, p.costing_method,
+			COALESCE((SELECT SUM(si.quantity) FROM shelf_items si WHERE si.sku = p.sku), 0),
+			COALESCE(pc.average_cost, 0),
+			COALESCE((SELECT SUM(cl.remaining * cl.unit_cost) FROM cost_layers cl WHERE cl.sku = p.sku), 0),
+			COALESCE((SELECT SUM(cl.remaining) FROM cost_layers cl WHERE cl.sku = p.sku), 0)
+		FROM products p
+		LEFT JOIN product_costs pc ON pc.sku = p.sku
+		ORDER BY p.sku
+	`
+
+	rows, err := d.conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &models.ValuationReport{SKUs: []models.SKUValuation{}, Shelves: []models.ShelfValuation{}}
+	unitValues := make(map[string]float64)
+	for rows.Next() {
+		var v models.SKUValuation
+		var averageCost, layerValue float64
+		var layerQuantity int
+		if err := rows.Scan(&v.SKU, &v.Name, &v.Method, &v.OnHand, &averageCost, &layerValue, &layerQuantity); err != nil {
+			return nil, err
+		}
+		if v.OnHand == 0 {
+			continue
+		}
+		if filter.Method != "" {
+			v.Method = filter.Method
+		}
+
+		v.UnitValue = averageCost
+		if v.Method == models.CostingFIFO && layerQuantity > 0 {
+			v.UnitValue = layerValue / float64(layerQuantity)
+		}
+		v.Value = v.UnitValue * float64(v.OnHand)
+
+		unitValues[v.SKU] = v.UnitValue
+		report.TotalValue += v.Value
+		report.SKUs = append(report.SKUs, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	shelfRows, err := d.conn.QueryContext(ctx, `
+		SELECT s.id, s.name, si.sku, SUM(si.quantity)
+		FROM shelf_items si
+		JOIN shelfs s ON s.id = si.shelf_id
+		GROUP BY s.id, s.name, si.sku
+		ORDER BY s.name, s.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer shelfRows.Close()
+
+	for shelfRows.Next() {
+		var shelfID, shelfName, sku string
+		var quantity int
+		if err := shelfRows.Scan(&shelfID, &shelfName, &sku, &quantity); err != nil {
+			return nil, err
+		}
+
+		n := len(report.Shelves)
+		if n == 0 || report.Shelves[n-1].ShelfID != shelfID {
+			report.Shelves = append(report.Shelves, models.ShelfValuation{ShelfID: shelfID, ShelfName: shelfName})
+			n++
+		}
+		report.Shelves[n-1].Value += unitValues[sku] * float64(quantity)
+	}
+
+	return report, shelfRows.Err()
+}
+
+// COGSList is what cost of goods lists can be sorted and filtered by.
+var COGSList = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"sku":      {Column: "c.sku", Type: listquery.String},
+		"quantity": {Column: "c.quantity", Type: listquery.Int},
+		"cost":     {Column: "c.cost", Type: listquery.Number},
+	},
+	Sort: []listquery.Sort{{Field: "sku"}},
+	Key:  "sku",
+}
+
+// ListCOGS totals the cost of goods that left through removals and picks.
+func (d *DB) ListCOGS(ctx context.Context, filter *models.COGSFilter, lq *listquery.Query) ([]models.COGSEntry, *listquery.Page, error) {
+	conditions := []string{"m.reason IN ($1, $2)"}
+	args := []interface{}{models.MovementRemove, models.MovementPick}
+
+	addCondition := func(clause string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(clause, len(args)))
+	}
+
+	if filter.SKU != "" {
+		addCondition("m.sku = $%d", filter.SKU)
+	}
+	if !filter.From.IsZero() {
+		addCondition("m.created_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("m.created_at <= $%d", filter.To)
+	}
+
+	if lq == nil {
+		lq = listquery.All(COGSList)
+	}
+
+	// Entries are per-SKU totals, so the list pages over the grouped rows
+	from := `(
+		SELECT m.sku, -SUM(m.quantity_delta) AS quantity, -SUM(m.total_cost) AS cost
+		FROM stock_movements m
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		GROUP BY m.sku
+	) c`
+
+	var entries []models.COGSEntry
+	page, err := queryPage(ctx, d.conn, lq, "c.sku, c.quantity, c.cost", from, nil, args, func(row rowScanner) error {
+		var entry models.COGSEntry
+		if err := row.Scan(&entry.SKU, &entry.Quantity, &entry.Cost); err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return entries, page, nil
+}
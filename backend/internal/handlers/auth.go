@@ -140,7 +140,12 @@ func ListUsers(db *database.DB) gin.HandlerFunc {
 			return
 		}
 
-		users, err := db.ListUsers(c.Request.Context())
+		lq, ok := bindList(c, database.UserList)
+		if !ok {
+			return
+		}
+
+		users, page, err := db.ListUsers(c.Request.Context(), lq)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -155,7 +160,7 @@ func ListUsers(db *database.DB) gin.HandlerFunc {
 			}
 		}
 
-		c.JSON(http.StatusOK, gin.H{"users": response})
+		c.JSON(http.StatusOK, listResponse("users", response, page))
 	}
 }
 
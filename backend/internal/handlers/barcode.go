@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/aslam/backend/internal/database"
+	"github.com/aslam/backend/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+func ListBarcodes(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lq, ok := bindList(c, database.BarcodeList)
+		if !ok {
+			return
+		}
+
+		barcodes, page, err := db.ListBarcodes(c.Request.Context(), c.Param("sku"), lq)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, listResponse("barcodes", barcodes, page))
+	}
+}
+
+func AddBarcode(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Only editor and admin can assign barcodes
+		userRole, exists := c.Get("user_role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			return
+		}
+
+		if userRole != "editor" && userRole != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			return
+		}
+
+		var req models.AddBarcodeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		barcode, err := db.AddBarcode(c.Request.Context(), c.Param("sku"), &req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, barcode)
+	}
+}
+
+func DeleteBarcode(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Only editor and admin can remove barcodes
+		userRole, exists := c.Get("user_role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			return
+		}
+
+		if userRole != "editor" && userRole != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			return
+		}
+
+		err := db.DeleteBarcode(c.Request.Context(), c.Param("sku"), c.Param("code"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "barcode deleted successfully"})
+	}
+}
+
+func Scan(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := db.Scan(c.Request.Context(), c.Param("code"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
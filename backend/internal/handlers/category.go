@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/aslam/backend/internal/database"
+	"github.com/aslam/backend/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// ListCategories answers with the whole tree rather than a page, since
+// paging would cut subtrees apart from their roll-ups.
+func ListCategories(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		categories, err := db.ListCategories(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"categories": categories})
+	}
+}
+
+func GetCategory(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		category, err := db.GetCategory(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, category)
+	}
+}
+
+func CreateCategory(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Only editor and admin can manage categories
+		userRole, exists := c.Get("user_role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			return
+		}
+
+		if userRole != "editor" && userRole != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			return
+		}
+
+		var req models.CreateCategoryRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		category, err := db.CreateCategory(c.Request.Context(), &req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, category)
+	}
+}
+
+func RenameCategory(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Only editor and admin can manage categories
+		userRole, exists := c.Get("user_role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			return
+		}
+
+		if userRole != "editor" && userRole != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			return
+		}
+
+		var req models.RenameCategoryRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		category, err := db.RenameCategory(c.Request.Context(), c.Param("id"), &req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, category)
+	}
+}
+
+func MoveCategory(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Only editor and admin can manage categories
+		userRole, exists := c.Get("user_role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			return
+		}
+
+		if userRole != "editor" && userRole != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			return
+		}
+
+		var req models.MoveCategoryRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		category, err := db.MoveCategory(c.Request.Context(), c.Param("id"), &req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, category)
+	}
+}
+
+func DeleteCategory(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Only admin can delete categories
+		userRole, exists := c.Get("user_role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			return
+		}
+
+		if userRole != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only admin can delete categories"})
+			return
+		}
+
+		if err := db.DeleteCategory(c.Request.Context(), c.Param("id")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "category deleted successfully"})
+	}
+}
+
+// ListAttributes answers with the category's whole resolved schema rather
+// than a page: inherited definitions are merged down the tree, and products
+// are validated against all of them at once.
+func ListAttributes(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		attributes, err := db.ListAttributes(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"attributes": attributes})
+	}
+}
+
+func SetAttributes(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Only editor and admin can manage categories
+		userRole, exists := c.Get("user_role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			return
+		}
+
+		if userRole != "editor" && userRole != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			return
+		}
+
+		var req models.SetAttributesRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		attributes, err := db.SetAttributes(c.Request.Context(), c.Param("id"), &req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"attributes": attributes})
+	}
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/aslam/backend/internal/database"
+	"github.com/aslam/backend/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+func CreateCountSession(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Only editor and admin can start counts
+		userRole, exists := c.Get("user_role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			return
+		}
+
+		if userRole != "editor" && userRole != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			return
+		}
+
+		var req models.CreateCountRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		session, err := db.CreateCountSession(actorContext(c), &req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, session)
+	}
+}
+
+func ListCountSessions(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lq, ok := bindList(c, database.CountSessionList)
+		if !ok {
+			return
+		}
+
+		status := models.CountStatus(c.Query("status"))
+		sessions, page, err := db.ListCountSessions(c.Request.Context(), status, lq)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, listResponse("sessions", sessions, page))
+	}
+}
+
+func GetCountSession(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session, err := db.GetCountSession(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, session)
+	}
+}
+
+func SubmitCounts(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Only editor and admin can submit counts
+		userRole, exists := c.Get("user_role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			return
+		}
+
+		if userRole != "editor" && userRole != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			return
+		}
+
+		var req models.SubmitCountsRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		session, err := db.SubmitCounts(actorContext(c), c.Param("id"), &req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, session)
+	}
+}
+
+func ApproveCount(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Only admin can approve variances
+		userRole, exists := c.Get("user_role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			return
+		}
+
+		if userRole != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only admin can approve count variances"})
+			return
+		}
+
+		var req models.ApproveCountRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		session, err := db.ApproveCount(actorContext(c), c.Param("id"), &req)
+		if err != nil {
+			respondMutationError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, session)
+	}
+}
+
+func CancelCount(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Only editor and admin can cancel counts
+		userRole, exists := c.Get("user_role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			return
+		}
+
+		if userRole != "editor" && userRole != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			return
+		}
+
+		session, err := db.CancelCount(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, session)
+	}
+}
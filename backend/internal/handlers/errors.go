@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/aslam/backend/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+// respondMutationError reports a failed stock mutation, spelling out which
+// shelves would overflow when the capacity rule rejected it.
+func respondMutationError(c *gin.Context, err error) {
+	var capacityErr *database.CapacityError
+	if errors.As(err, &capacityErr) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   capacityErr.Error(),
+			"shelves": capacityErr.Shelves,
+		})
+		return
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// allowForce rejects capacity overrides from anyone but an admin.
+func allowForce(c *gin.Context, force bool) bool {
+	if force && c.GetString("user_role") != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admin can force capacity overrides"})
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/aslam/backend/internal/database"
+	"github.com/aslam/backend/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+func CreateInboundDocument(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Only editor and admin can create inbound documents
+		userRole, exists := c.Get("user_role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			return
+		}
+
+		if userRole != "editor" && userRole != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			return
+		}
+
+		var req models.CreateInboundRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		document, err := db.CreateInboundDocument(actorContext(c), &req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, document)
+	}
+}
+
+func ListInboundDocuments(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lq, ok := bindList(c, database.InboundList)
+		if !ok {
+			return
+		}
+
+		status := models.InboundStatus(c.Query("status"))
+		documents, page, err := db.ListInboundDocuments(c.Request.Context(), status, lq)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, listResponse("documents", documents, page))
+	}
+}
+
+func GetInboundDocument(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		document, err := db.GetInboundDocument(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, document)
+	}
+}
+
+func ReceiveInbound(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Only editor and admin can receive goods
+		userRole, exists := c.Get("user_role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			return
+		}
+
+		if userRole != "editor" && userRole != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			return
+		}
+
+		var req models.ReceiveRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		document, err := db.ReceiveInbound(actorContext(c), c.Param("id"), &req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, document)
+	}
+}
+
+func CloseInbound(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Only editor and admin can close inbound documents
+		userRole, exists := c.Get("user_role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			return
+		}
+
+		if userRole != "editor" && userRole != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			return
+		}
+
+		document, err := db.CloseInbound(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, document)
+	}
+}
+
+func ListStagedItems(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lq, ok := bindList(c, database.StagedItemList)
+		if !ok {
+			return
+		}
+
+		items, page, err := db.ListStagedItems(c.Request.Context(), c.Query("document_id"), lq)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, listResponse("items", items, page))
+	}
+}
+
+func PutawayStagedItem(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Only editor and admin can put stock away
+		userRole, exists := c.Get("user_role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			return
+		}
+
+		if userRole != "editor" && userRole != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			return
+		}
+
+		var req models.PutawayRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !allowForce(c, req.Force) {
+			return
+		}
+
+		item, err := db.PutawayStagedItem(actorContext(c), c.Param("id"), &req)
+		if err != nil {
+			respondMutationError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, item)
+	}
+}
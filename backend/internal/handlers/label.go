@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/aslam/backend/internal/database"
+	"github.com/aslam/backend/internal/label"
+	"github.com/aslam/backend/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// productLabel shows the SKU and name over the product's first barcode, or
+// over the SKU itself when it has none.
+func productLabel(product *models.Product, symbology label.Symbology) label.Label {
+	code := product.SKU
+	if len(product.Barcodes) > 0 {
+		code = product.Barcodes[0]
+	}
+
+	return label.Label{
+		Lines:     []string{product.SKU, product.Name, code},
+		Code:      code,
+		Symbology: symbology,
+	}
+}
+
+// shelfLabel shows the shelf's name and grid position over its scan code.
+func shelfLabel(shelf *models.Shelf, symbology label.Symbology) label.Label {
+	return label.Label{
+		Lines:     []string{shelf.Name, fmt.Sprintf("Row %d / Col %d", shelf.RowIndex, shelf.ColIndex)},
+		Code:      models.ShelfLabelPrefix + shelf.ID,
+		Symbology: symbology,
+	}
+}
+
+// renderLabels writes labels in the requested format.
+func renderLabels(c *gin.Context, query models.LabelQuery, labels []label.Label) {
+	format := label.Format(query.Format)
+	if format == "" {
+		format = label.SVG
+	}
+
+	data, err := label.Render(format, labels)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Data(http.StatusOK, label.ContentType(format), data)
+}
+
+func symbologyOr(query models.LabelQuery, fallback label.Symbology) label.Symbology {
+	if query.Symbology == "" {
+		return fallback
+	}
+	return label.Symbology(query.Symbology)
+}
+
+func GetProductLabel(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var query models.LabelQuery
+		if err := c.ShouldBindQuery(&query); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		product, err := db.GetProductBySKU(c.Request.Context(), c.Param("sku"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		renderLabels(c, query, []label.Label{productLabel(product, symbologyOr(query, label.Code128))})
+	}
+}
+
+func GetShelfLabel(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var query models.LabelQuery
+		if err := c.ShouldBindQuery(&query); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		shelf, err := db.GetShelfByID(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		s := &models.Shelf{ID: shelf.ID, Name: shelf.Name, RowIndex: shelf.RowIndex, ColIndex: shelf.ColIndex}
+		renderLabels(c, query, []label.Label{shelfLabel(s, symbologyOr(query, label.QR))})
+	}
+}
+
+func GetShelfLabels(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var query models.ShelfLabelsQuery
+		if err := c.ShouldBindQuery(&query); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if query.ToRow-query.FromRow >= models.MaxLabelRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d rows of labels can be printed at once", models.MaxLabelRows)})
+			return
+		}
+
+		shelves, err := db.ListShelvesInRows(c.Request.Context(), query.FromRow, query.ToRow)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(shelves) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no shelves in the given rows"})
+			return
+		}
+
+		symbology := symbologyOr(query.LabelQuery, label.QR)
+		labels := make([]label.Label, 0, len(shelves))
+		for i := range shelves {
+			labels = append(labels, shelfLabel(&shelves[i], symbology))
+		}
+
+		renderLabels(c, query.LabelQuery, labels)
+	}
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/aslam/backend/internal/listquery"
+	"github.com/gin-gonic/gin"
+)
+
+// bindList reads the paging, sort and filter parameters of a list request,
+// answering with 400 itself when they are invalid.
+func bindList(c *gin.Context, spec listquery.Spec) (*listquery.Query, bool) {
+	lq, err := listquery.Parse(c.Request.URL.Query(), spec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return lq, true
+}
+
+// listResponse keeps the items under the key the list has always used,
+// next to the cursor of the following page and the total.
+func listResponse(key string, items interface{}, page *listquery.Page) gin.H {
+	return gin.H{key: items, "next_cursor": page.NextCursor, "total": page.Total}
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/aslam/backend/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+func ListExpiringStock(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+		if err != nil || days < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be a non-negative integer"})
+			return
+		}
+
+		lq, ok := bindList(c, database.ExpiringStockList)
+		if !ok {
+			return
+		}
+
+		items, page, err := db.ListExpiringStock(c.Request.Context(), days, lq)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, listResponse("items", items, page))
+	}
+}
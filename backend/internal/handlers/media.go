@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/aslam/backend/internal/database"
+	"github.com/aslam/backend/internal/imaging"
+	"github.com/aslam/backend/internal/models"
+	"github.com/aslam/backend/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// MaxMediaSize caps uploaded files, in bytes.
+const MaxMediaSize = 20 << 20
+
+// mediaTypes maps the content types accepted for each kind of media, as
+// sniffed from the file itself, to the extension files are stored under.
+var mediaTypes = map[models.MediaKind]map[string]string{
+	models.MediaImage: {
+		"image/jpeg": ".jpg",
+		"image/png":  ".png",
+		"image/gif":  ".gif",
+	},
+	models.MediaDocument: {
+		"application/pdf": ".pdf",
+	},
+}
+
+func ListMedia(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lq, ok := bindList(c, database.MediaList)
+		if !ok {
+			return
+		}
+
+		media, page, err := db.ListMedia(c.Request.Context(), c.Param("sku"), lq)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, listResponse("media", media, page))
+	}
+}
+
+// UploadMedia stores an image or document sent as multipart/form-data and
+// attaches it to the product. Images also get a JPEG thumbnail.
+func UploadMedia(db *database.DB, store storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Only editor and admin can upload media
+		userRole, exists := c.Get("user_role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			return
+		}
+
+		if userRole != "editor" && userRole != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			return
+		}
+
+		ctx := c.Request.Context()
+		sku := c.Param("sku")
+		if _, err := db.GetProductBySKU(ctx, sku); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Leave room for the rest of the form around the file
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MaxMediaSize+1<<20)
+
+		var req models.UploadMediaRequest
+		if err := c.ShouldBind(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		header, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "a file is required"})
+			return
+		}
+		if header.Size > MaxMediaSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file is larger than 20 MB"})
+			return
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer file.Close()
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Trust the content, not the name or the type the client claims
+		contentType := http.DetectContentType(data)
+		ext, ok := mediaTypes[req.Kind][contentType]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported file type " + contentType + " for " + string(req.Kind)})
+			return
+		}
+
+		id := uuid.New().String()
+		media := &models.ProductMedia{
+			ID:          id,
+			SKU:         sku,
+			Kind:        req.Kind,
+			Filename:    filepath.Base(header.Filename),
+			ContentType: contentType,
+			Size:        int64(len(data)),
+			StorageKey:  "products/" + id + ext,
+		}
+
+		var thumbnail []byte
+		if req.Kind == models.MediaImage {
+			thumbnail, err = imaging.Thumbnail(bytes.NewReader(data), imaging.ThumbnailSize)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "cannot read image: " + err.Error()})
+				return
+			}
+			media.ThumbnailKey = "products/" + id + "_thumb.jpg"
+		}
+
+		if err := store.Put(ctx, media.StorageKey, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store file"})
+			return
+		}
+		media.URL = store.URL(media.StorageKey)
+
+		if thumbnail != nil {
+			if err := store.Put(ctx, media.ThumbnailKey, bytes.NewReader(thumbnail), int64(len(thumbnail)), "image/jpeg"); err != nil {
+				removeMedia(ctx, store, media)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store thumbnail"})
+				return
+			}
+			media.ThumbnailURL = store.URL(media.ThumbnailKey)
+		}
+
+		created, err := db.AddMedia(ctx, media)
+		if err != nil {
+			removeMedia(ctx, store, media)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, created)
+	}
+}
+
+func DeleteMedia(db *database.DB, store storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Only editor and admin can remove media
+		userRole, exists := c.Get("user_role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			return
+		}
+
+		if userRole != "editor" && userRole != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			return
+		}
+
+		media, err := db.DeleteMedia(c.Request.Context(), c.Param("sku"), c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		removeMedia(c.Request.Context(), store, media)
+		c.JSON(http.StatusOK, gin.H{"message": "media deleted successfully"})
+	}
+}
+
+// ServeMedia hands out stored files for drivers whose URLs point back at
+// the server. It is public, as browsers load images without credentials;
+// keys are random, so files cannot be enumerated.
+func ServeMedia(store storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimPrefix(c.Param("key"), "/")
+
+		file, contentType, err := store.Get(c.Request.Context(), key)
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "media not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer file.Close()
+
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+		c.DataFromReader(http.StatusOK, -1, contentType, file, nil)
+	}
+}
+
+// removeMedia deletes the stored files of media. The record is already
+// gone, so failures only leave orphaned files behind and are logged.
+func removeMedia(ctx context.Context, store storage.Storage, media *models.ProductMedia) {
+	for _, key := range []string{media.StorageKey, media.ThumbnailKey} {
+		if key == "" {
+			continue
+		}
+		if err := store.Delete(ctx, key); err != nil {
+			log.Printf("media cleanup for %s: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/aslam/backend/internal/database"
+	"github.com/aslam/backend/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// actorContext returns the request context tagged with the authenticated
+// user, so the database layer can attribute stock movements.
+func actorContext(c *gin.Context) context.Context {
+	userID, _ := c.Get("user_id")
+	id, _ := userID.(string)
+	return database.WithActor(c.Request.Context(), id)
+}
+
+func ListMovements(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var filter models.MovementFilter
+		if err := c.ShouldBindQuery(&filter); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		lq, ok := bindList(c, database.MovementList)
+		if !ok {
+			return
+		}
+
+		movements, page, err := db.ListMovements(c.Request.Context(), &filter, lq)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, listResponse("movements", movements, page))
+	}
+}
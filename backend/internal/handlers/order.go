@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/aslam/backend/internal/database"
+	"github.com/aslam/backend/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+func CreateOrder(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Only editor and admin can create orders
+		userRole, exists := c.Get("user_role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			return
+		}
+
+		if userRole != "editor" && userRole != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			return
+		}
+
+		var req models.CreateOrderRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		order, err := db.CreateOrder(actorContext(c), &req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, order)
+	}
+}
+
+func ListOrders(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lq, ok := bindList(c, database.OrderList)
+		if !ok {
+			return
+		}
+
+		status := models.OrderStatus(c.Query("status"))
+		orders, page, err := db.ListOrders(c.Request.Context(), status, lq)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, listResponse("orders", orders, page))
+	}
+}
+
+func GetOrder(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		order, err := db.GetOrder(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+func CreatePicklist(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Only editor and admin can allocate stock
+		userRole, exists := c.Get("user_role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			return
+		}
+
+		if userRole != "editor" && userRole != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			return
+		}
+
+		order, err := db.CreatePicklist(actorContext(c), c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+func ConfirmPicks(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Only editor and admin can confirm picks
+		userRole, exists := c.Get("user_role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			return
+		}
+
+		if userRole != "editor" && userRole != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			return
+		}
+
+		// An empty body confirms every pending step
+		var req models.ConfirmPicksRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		order, err := db.ConfirmPicks(actorContext(c), c.Param("id"), &req)
+		if err != nil {
+			respondMutationError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+func CancelOrder(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Only editor and admin can cancel orders
+		userRole, exists := c.Get("user_role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			return
+		}
+
+		if userRole != "editor" && userRole != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			return
+		}
+
+		order, err := db.CancelOrder(actorContext(c), c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, order)
+	}
+}
@@ -53,13 +53,43 @@ func GetProduct(db *database.DB) gin.HandlerFunc {
 
 func ListProducts(db *database.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		products, err := db.ListProducts(c.Request.Context())
+		var filter models.ProductFilter
+		if err := c.ShouldBindQuery(&filter); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		filter.Attributes = c.QueryMap("attr")
+
+		lq, ok := bindList(c, database.ProductList)
+		if !ok {
+			return
+		}
+
+		products, page, err := db.ListProducts(c.Request.Context(), &filter, lq)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"products": products})
+		c.JSON(http.StatusOK, listResponse("products", products, page))
+	}
+}
+
+func SearchProducts(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var query models.ProductSearchQuery
+		if err := c.ShouldBindQuery(&query); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		results, err := db.SearchProducts(c.Request.Context(), &query)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"products": results})
 	}
 }
 
@@ -84,7 +114,37 @@ func UpdateProduct(db *database.DB) gin.HandlerFunc {
 			return
 		}
 
+		if !allowForce(c, req.Force) {
+			return
+		}
+
 		product, err := db.UpdateProduct(c.Request.Context(), sku, &req)
+		if err != nil {
+			respondMutationError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, product)
+	}
+}
+
+// ArchiveProduct takes a product out of use. Archived products keep their
+// history but leave the product lists and take no new stock.
+func ArchiveProduct(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Only admin can archive products
+		userRole, exists := c.Get("user_role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			return
+		}
+
+		if userRole != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only admin can archive products"})
+			return
+		}
+
+		product, err := db.ArchiveProduct(actorContext(c), c.Param("sku"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
@@ -94,9 +154,9 @@ func UpdateProduct(db *database.DB) gin.HandlerFunc {
 	}
 }
 
-func DeleteProduct(db *database.DB) gin.HandlerFunc {
+func RestoreProduct(db *database.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Only admin can delete products
+		// Only admin can restore products
 		userRole, exists := c.Get("user_role")
 		if !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
@@ -104,17 +164,16 @@ func DeleteProduct(db *database.DB) gin.HandlerFunc {
 		}
 
 		if userRole != "admin" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "only admin can delete products"})
+			c.JSON(http.StatusForbidden, gin.H{"error": "only admin can restore products"})
 			return
 		}
 
-		sku := c.Param("sku")
-		err := db.DeleteProduct(c.Request.Context(), sku)
+		product, err := db.RestoreProduct(c.Request.Context(), c.Param("sku"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "product deleted successfully"})
+		c.JSON(http.StatusOK, product)
 	}
 }
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/aslam/backend/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+func GetSerial(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serial := c.Param("serial")
+		lookup, err := db.GetSerial(c.Request.Context(), serial)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, lookup)
+	}
+}
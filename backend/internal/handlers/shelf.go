@@ -53,13 +53,24 @@ func GetShelf(db *database.DB) gin.HandlerFunc {
 
 func ListShelves(db *database.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		shelves, err := db.ListShelfs(c.Request.Context())
+		var filter models.ShelfFilter
+		if err := c.ShouldBindQuery(&filter); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		lq, ok := bindList(c, database.ShelfList)
+		if !ok {
+			return
+		}
+
+		shelves, page, err := db.ListShelfs(c.Request.Context(), &filter, lq)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"shelves": shelves})
+		c.JSON(http.StatusOK, listResponse("shelves", shelves, page))
 	}
 }
 
@@ -84,7 +95,37 @@ func UpdateShelf(db *database.DB) gin.HandlerFunc {
 			return
 		}
 
+		if !allowForce(c, req.Force) {
+			return
+		}
+
 		shelf, err := db.UpdateShelf(c.Request.Context(), id, &req)
+		if err != nil {
+			respondMutationError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, shelf)
+	}
+}
+
+// ArchiveShelf takes an empty shelf out of use. Stock on the shelf has to be
+// transferred elsewhere first.
+func ArchiveShelf(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Only admin can archive shelves
+		userRole, exists := c.Get("user_role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			return
+		}
+
+		if userRole != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only admin can archive shelves"})
+			return
+		}
+
+		shelf, err := db.ArchiveShelf(actorContext(c), c.Param("id"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
@@ -94,9 +135,9 @@ func UpdateShelf(db *database.DB) gin.HandlerFunc {
 	}
 }
 
-func DeleteShelf(db *database.DB) gin.HandlerFunc {
+func RestoreShelf(db *database.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Only admin can delete shelves
+		// Only admin can restore shelves
 		userRole, exists := c.Get("user_role")
 		if !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
@@ -104,18 +145,17 @@ func DeleteShelf(db *database.DB) gin.HandlerFunc {
 		}
 
 		if userRole != "admin" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "only admin can delete shelves"})
+			c.JSON(http.StatusForbidden, gin.H{"error": "only admin can restore shelves"})
 			return
 		}
 
-		id := c.Param("id")
-		err := db.DeleteShelf(c.Request.Context(), id)
+		shelf, err := db.RestoreShelf(c.Request.Context(), c.Param("id"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "shelf deleted successfully"})
+		c.JSON(http.StatusOK, shelf)
 	}
 }
 
@@ -140,9 +180,13 @@ func AddItemToShelf(db *database.DB) gin.HandlerFunc {
 			return
 		}
 
-		item, err := db.AddItemToShelf(c.Request.Context(), shelfID, req.SKU, req.Quantity)
+		if !allowForce(c, req.Force) {
+			return
+		}
+
+		item, err := db.AddItemToShelf(actorContext(c), shelfID, &req)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondMutationError(c, err)
 			return
 		}
 
@@ -165,7 +209,7 @@ func RemoveItemFromShelf(db *database.DB) gin.HandlerFunc {
 		}
 
 		itemID := c.Param("itemId")
-		err := db.RemoveItemFromShelf(c.Request.Context(), itemID)
+		err := db.RemoveItemFromShelf(actorContext(c), itemID)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
@@ -190,18 +234,19 @@ func UpdateItemQuantity(db *database.DB) gin.HandlerFunc {
 		}
 
 		itemID := c.Param("itemId")
-		var req struct {
-			Quantity int `json:"quantity" binding:"required,gt=0"`
-		}
-
+		var req models.UpdateItemQuantityRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		err := db.UpdateItemQuantity(c.Request.Context(), itemID, req.Quantity)
+		if !allowForce(c, req.Force) {
+			return
+		}
+
+		err := db.UpdateItemQuantity(actorContext(c), itemID, &req)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondMutationError(c, err)
 			return
 		}
 
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/aslam/backend/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+func ListBelowReorder(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lq, ok := bindList(c, database.ReorderList)
+		if !ok {
+			return
+		}
+
+		suggestions, page, err := db.ListBelowReorder(c.Request.Context(), lq)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, listResponse("products", suggestions, page))
+	}
+}
+
+func ListStockAlerts(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lq, ok := bindList(c, database.StockAlertList)
+		if !ok {
+			return
+		}
+
+		// Only open alerts unless ?all=true
+		alerts, page, err := db.ListStockAlerts(c.Request.Context(), c.Query("all") == "true", lq)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, listResponse("alerts", alerts, page))
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/aslam/backend/internal/database"
+	"github.com/aslam/backend/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+func GetValuation(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var filter models.ValuationFilter
+		if err := c.ShouldBindQuery(&filter); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		report, err := db.GetValuation(c.Request.Context(), &filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+func ListCOGS(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var filter models.COGSFilter
+		if err := c.ShouldBindQuery(&filter); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		lq, ok := bindList(c, database.COGSList)
+		if !ok {
+			return
+		}
+
+		entries, page, err := db.ListCOGS(c.Request.Context(), &filter, lq)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, listResponse("cogs", entries, page))
+	}
+}
@@ -0,0 +1,97 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+
+	// Registered so image.Decode understands the upload formats
+	_ "image/gif"
+	_ "image/png"
+)
+
+// ThumbnailSize bounds the longer side of thumbnails, in pixels.
+const ThumbnailSize = 256
+
+// MaxPixels bounds the decoded size of source images. A small, highly
+// compressed file can declare dimensions that would take gigabytes to
+// decode, so the declared size is checked before any pixels are read.
+const MaxPixels = 40_000_000
+
+// Thumbnail decodes a JPEG, PNG or GIF image and returns it as a JPEG no
+// larger than size pixels on either side, keeping its aspect ratio.
+// Transparent areas are flattened onto white, since JPEG has no alpha.
+// Images already small enough are re-encoded but not enlarged. Images
+// larger than MaxPixels are rejected.
+func Thumbnail(r io.Reader, size int) ([]byte, error) {
+	// The header read by DecodeConfig is replayed for the full decode
+	var header bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(r, &header))
+	if err != nil {
+		return nil, err
+	}
+	if int64(config.Width)*int64(config.Height) > MaxPixels {
+		return nil, fmt.Errorf("image is %dx%d pixels, more than the %d megapixels allowed",
+			config.Width, config.Height, MaxPixels/1_000_000)
+	}
+
+	src, _, err := image.Decode(io.MultiReader(&header, r))
+	if err != nil {
+		return nil, err
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, max(1, h*size/w)
+		} else {
+			w, h = max(1, w*size/h), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		// Each destination pixel averages the block of source pixels it
+		// covers, which is enough for downscaling by large factors
+		y0 := b.Min.Y + y*b.Dy()/h
+		y1 := max(y0+1, b.Min.Y+(y+1)*b.Dy()/h)
+		for x := 0; x < w; x++ {
+			x0 := b.Min.X + x*b.Dx()/w
+			x1 := max(x0+1, b.Min.X+(x+1)*b.Dx()/w)
+			dst.Set(x, y, average(src, x0, y0, x1, y1))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// average returns the mean color of the block, composited over white.
+func average(src image.Image, x0, y0, x1, y1 int) color.RGBA {
+	var r, g, b, n uint64
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			// Premultiplied, so adding the missing coverage as white
+			// flattens the pixel onto a white background
+			pr, pg, pb, pa := src.At(x, y).RGBA()
+			r += uint64(pr + 0xffff - pa)
+			g += uint64(pg + 0xffff - pa)
+			b += uint64(pb + 0xffff - pa)
+			n++
+		}
+	}
+
+	return color.RGBA{
+		R: uint8(r / n >> 8),
+		G: uint8(g / n >> 8),
+		B: uint8(b / n >> 8),
+		A: 0xff,
+	}
+}
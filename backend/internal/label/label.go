@@ -0,0 +1,189 @@
+package label
+
+import (
+	"fmt"
+
+	"github.com/aslam/backend/internal/barcode"
+)
+
+type Symbology string
+
+const (
+	Code128 Symbology = "code128"
+	QR      Symbology = "qr"
+)
+
+type Format string
+
+const (
+	SVG Format = "svg"
+	PNG Format = "png"
+	ZPL Format = "zpl"
+)
+
+// Label is one printed label: lines of text above a barcode. The first line
+// is printed larger, as the label's title.
+type Label struct {
+	Lines     []string
+	Code      string
+	Symbology Symbology
+}
+
+// Labels are laid out in printer dots for a 4x2 inch label at 203 dpi, the
+// common thermal size; SVG and PNG use the same coordinates one pixel per
+// dot.
+const (
+	Width  = 812
+	Height = 406
+
+	margin      = 24
+	titleSize   = 40
+	lineSize    = 28
+	lineSpacing = 8
+	barHeight   = 160
+
+	// Quiet zones in modules, as the symbologies require
+	code128Quiet = 10
+	qrQuiet      = 4
+)
+
+// MaxLabels bounds one render. PNG sheets hold every label in a single
+// image, so the limit also bounds its memory.
+const MaxLabels = 100
+
+// ContentType returns the MIME type of rendered labels in format.
+func ContentType(format Format) string {
+	switch format {
+	case PNG:
+		return "image/png"
+	case ZPL:
+		return "application/zpl"
+	default:
+		return "image/svg+xml"
+	}
+}
+
+// Render draws labels in format. Several labels are stacked top to bottom
+// in one image, or follow each other as separate ZPL formats.
+func Render(format Format, labels []Label) ([]byte, error) {
+	if len(labels) == 0 {
+		return nil, fmt.Errorf("no labels to render")
+	}
+	if len(labels) > MaxLabels {
+		return nil, fmt.Errorf("cannot render %d labels at once; the limit is %d", len(labels), MaxLabels)
+	}
+
+	layouts := make([]*layout, 0, len(labels))
+	for _, l := range labels {
+		lay, err := newLayout(l)
+		if err != nil {
+			return nil, err
+		}
+		layouts = append(layouts, lay)
+	}
+
+	switch format {
+	case SVG:
+		return renderSVG(layouts), nil
+	case PNG:
+		return renderPNG(layouts)
+	case ZPL:
+		return renderZPL(layouts), nil
+	default:
+		return nil, fmt.Errorf("unknown label format %q", format)
+	}
+}
+
+type text struct {
+	x, y, size int
+	value      string
+}
+
+type rect struct {
+	x, y, w, h int
+}
+
+// layout is a label resolved into positioned text and dark rectangles, with
+// the barcode's placement kept for printers that draw barcodes natively.
+type layout struct {
+	label Label
+	texts []text
+	bars  []rect
+
+	codeX, codeY int
+	module       int
+	codeHeight   int
+}
+
+func newLayout(l Label) (*layout, error) {
+	lay := &layout{label: l}
+
+	y := margin
+	for i, line := range l.Lines {
+		size := lineSize
+		if i == 0 {
+			size = titleSize
+		}
+		lay.texts = append(lay.texts, text{x: margin, y: y, size: size, value: fitLine(line, size)})
+		y += size + lineSpacing
+	}
+
+	available := Height - margin - y
+	switch l.Symbology {
+	case QR:
+		matrix, err := barcode.EncodeQR(l.Code)
+		if err != nil {
+			return nil, err
+		}
+		size := len(matrix) + 2*qrQuiet
+		lay.module = max(1, min(available, Width-2*margin)/size)
+		lay.codeX, lay.codeY = margin, y
+		lay.codeHeight = size * lay.module
+
+		for row, modules := range matrix {
+			lay.addRuns(modules, lay.codeX+qrQuiet*lay.module, lay.codeY+(qrQuiet+row)*lay.module, lay.module)
+		}
+	case Code128:
+		modules, err := barcode.EncodeCode128(l.Code)
+		if err != nil {
+			return nil, err
+		}
+		size := len(modules) + 2*code128Quiet
+		lay.module = max(1, min(4, (Width-2*margin)/size))
+		lay.codeX, lay.codeY = margin, y
+		lay.codeHeight = min(barHeight, available)
+
+		lay.addRuns(modules, lay.codeX+code128Quiet*lay.module, lay.codeY, lay.codeHeight)
+	default:
+		return nil, fmt.Errorf("unknown symbology %q", l.Symbology)
+	}
+
+	return lay, nil
+}
+
+// addRuns adds one rectangle per run of dark modules, starting at x, y and
+// h dots tall.
+func (lay *layout) addRuns(modules []bool, x, y, h int) {
+	for i := 0; i < len(modules); {
+		if !modules[i] {
+			i++
+			continue
+		}
+		start := i
+		for i < len(modules) && modules[i] {
+			i++
+		}
+		lay.bars = append(lay.bars, rect{x: x + start*lay.module, y: y, w: (i - start) * lay.module, h: h})
+	}
+}
+
+// fitLine cuts line to what fits across the label at size, in the PNG
+// font's advance, which is also close to a monospace font's.
+func fitLine(line string, size int) string {
+	maxChars := (Width - 2*margin) / (glyphAdvance * glyphScale(size))
+	runes := []rune(line)
+	if len(runes) <= maxChars {
+		return line
+	}
+	return string(runes[:maxChars-3]) + "..."
+}
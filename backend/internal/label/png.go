@@ -0,0 +1,53 @@
+package label
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/png"
+	"unicode"
+)
+
+func renderPNG(layouts []*layout) ([]byte, error) {
+	img := image.NewGray(image.Rect(0, 0, Width, Height*len(layouts)))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	for i, lay := range layouts {
+		top := i * Height
+		for _, t := range lay.texts {
+			drawText(img, t.x, top+t.y, t.size, t.value)
+		}
+		for _, r := range lay.bars {
+			draw.Draw(img, image.Rect(r.x, top+r.y, r.x+r.w, top+r.y+r.h), image.Black, image.Point{}, draw.Src)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// drawText draws value with its top left corner at x, y in the built-in
+// bitmap font, scaled to size dots tall.
+func drawText(img *image.Gray, x, y, size int, value string) {
+	scale := glyphScale(size)
+	for _, r := range value {
+		glyph, ok := glyphs[unicode.ToUpper(r)]
+		if !ok {
+			glyph = glyphs['?']
+		}
+
+		for row, bits := range glyph {
+			for col := 0; col < glyphWidth; col++ {
+				if bits&(1<<(glyphWidth-1-col)) == 0 {
+					continue
+				}
+				px, py := x+col*scale, y+row*scale
+				draw.Draw(img, image.Rect(px, py, px+scale, py+scale), image.Black, image.Point{}, draw.Src)
+			}
+		}
+		x += glyphAdvance * scale
+	}
+}
@@ -0,0 +1,37 @@
+package label
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+)
+
+func renderSVG(layouts []*layout) []byte {
+	var buf bytes.Buffer
+	height := Height * len(layouts)
+
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		Width, height, Width, height)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/>`+"\n", Width, height)
+
+	for i, lay := range layouts {
+		fmt.Fprintf(&buf, `<g transform="translate(0 %d)">`+"\n", i*Height)
+		for _, t := range lay.texts {
+			// SVG places text by its baseline
+			fmt.Fprintf(&buf, `<text x="%d" y="%d" font-family="monospace" font-size="%d"`, t.x, t.y+t.size*4/5, t.size)
+			if t.size == titleSize {
+				buf.WriteString(` font-weight="bold"`)
+			}
+			buf.WriteString(`>`)
+			_ = xml.EscapeText(&buf, []byte(t.value))
+			buf.WriteString("</text>\n")
+		}
+		for _, r := range lay.bars {
+			fmt.Fprintf(&buf, `<rect x="%d" y="%d" width="%d" height="%d"/>`+"\n", r.x, r.y, r.w, r.h)
+		}
+		buf.WriteString("</g>\n")
+	}
+
+	buf.WriteString("</svg>\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,39 @@
+package label
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// zplEscaper hex-escapes the characters ZPL treats as commands, for fields
+// sent with ^FH_.
+var zplEscaper = strings.NewReplacer("_", "_5F", "^", "_5E", "~", "_7E")
+
+// renderZPL emits one ZPL format per label. Barcodes are left to the
+// printer's own Code128 and QR commands, placed where the image renderers
+// draw them.
+func renderZPL(layouts []*layout) []byte {
+	var buf bytes.Buffer
+	for _, lay := range layouts {
+		buf.WriteString("^XA\n^CI28\n")
+		fmt.Fprintf(&buf, "^PW%d\n^LL%d\n", Width, Height)
+
+		for _, t := range lay.texts {
+			fmt.Fprintf(&buf, "^FO%d,%d^A0N,%d,%d^FH_^FD%s^FS\n", t.x, t.y, t.size, t.size, zplEscaper.Replace(t.value))
+		}
+
+		code := zplEscaper.Replace(lay.label.Code)
+		switch lay.label.Symbology {
+		case QR:
+			// Error correction M with automatic input mode, as EncodeQR uses
+			fmt.Fprintf(&buf, "^FO%d,%d^BQN,2,%d^FH_^FDMA,%s^FS\n", lay.codeX, lay.codeY, min(lay.module, 10), code)
+		case Code128:
+			fmt.Fprintf(&buf, "^FO%d,%d^BY%d^BCN,%d,N,N,N,A^FH_^FD%s^FS\n",
+				lay.codeX+code128Quiet*lay.module, lay.codeY, lay.module, lay.codeHeight, code)
+		}
+
+		buf.WriteString("^XZ\n")
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,418 @@
+package listquery
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+
+	// maxInValues bounds the values of one in filter.
+	maxInValues = 100
+)
+
+type Type string
+
+const (
+	String Type = "text"
+	Int    Type = "bigint"
+	Number Type = "numeric"
+	Bool   Type = "boolean"
+	Time   Type = "timestamp"
+	UUID   Type = "uuid"
+)
+
+type Op string
+
+const (
+	Eq   Op = "eq"
+	Lt   Op = "lt"
+	Gt   Op = "gt"
+	In   Op = "in"
+	Like Op = "like"
+)
+
+var operators = map[Op]string{Eq: "=", Lt: "<", Gt: ">"}
+
+// Field is something a list can be sorted and filtered by. Column is the
+// SQL expression it reads, which must not be NULL so that keyset cursors
+// can compare it.
+type Field struct {
+	Column string
+	Type   Type
+}
+
+// Spec describes what a list allows. Key names a unique field, which ends
+// every sort so that cursors point at exactly one row.
+type Spec struct {
+	Fields map[string]Field
+	Sort   []Sort
+	Key    string
+}
+
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+type Filter struct {
+	Field  string
+	Op     Op
+	Values []string
+}
+
+// Query is a parsed list request: which page, in which order, of the rows
+// matching which filters.
+type Query struct {
+	spec Spec
+
+	// Limit is the page size; 0 means no limit.
+	Limit   int
+	Sort    []Sort
+	Filters []Filter
+
+	// after holds the sort values of the last row of the previous page.
+	after []string
+}
+
+// Page describes the page a Query returned. NextCursor is nil on the last
+// page; Total counts the rows matching the filters across all pages.
+type Page struct {
+	NextCursor *string `json:"next_cursor"`
+	Total      int     `json:"total"`
+}
+
+// cursor is the decoded form of a page cursor. It remembers the sort it was
+// made for, since its values mean nothing under another.
+type cursor struct {
+	Sort  string          `json:"sort"`
+	After json.RawMessage `json:"after"`
+}
+
+// All is a query for every row of a list in its default order, for callers
+// that need the whole list at once.
+func All(spec Spec) *Query {
+	return &Query{spec: spec, Sort: withKey(append([]Sort(nil), spec.Sort...), spec.Key)}
+}
+
+// Parse reads limit, cursor and sort parameters and field filters from a
+// query string:
+//
+//	?limit=20&sort=-created_at,name&name[like]=bolt&weight[gt]=2&status[in]=open,picking
+//
+// A leading "-" sorts a field descending. Only fields in spec are taken as
+// filters; other parameters are left to the caller, since lists take
+// parameters of their own.
+func Parse(values url.Values, spec Spec) (*Query, error) {
+	q := &Query{spec: spec, Limit: DefaultLimit}
+
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > MaxLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d", MaxLimit)
+		}
+		q.Limit = n
+	}
+
+	if order := values.Get("sort"); order != "" {
+		for _, name := range strings.Split(order, ",") {
+			s := Sort{Field: strings.TrimSpace(name)}
+			if rest, ok := strings.CutPrefix(s.Field, "-"); ok {
+				s.Field, s.Desc = rest, true
+			}
+			if _, ok := spec.Fields[s.Field]; !ok {
+				return nil, fmt.Errorf("cannot sort by %q", s.Field)
+			}
+			q.Sort = append(q.Sort, s)
+		}
+	} else {
+		q.Sort = append([]Sort(nil), spec.Sort...)
+	}
+	q.Sort = withKey(q.Sort, spec.Key)
+
+	// Sorted so the same parameters always build the same query
+	params := make([]string, 0, len(values))
+	for param := range values {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+
+	for _, param := range params {
+		name, op, ok := splitFilter(param)
+		if !ok {
+			continue
+		}
+		field, ok := spec.Fields[name]
+		if !ok {
+			continue
+		}
+
+		for _, value := range values[param] {
+			filter, err := parseFilter(name, field, op, value)
+			if err != nil {
+				return nil, err
+			}
+			q.Filters = append(q.Filters, filter)
+		}
+	}
+
+	if c := values.Get("cursor"); c != "" {
+		after, err := q.decodeCursor(c)
+		if err != nil {
+			return nil, err
+		}
+		q.after = after
+	}
+
+	return q, nil
+}
+
+// withKey ends order with the key field, unless it already sorts by it.
+func withKey(order []Sort, key string) []Sort {
+	for _, s := range order {
+		if s.Field == key {
+			return order
+		}
+	}
+
+	// The key follows the direction of the first field, so a plain
+	// descending sort can still use an index on (field, key)
+	desc := len(order) > 0 && order[0].Desc
+	return append(order, Sort{Field: key, Desc: desc})
+}
+
+// splitFilter splits a filter parameter such as weight[gt] into its field
+// and operator.
+func splitFilter(param string) (string, Op, bool) {
+	name, rest, ok := strings.Cut(param, "[")
+	if !ok || !strings.HasSuffix(rest, "]") {
+		return "", "", false
+	}
+
+	op := Op(strings.TrimSuffix(rest, "]"))
+	switch op {
+	case Eq, Lt, Gt, In, Like:
+		return name, op, true
+	}
+	return "", "", false
+}
+
+func parseFilter(name string, field Field, op Op, value string) (Filter, error) {
+	filter := Filter{Field: name, Op: op}
+
+	switch op {
+	case Like:
+		if field.Type != String {
+			return filter, fmt.Errorf("%s cannot be filtered with like", name)
+		}
+		filter.Values = []string{value}
+		return filter, nil
+	case In:
+		filter.Values = strings.Split(value, ",")
+		if len(filter.Values) > maxInValues {
+			return filter, fmt.Errorf("%s[in] takes at most %d values", name, maxInValues)
+		}
+	default:
+		filter.Values = []string{value}
+	}
+
+	for i, v := range filter.Values {
+		normalized, err := normalize(field.Type, strings.TrimSpace(v))
+		if err != nil {
+			return filter, fmt.Errorf("invalid value %q for %s: %v", v, name, err)
+		}
+		filter.Values[i] = normalized
+	}
+
+	return filter, nil
+}
+
+// normalize checks that value is of type t and returns it in the form
+// Postgres reads for the type.
+func normalize(t Type, value string) (string, error) {
+	switch t {
+	case Int:
+		_, err := strconv.ParseInt(value, 10, 64)
+		return value, err
+	case Number:
+		_, err := strconv.ParseFloat(value, 64)
+		return value, err
+	case Bool:
+		b, err := strconv.ParseBool(value)
+		return strconv.FormatBool(b), err
+	case UUID:
+		_, err := uuid.Parse(value)
+		return value, err
+	case Time:
+		// Timestamps are stored without a zone, in UTC, which is also how
+		// cursors carry them
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02"} {
+			if ts, err := time.Parse(layout, value); err == nil {
+				return ts.UTC().Format("2006-01-02 15:04:05.999999"), nil
+			}
+		}
+		return value, fmt.Errorf("expected an RFC 3339 time or a date")
+	default:
+		return value, nil
+	}
+}
+
+func (q *Query) sortKey() string {
+	names := make([]string, len(q.Sort))
+	for i, s := range q.Sort {
+		names[i] = s.Field
+		if s.Desc {
+			names[i] = "-" + s.Field
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+func (q *Query) decodeCursor(s string) ([]string, error) {
+	invalid := fmt.Errorf("invalid cursor")
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, invalid
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, invalid
+	}
+	if c.Sort != q.sortKey() {
+		return nil, fmt.Errorf("cursor was made for another sort order")
+	}
+
+	dec := json.NewDecoder(strings.NewReader(string(c.After)))
+	dec.UseNumber()
+	var values []interface{}
+	if err := dec.Decode(&values); err != nil || len(values) != len(q.Sort) {
+		return nil, invalid
+	}
+
+	after := make([]string, len(values))
+	for i, v := range values {
+		if v == nil {
+			return nil, invalid
+		}
+		// Cursors come back from clients, so their values are checked
+		// like filter values before they reach a query
+		normalized, err := normalize(q.spec.Fields[q.Sort[i].Field].Type, fmt.Sprint(v))
+		if err != nil {
+			return nil, invalid
+		}
+		after[i] = normalized
+	}
+	return after, nil
+}
+
+// FilterWhere appends the SQL conditions of the filters to conditions,
+// with their values appended to args as parameters.
+func (q *Query) FilterWhere(conditions []string, args []interface{}) ([]string, []interface{}) {
+	param := func(field Field, value string) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d::%s", len(args), field.Type)
+	}
+
+	for _, f := range q.Filters {
+		field := q.spec.Fields[f.Field]
+		switch f.Op {
+		case Like:
+			conditions = append(conditions, fmt.Sprintf(`%s ILIKE '%%' || %s || '%%'`, field.Column, param(field, escapeLike(f.Values[0]))))
+		case In:
+			params := make([]string, len(f.Values))
+			for i, v := range f.Values {
+				params[i] = param(field, v)
+			}
+			conditions = append(conditions, fmt.Sprintf(`%s IN (%s)`, field.Column, strings.Join(params, ", ")))
+		default:
+			conditions = append(conditions, fmt.Sprintf(`%s %s %s`, field.Column, operators[f.Op], param(field, f.Values[0])))
+		}
+	}
+
+	return conditions, args
+}
+
+// AfterWhere appends the condition selecting the rows that follow the
+// cursor in the sort order: those past it on the first field, or level on
+// it and past it on the next, and so on.
+func (q *Query) AfterWhere(conditions []string, args []interface{}) ([]string, []interface{}) {
+	if q.after == nil {
+		return conditions, args
+	}
+
+	params := make([]string, len(q.Sort))
+	for i, s := range q.Sort {
+		args = append(args, q.after[i])
+		params[i] = fmt.Sprintf("$%d::%s", len(args), q.spec.Fields[s.Field].Type)
+	}
+
+	var alternatives []string
+	for i, s := range q.Sort {
+		var terms []string
+		for j := 0; j < i; j++ {
+			terms = append(terms, fmt.Sprintf("%s = %s", q.spec.Fields[q.Sort[j].Field].Column, params[j]))
+		}
+		op := ">"
+		if s.Desc {
+			op = "<"
+		}
+		terms = append(terms, fmt.Sprintf("%s %s %s", q.spec.Fields[s.Field].Column, op, params[i]))
+		alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+	}
+
+	return append(conditions, "("+strings.Join(alternatives, " OR ")+")"), args
+}
+
+// OrderBy returns the ORDER BY and LIMIT clauses. One row more than the
+// limit is asked for, to tell whether another page follows.
+func (q *Query) OrderBy() string {
+	if q.Limit == 0 {
+		return "ORDER BY " + q.orderTerms()
+	}
+	return fmt.Sprintf("ORDER BY %s LIMIT %d", q.orderTerms(), q.Limit+1)
+}
+
+func (q *Query) orderTerms() string {
+	terms := make([]string, len(q.Sort))
+	for i, s := range q.Sort {
+		terms[i] = q.spec.Fields[s.Field].Column + " ASC"
+		if s.Desc {
+			terms[i] = q.spec.Fields[s.Field].Column + " DESC"
+		}
+	}
+	return strings.Join(terms, ", ")
+}
+
+// CursorColumn selects the sort values of a row as JSON, from which
+// Cursor builds the cursor of the page after it.
+func (q *Query) CursorColumn() string {
+	columns := make([]string, len(q.Sort))
+	for i, s := range q.Sort {
+		columns[i] = q.spec.Fields[s.Field].Column
+	}
+	return "json_build_array(" + strings.Join(columns, ", ") + ")::text"
+}
+
+// Cursor encodes the cursor pointing after the row whose CursorColumn
+// value is given.
+func (q *Query) Cursor(after string) string {
+	data, _ := json.Marshal(cursor{Sort: q.sortKey(), After: json.RawMessage(after)})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// escapeLike makes the wildcards of like patterns match themselves.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
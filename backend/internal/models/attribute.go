@@ -0,0 +1,41 @@
+package models
+
+type AttributeType string
+
+const (
+	AttributeString  AttributeType = "string"
+	AttributeNumber  AttributeType = "number"
+	AttributeInteger AttributeType = "integer"
+	AttributeBoolean AttributeType = "boolean"
+	// AttributeEnum is one string out of Enum.
+	AttributeEnum AttributeType = "enum"
+	// AttributeList is a list of strings, limited to Enum when it is set.
+	AttributeList AttributeType = "list"
+)
+
+// AttributeDefinition declares one attribute that products in a category,
+// and in all of its descendants, may carry. A descendant defining the same
+// name replaces the inherited definition.
+type AttributeDefinition struct {
+	CategoryID string        `json:"category_id"`
+	Name       string        `json:"name"`
+	Type       AttributeType `json:"type"`
+	Required   bool          `json:"required"`
+	Enum       []string      `json:"enum,omitempty"`
+	Unit       string        `json:"unit,omitempty"`
+}
+
+type AttributeDefinitionRequest struct {
+	Name     string        `json:"name" binding:"required,max=50"`
+	Type     AttributeType `json:"type" binding:"required,oneof=string number integer boolean enum list"`
+	Required bool          `json:"required"`
+	Enum     []string      `json:"enum"`
+	Unit     string        `json:"unit" binding:"max=20"`
+}
+
+// SetAttributesRequest replaces the attributes a category defines itself.
+// Products already stored are checked against the new schema the next time
+// they are updated.
+type SetAttributesRequest struct {
+	Attributes []AttributeDefinitionRequest `json:"attributes" binding:"dive"`
+}
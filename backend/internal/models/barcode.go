@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+)
+
+type BarcodeType string
+
+const (
+	BarcodeEAN13   BarcodeType = "ean13"
+	BarcodeUPCA    BarcodeType = "upc_a"
+	BarcodeGTIN14  BarcodeType = "gtin14"
+	BarcodeCode128 BarcodeType = "code128"
+)
+
+// ShelfLabelPrefix starts the code printed on shelf labels, followed by the
+// shelf ID.
+const ShelfLabelPrefix = "SHELF:"
+
+type ProductBarcode struct {
+	Code      string      `json:"code"`
+	SKU       string      `json:"sku"`
+	Type      BarcodeType `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+type AddBarcodeRequest struct {
+	Code string      `json:"code" binding:"required"`
+	Type BarcodeType `json:"type" binding:"required,oneof=ean13 upc_a gtin14 code128"`
+}
+
+type ScanKind string
+
+const (
+	ScanProduct ScanKind = "product"
+	ScanShelf   ScanKind = "shelf"
+	ScanSerial  ScanKind = "serial"
+)
+
+// ScanResult is what a scanned code refers to. Exactly one of Product,
+// Shelf and Serial is set, as named by Kind.
+type ScanResult struct {
+	Code    string          `json:"code"`
+	Kind    ScanKind        `json:"kind"`
+	Barcode *ProductBarcode `json:"barcode,omitempty"`
+	Product *Product        `json:"product,omitempty"`
+	Shelf   *ShelfResponse  `json:"shelf,omitempty"`
+	Serial  *SerialLookup   `json:"serial,omitempty"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+)
+
+type Category struct {
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	ParentID *string `json:"parent_id"`
+
+	// Totals cover the category and all of its descendants.
+	ProductCount int `json:"product_count"`
+	OnHand       int `json:"on_hand"`
+
+	Children  []Category `json:"children,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+type CreateCategoryRequest struct {
+	Name     string `json:"name" binding:"required,min=1,max=100"`
+	ParentID string `json:"parent_id" binding:"omitempty,uuid"`
+}
+
+type RenameCategoryRequest struct {
+	Name string `json:"name" binding:"required,min=1,max=100"`
+}
+
+// MoveCategoryRequest moves a category, with everything under it, below a
+// new parent; an empty parent makes it a root.
+type MoveCategoryRequest struct {
+	ParentID string `json:"parent_id" binding:"omitempty,uuid"`
+}
+
+// ProductFilter narrows product lists. Category matches the category and
+// all of its descendants.
+type ProductFilter struct {
+	Category string `form:"category" binding:"omitempty,uuid"`
+
+	// Attributes matches products whose attribute equals the value, or
+	// whose list attribute contains it, given as attr[name]=value.
+	Attributes map[string]string `form:"-"`
+
+	// Archived lists archived products instead of active ones.
+	Archived bool `form:"archived"`
+}
+
+// ShelfFilter narrows shelf lists to shelves holding stock of a category,
+// including its descendants.
+type ShelfFilter struct {
+	Category string `form:"category" binding:"omitempty,uuid"`
+
+	// Archived lists archived shelves instead of active ones.
+	Archived bool `form:"archived"`
+}
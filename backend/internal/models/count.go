@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+)
+
+type CountStatus string
+
+const (
+	CountOpen      CountStatus = "open"
+	CountApproved  CountStatus = "approved"
+	CountCancelled CountStatus = "cancelled"
+)
+
+// AdjustmentReason explains why approved count variances changed stock.
+type AdjustmentReason string
+
+const (
+	AdjustmentDamaged  AdjustmentReason = "damaged"
+	AdjustmentLost     AdjustmentReason = "lost"
+	AdjustmentFound    AdjustmentReason = "found"
+	AdjustmentMiscount AdjustmentReason = "miscount"
+	AdjustmentOther    AdjustmentReason = "other"
+)
+
+type CountSession struct {
+	ID         string           `json:"id"`
+	Reference  string           `json:"reference,omitempty"`
+	Status     CountStatus      `json:"status"`
+	Freeze     bool             `json:"freeze"`
+	ShelfIDs   []string         `json:"shelf_ids"`
+	Lines      []CountLine      `json:"lines"`
+	ReasonCode AdjustmentReason `json:"reason_code,omitempty"`
+	CreatedBy  string           `json:"created_by,omitempty"`
+	ApprovedBy string           `json:"approved_by,omitempty"`
+	CreatedAt  time.Time        `json:"created_at"`
+	ClosedAt   *time.Time       `json:"closed_at,omitempty"`
+}
+
+// CountLine compares the quantity snapshotted when the session opened with
+// what was counted. Lines for SKUs found unexpectedly have an expected
+// quantity of zero.
+type CountLine struct {
+	ID               string     `json:"id"`
+	ShelfID          string     `json:"shelf_id"`
+	SKU              string     `json:"sku"`
+	LotNumber        string     `json:"lot_number,omitempty"`
+	ExpectedQuantity int        `json:"expected_quantity"`
+	CountedQuantity  *int       `json:"counted_quantity"`
+	Variance         *int       `json:"variance"`
+	SerialNumbers    []string   `json:"serial_numbers,omitempty"`
+	CountedBy        string     `json:"counted_by,omitempty"`
+	CountedAt        *time.Time `json:"counted_at,omitempty"`
+}
+
+type CreateCountRequest struct {
+	ShelfIDs  []string `json:"shelf_ids" binding:"required,min=1"`
+	Reference string   `json:"reference" binding:"max=100"`
+
+	// Freeze blocks every other stock movement on the shelves until the
+	// session is approved or cancelled.
+	Freeze bool `json:"freeze"`
+}
+
+type SubmitCountsRequest struct {
+	Lines []SubmitCountLineRequest `json:"lines" binding:"required,min=1,dive"`
+}
+
+type SubmitCountLineRequest struct {
+	ShelfID   string `json:"shelf_id" binding:"required"`
+	SKU       string `json:"sku" binding:"required"`
+	LotNumber string `json:"lot_number" binding:"max=100"`
+	Quantity  int    `json:"quantity" binding:"gte=0"`
+
+	// SerialNumbers names the units of a serialized product counted beyond
+	// the expected quantity, one per unit.
+	SerialNumbers []string `json:"serial_numbers"`
+}
+
+type ApproveCountRequest struct {
+	ReasonCode AdjustmentReason `json:"reason_code" binding:"required,oneof=damaged lost found miscount other"`
+}
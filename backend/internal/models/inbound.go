@@ -0,0 +1,115 @@
+package models
+
+import (
+	"time"
+)
+
+type InboundType string
+
+const (
+	InboundPurchaseOrder InboundType = "po"
+	InboundASN           InboundType = "asn"
+)
+
+type InboundStatus string
+
+const (
+	InboundOpen InboundStatus = "open"
+	// InboundReceiving has had at least one receipt booked against it.
+	InboundReceiving InboundStatus = "receiving"
+	InboundClosed    InboundStatus = "closed"
+)
+
+// Discrepancy flags a line whose received quantity differs from what was
+// expected.
+type Discrepancy string
+
+const (
+	DiscrepancyNone  Discrepancy = ""
+	DiscrepancyOver  Discrepancy = "over"
+	DiscrepancyUnder Discrepancy = "under"
+)
+
+type InboundDocument struct {
+	ID         string        `json:"id"`
+	Type       InboundType   `json:"type"`
+	Reference  string        `json:"reference"`
+	Supplier   string        `json:"supplier,omitempty"`
+	Status     InboundStatus `json:"status"`
+	ExpectedAt *time.Time    `json:"expected_at,omitempty"`
+	Lines      []InboundLine `json:"lines"`
+	CreatedBy  string        `json:"created_by,omitempty"`
+	CreatedAt  time.Time     `json:"created_at"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+	ClosedAt   *time.Time    `json:"closed_at,omitempty"`
+}
+
+type InboundLine struct {
+	ID               string      `json:"id"`
+	SKU              string      `json:"sku"`
+	ExpectedQuantity int         `json:"expected_quantity"`
+	ReceivedQuantity int         `json:"received_quantity"`
+	UnitCost         float64     `json:"unit_cost"`
+	Variance         int         `json:"variance"`
+	Discrepancy      Discrepancy `json:"discrepancy,omitempty"`
+}
+
+type CreateInboundRequest struct {
+	Type       InboundType                `json:"type" binding:"required,oneof=po asn"`
+	Reference  string                     `json:"reference" binding:"required,max=100"`
+	Supplier   string                     `json:"supplier" binding:"max=255"`
+	ExpectedAt *time.Time                 `json:"expected_at"`
+	Lines      []CreateInboundLineRequest `json:"lines" binding:"required,min=1,dive"`
+}
+
+type CreateInboundLineRequest struct {
+	SKU      string  `json:"sku" binding:"required"`
+	Quantity int     `json:"quantity" binding:"required,gt=0"`
+	UnitCost float64 `json:"unit_cost" binding:"gte=0"`
+}
+
+type ReceiveRequest struct {
+	Lines []ReceiveLineRequest `json:"lines" binding:"required,min=1,dive"`
+}
+
+// ReceiveLineRequest books units of a SKU on the document into staging. The
+// lot and serial details travel with the units to their shelf.
+type ReceiveLineRequest struct {
+	SKU      string `json:"sku" binding:"required"`
+	Quantity int    `json:"quantity" binding:"required,gt=0"`
+
+	LotNumber      string     `json:"lot_number" binding:"max=100"`
+	ManufacturedAt *time.Time `json:"manufactured_at"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	SerialNumbers  []string   `json:"serial_numbers"`
+
+	// UnitCost defaults to the cost agreed on the document line.
+	UnitCost float64 `json:"unit_cost" binding:"gte=0"`
+}
+
+// StagedItem is received stock waiting in the staging area for putaway.
+type StagedItem struct {
+	ID             string     `json:"id"`
+	DocumentID     string     `json:"document_id"`
+	LineID         string     `json:"line_id"`
+	SKU            string     `json:"sku"`
+	ProductName    string     `json:"product_name"`
+	Quantity       int        `json:"quantity"`
+	LotNumber      string     `json:"lot_number,omitempty"`
+	ManufacturedAt *time.Time `json:"manufactured_at,omitempty"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	SerialNumbers  []string   `json:"serial_numbers,omitempty"`
+	UnitCost       float64    `json:"unit_cost"`
+	ReceivedBy     string     `json:"received_by,omitempty"`
+	ReceivedAt     time.Time  `json:"received_at"`
+}
+
+type PutawayRequest struct {
+	ShelfID  string `json:"shelf_id" binding:"required"`
+	Quantity int    `json:"quantity" binding:"required,gt=0"`
+	Force    bool   `json:"force"`
+
+	// SerialNumbers picks which staged units go to the shelf; by default
+	// they are taken in the order they were received.
+	SerialNumbers []string `json:"serial_numbers"`
+}
@@ -0,0 +1,17 @@
+package models
+
+// LabelQuery picks how a label is rendered. Format defaults to svg; the
+// symbology defaults to code128 for products and qr for shelves.
+type LabelQuery struct {
+	Format    string `form:"format" binding:"omitempty,oneof=svg png zpl"`
+	Symbology string `form:"symbology" binding:"omitempty,oneof=code128 qr"`
+}
+
+// MaxLabelRows bounds the rows one shelf label sheet may span.
+const MaxLabelRows = 20
+
+type ShelfLabelsQuery struct {
+	LabelQuery
+	FromRow int `form:"from_row" binding:"min=0"`
+	ToRow   int `form:"to_row" binding:"gtefield=FromRow"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// PickStrategy decides which lots are drawn first when stock leaves a shelf.
+type PickStrategy string
+
+const (
+	// PickFEFO takes the lot that expires first, then the oldest.
+	PickFEFO PickStrategy = "fefo"
+	// PickFIFO takes the oldest lot regardless of expiry.
+	PickFIFO PickStrategy = "fifo"
+)
+
+// LotQuantity is a number of units taken from a single lot.
+type LotQuantity struct {
+	LotNumber      string     `json:"lot_number,omitempty"`
+	ManufacturedAt *time.Time `json:"manufactured_at,omitempty"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	Quantity       int        `json:"quantity"`
+	SerialNumbers  []string   `json:"serial_numbers,omitempty"`
+}
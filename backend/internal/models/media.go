@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+)
+
+type MediaKind string
+
+const (
+	MediaImage    MediaKind = "image"
+	MediaDocument MediaKind = "document"
+)
+
+// ProductMedia is a file uploaded for a product: a picture, or a document
+// such as a datasheet. Only images have thumbnails.
+type ProductMedia struct {
+	ID           string    `json:"id"`
+	SKU          string    `json:"sku"`
+	Kind         MediaKind `json:"kind"`
+	Filename     string    `json:"filename"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	// Where the files live in storage, kept so they can be removed with
+	// the record
+	StorageKey   string `json:"-"`
+	ThumbnailKey string `json:"-"`
+}
+
+// UploadMediaRequest is the form accompanying an uploaded file, sent as
+// multipart/form-data with the file itself in the "file" field.
+type UploadMediaRequest struct {
+	Kind MediaKind `form:"kind" binding:"required,oneof=image document"`
+}
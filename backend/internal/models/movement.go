@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+)
+
+type MovementReason string
+
+const (
+	MovementAdd    MovementReason = "add"
+	MovementRemove MovementReason = "remove"
+	MovementAdjust MovementReason = "adjust"
+
+	MovementTransferOut MovementReason = "transfer_out"
+	MovementTransferIn  MovementReason = "transfer_in"
+
+	// MovementPick is stock leaving a shelf to fulfil an order.
+	MovementPick MovementReason = "pick"
+	// MovementPutaway is received stock moving from staging onto a shelf.
+	MovementPutaway MovementReason = "putaway"
+	// MovementCount is an adjustment posted by an approved cycle count.
+	MovementCount MovementReason = "count"
+)
+
+type StockMovement struct {
+	ID            string         `json:"id"`
+	SKU           string         `json:"sku"`
+	ShelfID       string         `json:"shelf_id"`
+	LotNumber     string         `json:"lot_number,omitempty"`
+	QuantityDelta int            `json:"quantity_delta"`
+	Reason        MovementReason `json:"reason"`
+	ReasonCode    string         `json:"reason_code,omitempty"`
+	UnitCost      float64        `json:"unit_cost"`
+	TotalCost     float64        `json:"total_cost"`
+	UserID        string         `json:"user_id,omitempty"`
+	SerialNumbers []string       `json:"serial_numbers,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+}
+
+type MovementFilter struct {
+	SKU       string    `form:"sku"`
+	ShelfID   string    `form:"shelf_id"`
+	LotNumber string    `form:"lot_number"`
+	UserID    string    `form:"user_id"`
+	From      time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To        time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+)
+
+type OrderStatus string
+
+const (
+	OrderOpen OrderStatus = "open"
+	// OrderAllocated has a pick list holding its stock.
+	OrderAllocated OrderStatus = "allocated"
+	// OrderPicked has had every pick step confirmed.
+	OrderPicked    OrderStatus = "picked"
+	OrderCancelled OrderStatus = "cancelled"
+)
+
+type PickStepStatus string
+
+const (
+	PickPending   PickStepStatus = "pending"
+	PickPicked    PickStepStatus = "picked"
+	PickCancelled PickStepStatus = "cancelled"
+)
+
+type Order struct {
+	ID        string      `json:"id"`
+	Reference string      `json:"reference,omitempty"`
+	Status    OrderStatus `json:"status"`
+	Lines     []OrderLine `json:"lines"`
+	Steps     []PickStep  `json:"steps,omitempty"`
+	CreatedBy string      `json:"created_by,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+type OrderLine struct {
+	ID             string `json:"id"`
+	SKU            string `json:"sku"`
+	Quantity       int    `json:"quantity"`
+	PickedQuantity int    `json:"picked_quantity"`
+}
+
+// PickStep tells a picker to take Quantity units of SKU from a shelf. Steps
+// are numbered in the order they should be walked.
+type PickStep struct {
+	ID            string         `json:"id"`
+	Sequence      int            `json:"sequence"`
+	LineID        string         `json:"line_id"`
+	ShelfID       string         `json:"shelf_id"`
+	ShelfName     string         `json:"shelf_name"`
+	RowIndex      int            `json:"row_index"`
+	ColIndex      int            `json:"col_index"`
+	SKU           string         `json:"sku"`
+	Quantity      int            `json:"quantity"`
+	ReservationID string         `json:"reservation_id"`
+	Status        PickStepStatus `json:"status"`
+	PickedAt      *time.Time     `json:"picked_at,omitempty"`
+}
+
+type CreateOrderRequest struct {
+	Reference string                   `json:"reference" binding:"max=100"`
+	Lines     []CreateOrderLineRequest `json:"lines" binding:"required,min=1,dive"`
+}
+
+type CreateOrderLineRequest struct {
+	SKU      string `json:"sku" binding:"required"`
+	Quantity int    `json:"quantity" binding:"required,gt=0"`
+}
+
+// ConfirmPicksRequest confirms the listed pick steps, or every pending step
+// when StepIDs is empty.
+type ConfirmPicksRequest struct {
+	StepIDs []string `json:"step_ids"`
+}
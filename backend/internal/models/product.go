@@ -5,23 +5,85 @@ import (
 )
 
 type Product struct {
-	SKU       string    `db:"sku" json:"sku"`
-	Name      string    `db:"name" json:"name"`
-	Volume    float64   `db:"volume" json:"volume"`
-	Weight    float64   `db:"weight" json:"weight"`
+	SKU        string  `db:"sku" json:"sku"`
+	Name       string  `db:"name" json:"name"`
+	Volume     float64 `db:"volume" json:"volume"`
+	Weight     float64 `db:"weight" json:"weight"`
+	Length     float64 `db:"length" json:"length,omitempty"`
+	Width      float64 `db:"width" json:"width,omitempty"`
+	Height     float64 `db:"height" json:"height,omitempty"`
+	Serialized bool    `db:"serialized" json:"serialized"`
+	CategoryID *string `db:"category_id" json:"category_id"`
+
+	// Attributes are the values of the attributes the product's category
+	// defines.
+	Attributes map[string]interface{} `db:"attributes" json:"attributes"`
+
+	// Stock levels are totals across every shelf; 0 means the level is not
+	// set.
+	MinStock     int `db:"min_stock" json:"min_stock"`
+	ReorderPoint int `db:"reorder_point" json:"reorder_point"`
+	MaxStock     int `db:"max_stock" json:"max_stock"`
+	OnHand       int `db:"-" json:"on_hand"`
+
+	CostingMethod CostingMethod `db:"costing_method" json:"costing_method"`
+
+	// Barcodes lists every barcode assigned to the product, oldest first.
+	Barcodes []string `db:"-" json:"barcodes"`
+
+	// Media lists the product's images and documents, oldest first.
+	Media []ProductMedia `db:"-" json:"media"`
+
+	// Archived products are left out of lists and take no new stock.
+	ArchivedAt *time.Time `db:"archived_at" json:"archived_at"`
+	ArchivedBy *string    `db:"archived_by" json:"archived_by"`
+
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
 }
 
 type CreateProductRequest struct {
-	SKU    string  `json:"sku" binding:"required,min=3,max=50"`
-	Name   string  `json:"name" binding:"required,min=3,max=255"`
-	Volume float64 `json:"volume" binding:"required,gt=0"`
-	Weight float64 `json:"weight" binding:"required,gt=0"`
+	SKU        string  `json:"sku" binding:"required,min=3,max=50"`
+	Name       string  `json:"name" binding:"required,min=3,max=255"`
+	Volume     float64 `json:"volume" binding:"required,gt=0"`
+	Weight     float64 `json:"weight" binding:"required,gt=0"`
+	Length     float64 `json:"length" binding:"omitempty,gt=0"`
+	Width      float64 `json:"width" binding:"omitempty,gt=0"`
+	Height     float64 `json:"height" binding:"omitempty,gt=0"`
+	Serialized bool    `json:"serialized"`
+	CategoryID string  `json:"category_id" binding:"omitempty,uuid"`
+
+	Attributes map[string]interface{} `json:"attributes"`
+
+	MinStock     int `json:"min_stock" binding:"gte=0"`
+	ReorderPoint int `json:"reorder_point" binding:"gte=0"`
+	MaxStock     int `json:"max_stock" binding:"gte=0"`
+
+	CostingMethod CostingMethod `json:"costing_method" binding:"omitempty,oneof=average fifo"`
 }
 
 type UpdateProductRequest struct {
 	Name   string  `json:"name" binding:"min=3,max=255"`
 	Volume float64 `json:"volume" binding:"gt=0"`
 	Weight float64 `json:"weight" binding:"gt=0"`
+	Length float64 `json:"length" binding:"omitempty,gt=0"`
+	Width  float64 `json:"width" binding:"omitempty,gt=0"`
+	Height float64 `json:"height" binding:"omitempty,gt=0"`
+	Force  bool    `json:"force"`
+
+	// Serialized can only change while the product has no stock.
+	Serialized *bool `json:"serialized"`
+
+	// CategoryID is left unchanged when omitted; "" uncategorizes.
+	CategoryID *string `json:"category_id" binding:"omitempty,len=0|uuid"`
+
+	// Attributes replace the stored ones when given.
+	Attributes map[string]interface{} `json:"attributes"`
+
+	// Stock levels are left unchanged when omitted; 0 clears a level.
+	MinStock     *int `json:"min_stock" binding:"omitempty,gte=0"`
+	ReorderPoint *int `json:"reorder_point" binding:"omitempty,gte=0"`
+	MaxStock     *int `json:"max_stock" binding:"omitempty,gte=0"`
+
+	CostingMethod CostingMethod `json:"costing_method" binding:"omitempty,oneof=average fifo"`
 }
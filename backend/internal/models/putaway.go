@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+)
+
+type PutawayStrategy string
+
+const (
+	// PutawayConsolidate prefers shelves already holding the SKU.
+	PutawayConsolidate PutawayStrategy = "consolidate"
+	// PutawayClosest prefers shelves nearest the dock.
+	PutawayClosest PutawayStrategy = "closest"
+	// PutawayBestFit prefers the shelf left with the least free volume.
+	PutawayBestFit PutawayStrategy = "best_fit"
+	// PutawayEmptyFirst prefers shelves holding nothing yet.
+	PutawayEmptyFirst PutawayStrategy = "empty_first"
+)
+
+type PutawaySuggestRequest struct {
+	SKU      string          `json:"sku" binding:"required"`
+	Quantity int             `json:"quantity" binding:"required,gt=0"`
+	Strategy PutawayStrategy `json:"strategy" binding:"omitempty,oneof=consolidate closest best_fit empty_first"`
+
+	// Dock is where goods arrive; it defaults to the front of the first
+	// aisle.
+	Dock  *GridLocation `json:"dock"`
+	Limit int           `json:"limit" binding:"omitempty,gt=0,lte=100"`
+}
+
+// PutawaySuggestion is a shelf that can take the whole quantity without
+// breaking any capacity limit.
+type PutawaySuggestion struct {
+	Rank             int     `json:"rank"`
+	ShelfID          string  `json:"shelf_id"`
+	ShelfName        string  `json:"shelf_name"`
+	RowIndex         int     `json:"row_index"`
+	ColIndex         int     `json:"col_index"`
+	FreeVolume       float64 `json:"free_volume"`
+	FreeVolumeAfter  float64 `json:"free_volume_after"`
+	ExistingQuantity int     `json:"existing_quantity"`
+	Empty            bool    `json:"empty"`
+	Distance         float64 `json:"distance"`
+}
+
+// ApplyPutawayRequest puts the units on the best suggested shelf. With
+// StagedItemID the units come out of the staging area; otherwise they are
+// added like a manual addition with the given lot and serial details.
+type ApplyPutawayRequest struct {
+	PutawaySuggestRequest
+
+	StagedItemID   string     `json:"staged_item_id"`
+	LotNumber      string     `json:"lot_number" binding:"max=100"`
+	ManufacturedAt *time.Time `json:"manufactured_at"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	SerialNumbers  []string   `json:"serial_numbers"`
+	UnitCost       float64    `json:"unit_cost" binding:"gte=0"`
+}
+
+type ApplyPutawayResponse struct {
+	Suggestion PutawaySuggestion `json:"suggestion"`
+	Item       *ShelfItem        `json:"item"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+)
+
+type ReservationStatus string
+
+const (
+	// ReservationActive holds stock until it expires.
+	ReservationActive ReservationStatus = "active"
+	// ReservationConfirmed holds stock until released or consumed.
+	ReservationConfirmed ReservationStatus = "confirmed"
+	ReservationReleased  ReservationStatus = "released"
+	ReservationExpired   ReservationStatus = "expired"
+	// ReservationFulfilled has been consumed by stock leaving the shelves.
+	ReservationFulfilled ReservationStatus = "fulfilled"
+)
+
+type Reservation struct {
+	ID        string            `json:"id"`
+	SKU       string            `json:"sku"`
+	ShelfID   string            `json:"shelf_id,omitempty"`
+	Quantity  int               `json:"quantity"`
+	Status    ReservationStatus `json:"status"`
+	Reference string            `json:"reference,omitempty"`
+	ExpiresAt *time.Time        `json:"expires_at,omitempty"`
+	CreatedBy string            `json:"created_by,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+type CreateReservationRequest struct {
+	SKU string `json:"sku" binding:"required"`
+	// ShelfID pins the hold to one shelf; when empty the units may be
+	// taken from anywhere in the warehouse.
+	ShelfID   string     `json:"shelf_id"`
+	Quantity  int        `json:"quantity" binding:"required,gt=0"`
+	Reference string     `json:"reference" binding:"max=100"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type ReservationFilter struct {
+	SKU     string            `form:"sku"`
+	ShelfID string            `form:"shelf_id"`
+	Status  ReservationStatus `form:"status"`
+}
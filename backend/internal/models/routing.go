@@ -0,0 +1,31 @@
+package models
+
+// GridLocation is a position on the shelf grid. Column -1 is the front cross
+// aisle, where the depots sit by default.
+type GridLocation struct {
+	Row int `json:"row" binding:"gte=0"`
+	Col int `json:"col" binding:"gte=-1"`
+}
+
+type RouteRequest struct {
+	ShelfIDs []string `json:"shelf_ids" binding:"required,min=1"`
+	Strategy string   `json:"strategy" binding:"omitempty,oneof=s_shape largest_gap two_opt best"`
+
+	// Start and End are the depots the walk begins and finishes at.
+	Start *GridLocation `json:"start"`
+	End   *GridLocation `json:"end"`
+}
+
+type RouteStop struct {
+	Sequence int    `json:"sequence"`
+	ShelfID  string `json:"shelf_id"`
+	Name     string `json:"name"`
+	RowIndex int    `json:"row_index"`
+	ColIndex int    `json:"col_index"`
+}
+
+type RouteResponse struct {
+	Strategy string      `json:"strategy"`
+	Stops    []RouteStop `json:"stops"`
+	Distance float64     `json:"distance"`
+}
@@ -0,0 +1,15 @@
+package models
+
+type ProductSearchQuery struct {
+	Q     string `form:"q" binding:"required,max=200"`
+	Limit int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// ProductSearchResult is a product matching a search, with its relevance
+// and the matched words of its fields marked up for display. Highlights
+// are keyed by field: sku, name, barcodes, or attributes.<name>.
+type ProductSearchResult struct {
+	Product
+	Rank       float64           `json:"rank"`
+	Highlights map[string]string `json:"highlights"`
+}
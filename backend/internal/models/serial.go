@@ -0,0 +1,12 @@
+package models
+
+// SerialLookup describes a single serialized unit: what it is, where it sits
+// now and how it got there.
+type SerialLookup struct {
+	SerialNumber string          `json:"serial_number"`
+	Product      *Product        `json:"product"`
+	Shelf        *Shelf          `json:"shelf,omitempty"`
+	LotNumber    string          `json:"lot_number,omitempty"`
+	InStock      bool            `json:"in_stock"`
+	Movements    []StockMovement `json:"movements"`
+}
@@ -5,11 +5,20 @@ import (
 )
 
 type Shelf struct {
-	ID        string    `db:"id" json:"id"`
-	Name      string    `db:"name" json:"name"`
-	RowIndex  int       `db:"row_index" json:"row_index"`
-	ColIndex  int       `db:"col_index" json:"col_index"`
-	MaxVolume float64   `db:"max_volume" json:"max_volume"`
+	ID        string  `db:"id" json:"id"`
+	Name      string  `db:"name" json:"name"`
+	RowIndex  int     `db:"row_index" json:"row_index"`
+	ColIndex  int     `db:"col_index" json:"col_index"`
+	MaxVolume float64 `db:"max_volume" json:"max_volume"`
+	MaxWeight float64 `db:"max_weight" json:"max_weight"`
+	Length    float64 `db:"length" json:"length,omitempty"`
+	Width     float64 `db:"width" json:"width,omitempty"`
+	Height    float64 `db:"height" json:"height,omitempty"`
+
+	// Archived shelves are left out of lists and take no new stock.
+	ArchivedAt *time.Time `db:"archived_at" json:"archived_at"`
+	ArchivedBy *string    `db:"archived_by" json:"archived_by"`
+
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
 }
@@ -19,23 +28,45 @@ type CreateShelfRequest struct {
 	RowIndex  int     `json:"row_index" binding:"required,min=0"`
 	ColIndex  int     `json:"col_index" binding:"required,min=0"`
 	MaxVolume float64 `json:"max_volume" binding:"required,gt=0"`
+	MaxWeight float64 `json:"max_weight" binding:"omitempty,gt=0"`
+	Length    float64 `json:"length" binding:"omitempty,gt=0"`
+	Width     float64 `json:"width" binding:"omitempty,gt=0"`
+	Height    float64 `json:"height" binding:"omitempty,gt=0"`
 }
 
 type UpdateShelfRequest struct {
 	Name      string  `json:"name" binding:"min=3,max=100"`
 	MaxVolume float64 `json:"max_volume" binding:"gt=0"`
+	Length    float64 `json:"length" binding:"omitempty,gt=0"`
+	Width     float64 `json:"width" binding:"omitempty,gt=0"`
+	Height    float64 `json:"height" binding:"omitempty,gt=0"`
+	Force     bool    `json:"force"`
+
+	// MaxWeight is left alone when not sent; 0 removes the weight limit.
+	MaxWeight *float64 `json:"max_weight" binding:"omitempty,gte=0"`
 }
 
 type ShelfResponse struct {
-	ID         string      `json:"id"`
-	Name       string      `json:"name"`
-	RowIndex   int         `json:"row_index"`
-	ColIndex   int         `json:"col_index"`
-	MaxVolume  float64     `json:"max_volume"`
-	UsedVolume float64     `json:"used_volume"`
-	Items      []ShelfItem `json:"items"`
-	CreatedAt  time.Time   `json:"created_at"`
-	UpdatedAt  time.Time   `json:"updated_at"`
+	ID           string      `json:"id"`
+	Name         string      `json:"name"`
+	RowIndex     int         `json:"row_index"`
+	ColIndex     int         `json:"col_index"`
+	MaxVolume    float64     `json:"max_volume"`
+	UsedVolume   float64     `json:"used_volume"`
+	MaxWeight    float64     `json:"max_weight"`
+	UsedWeight   float64     `json:"used_weight"`
+	Length       float64     `json:"length,omitempty"`
+	Width        float64     `json:"width,omitempty"`
+	Height       float64     `json:"height,omitempty"`
+	OverCapacity bool        `json:"over_capacity"`
+	OnHand       int         `json:"on_hand"`
+	Allocated    int         `json:"allocated"`
+	Available    int         `json:"available"`
+	Items        []ShelfItem `json:"items"`
+	ArchivedAt   *time.Time  `json:"archived_at"`
+	ArchivedBy   *string     `json:"archived_by"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
 }
 
 type ShelfItem struct {
@@ -45,14 +76,69 @@ type ShelfItem struct {
 	ProductName string    `json:"product_name"`
 	Quantity    int       `json:"quantity"`
 	Volume      float64   `json:"volume"`
+	Weight      float64   `json:"weight"`
 	CreatedAt   time.Time `json:"created_at"`
+
+	// QuantityBreakdown spells Quantity out in the product's pack
+	// hierarchy, e.g. "3 pallets + 2 cases + 5 each".
+	QuantityBreakdown string `json:"quantity_breakdown"`
+
+	LotNumber      string     `json:"lot_number,omitempty"`
+	ManufacturedAt *time.Time `json:"manufactured_at,omitempty"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+
+	// CapacityCheck is set on mutation responses to say whether the shelf
+	// was checked by dimensional fit or by scalar volume.
+	CapacityCheck CapacityCheck `json:"capacity_check,omitempty"`
 }
 
+type CapacityCheck string
+
+const (
+	CapacityCheckVolume      CapacityCheck = "volume"
+	CapacityCheckDimensional CapacityCheck = "dimensional"
+)
+
 type AddItemToShelfRequest struct {
 	SKU      string `json:"sku" binding:"required"`
 	Quantity int    `json:"quantity" binding:"required,gt=0"`
+	Force    bool   `json:"force"`
+
+	// Unit is the unit Quantity is given in; empty means the base unit.
+	Unit string `json:"unit"`
+
+	LotNumber      string     `json:"lot_number" binding:"max=100"`
+	ManufacturedAt *time.Time `json:"manufactured_at"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+
+	// SerialNumbers is required for serialized products, one per unit.
+	SerialNumbers []string `json:"serial_numbers"`
+
+	// UnitCost values the units received; 0 takes the product's current
+	// average cost.
+	UnitCost float64 `json:"unit_cost" binding:"gte=0"`
+}
+
+type UpdateItemQuantityRequest struct {
+	Quantity int    `json:"quantity" binding:"required,gt=0"`
+	Unit     string `json:"unit"`
+	Force    bool   `json:"force"`
+
+	// SerialNumbers lists the units added or removed for serialized
+	// products, one per unit of change.
+	SerialNumbers []string `json:"serial_numbers"`
 }
 
 type RemoveItemRequest struct {
 	ItemID string `json:"item_id" binding:"required"`
 }
+
+type CapacityViolation struct {
+	ShelfID    string   `json:"shelf_id"`
+	ShelfName  string   `json:"shelf_name"`
+	Exceeds    []string `json:"exceeds"`
+	MaxVolume  float64  `json:"max_volume"`
+	UsedVolume float64  `json:"used_volume"`
+	MaxWeight  float64  `json:"max_weight"`
+	UsedWeight float64  `json:"used_weight"`
+}
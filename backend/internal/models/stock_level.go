@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+)
+
+// ReorderSuggestion is a SKU at or below its reorder point, with the
+// quantity to order to bring it back up to its maximum.
+type ReorderSuggestion struct {
+	SKU          string `json:"sku"`
+	Name         string `json:"name"`
+	OnHand       int    `json:"on_hand"`
+	OnOrder      int    `json:"on_order"`
+	MinStock     int    `json:"min_stock"`
+	ReorderPoint int    `json:"reorder_point"`
+	MaxStock     int    `json:"max_stock"`
+
+	SuggestedQuantity int `json:"suggested_quantity"`
+}
+
+type StockAlertKind string
+
+const (
+	AlertBelowMinimum StockAlertKind = "below_minimum"
+	AlertBelowReorder StockAlertKind = "below_reorder"
+	AlertAboveMaximum StockAlertKind = "above_maximum"
+)
+
+// StockAlert is raised when a SKU's on-hand total crosses one of its levels
+// and resolved once it crosses back.
+type StockAlert struct {
+	ID         string         `json:"id"`
+	SKU        string         `json:"sku"`
+	Kind       StockAlertKind `json:"kind"`
+	OnHand     int            `json:"on_hand"`
+	Threshold  int            `json:"threshold"`
+	CreatedAt  time.Time      `json:"created_at"`
+	ResolvedAt *time.Time     `json:"resolved_at,omitempty"`
+}
@@ -0,0 +1,22 @@
+package models
+
+type TransferRequest struct {
+	SKU         string `json:"sku" binding:"required"`
+	FromShelfID string `json:"from_shelf_id" binding:"required"`
+	ToShelfID   string `json:"to_shelf_id" binding:"required"`
+	Quantity    int    `json:"quantity" binding:"required,gt=0"`
+	Unit        string `json:"unit"`
+
+	// LotNumber restricts the transfer to one lot; otherwise lots are
+	// drawn in Strategy order.
+	LotNumber string       `json:"lot_number"`
+	Strategy  PickStrategy `json:"strategy" binding:"omitempty,oneof=fefo fifo"`
+
+	// SerialNumbers picks exact units of a serialized product.
+	SerialNumbers []string `json:"serial_numbers"`
+}
+
+type TransferResponse struct {
+	From *ShelfResponse `json:"from"`
+	To   *ShelfResponse `json:"to"`
+}
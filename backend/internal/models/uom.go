@@ -0,0 +1,34 @@
+package models
+
+// BaseUnit is the unit stock is stored and counted in. Every product has it
+// implicitly, with a factor of 1.
+const BaseUnit = "each"
+
+// ProductUnit is one level of a product's pack hierarchy, such as a case of
+// 12 or a pallet of 480.
+type ProductUnit struct {
+	SKU  string `json:"sku"`
+	Unit string `json:"unit"`
+
+	// Factor is the number of base units in one of this unit.
+	Factor int `json:"factor"`
+
+	// Volume and weight of one packed unit. The capacity check uses them
+	// when stock is added in this unit and they exceed Factor times the
+	// product's own figures, which levels stored without them report.
+	Volume float64 `json:"volume"`
+	Weight float64 `json:"weight"`
+}
+
+type ProductUnitRequest struct {
+	Unit   string  `json:"unit" binding:"required,min=1,max=20"`
+	Factor int     `json:"factor" binding:"required,gt=1"`
+	Volume float64 `json:"volume" binding:"omitempty,gt=0"`
+	Weight float64 `json:"weight" binding:"omitempty,gt=0"`
+}
+
+// SetProductUnitsRequest replaces a product's hierarchy above the base
+// unit. Each level must hold a whole number of the level below it.
+type SetProductUnitsRequest struct {
+	Units []ProductUnitRequest `json:"units" binding:"dive"`
+}
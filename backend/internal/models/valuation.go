@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+)
+
+// CostingMethod decides how stock leaving the warehouse is valued.
+type CostingMethod string
+
+const (
+	// CostingAverage values units at the moving average of what was paid.
+	CostingAverage CostingMethod = "average"
+	// CostingFIFO values units at the cost of the oldest layers still held.
+	CostingFIFO CostingMethod = "fifo"
+)
+
+type ValuationFilter struct {
+	// Method overrides each product's own costing method.
+	Method CostingMethod `form:"method" binding:"omitempty,oneof=average fifo"`
+}
+
+type SKUValuation struct {
+	SKU       string        `json:"sku"`
+	Name      string        `json:"name"`
+	Method    CostingMethod `json:"method"`
+	OnHand    int           `json:"on_hand"`
+	UnitValue float64       `json:"unit_value"`
+	Value     float64       `json:"value"`
+}
+
+type ShelfValuation struct {
+	ShelfID   string  `json:"shelf_id"`
+	ShelfName string  `json:"shelf_name"`
+	Value     float64 `json:"value"`
+}
+
+type ValuationReport struct {
+	TotalValue float64          `json:"total_value"`
+	SKUs       []SKUValuation   `json:"skus"`
+	Shelves    []ShelfValuation `json:"shelves"`
+}
+
+type COGSFilter struct {
+	SKU  string    `form:"sku"`
+	From time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To   time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+// COGSEntry is the cost of the units of a SKU that left through removals
+// and picks.
+type COGSEntry struct {
+	SKU      string  `json:"sku"`
+	Quantity int     `json:"quantity"`
+	Cost     float64 `json:"cost"`
+}
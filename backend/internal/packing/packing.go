@@ -0,0 +1,99 @@
+package packing
+
+import (
+	"sort"
+)
+
+// epsilon absorbs rounding in dimensions stored as DECIMAL(10, 2).
+const epsilon = 1e-9
+
+// Box is an axis-aligned cuboid, used both for shelves and the units on them.
+type Box struct {
+	Length float64
+	Width  float64
+	Height float64
+}
+
+func (b Box) Volume() float64 {
+	return b.Length * b.Width * b.Height
+}
+
+func (b Box) contains(o Box) bool {
+	return o.Length <= b.Length+epsilon && o.Width <= b.Width+epsilon && o.Height <= b.Height+epsilon
+}
+
+// rotations returns the six axis-aligned orientations of b.
+func (b Box) rotations() [6]Box {
+	l, w, h := b.Length, b.Width, b.Height
+	return [6]Box{
+		{l, w, h}, {l, h, w},
+		{w, l, h}, {w, h, l},
+		{h, l, w}, {h, w, l},
+	}
+}
+
+// Fits reports whether every item can be placed inside container. It uses a
+// guillotine first-fit-decreasing heuristic with rotation: items are placed
+// largest first into the free space that leaves the least waste, and the rest
+// of that space is cut into three smaller free spaces. A false result means no
+// packing was found, not that none exists.
+func Fits(container Box, items []Box) bool {
+	total := 0.0
+	for _, item := range items {
+		total += item.Volume()
+	}
+	if total > container.Volume()+epsilon {
+		return false
+	}
+
+	sorted := append([]Box(nil), items...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Volume() > sorted[j].Volume()
+	})
+
+	spaces := []Box{container}
+	for _, item := range sorted {
+		best, placed := -1, Box{}
+		bestWaste := 0.0
+
+		for i, space := range spaces {
+			for _, rotated := range item.rotations() {
+				if !space.contains(rotated) {
+					continue
+				}
+
+				waste := space.Volume() - rotated.Volume()
+				if best < 0 || waste < bestWaste {
+					best, placed, bestWaste = i, rotated, waste
+				}
+			}
+		}
+
+		if best < 0 {
+			return false
+		}
+
+		space := spaces[best]
+		spaces = append(spaces[:best], spaces[best+1:]...)
+		spaces = append(spaces, split(space, placed)...)
+	}
+
+	return true
+}
+
+// split cuts the space left over after placing item in a corner of space.
+func split(space, item Box) []Box {
+	candidates := []Box{
+		{space.Length - item.Length, space.Width, space.Height},
+		{item.Length, space.Width - item.Width, space.Height},
+		{item.Length, item.Width, space.Height - item.Height},
+	}
+
+	var remaining []Box
+	for _, candidate := range candidates {
+		if candidate.Length > epsilon && candidate.Width > epsilon && candidate.Height > epsilon {
+			remaining = append(remaining, candidate)
+		}
+	}
+	return remaining
+}
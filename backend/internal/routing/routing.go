@@ -0,0 +1,307 @@
+package routing
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Location is a position on the shelf grid. Rows face aisles in pairs: rows 0
+// and 1 share aisle 0, rows 2 and 3 share aisle 1, and so on. Column -1 is
+// the front cross aisle and column Grid.Cols the back one, which is where
+// depots usually sit.
+type Location struct {
+	Row int `json:"row"`
+	Col int `json:"col"`
+}
+
+// Stop is a location that must be visited, identified by the caller.
+type Stop struct {
+	ID       string   `json:"id"`
+	Location Location `json:"location"`
+}
+
+type Strategy string
+
+const (
+	// SShape walks every aisle holding a stop end to end, alternating
+	// direction.
+	SShape Strategy = "s_shape"
+	// LargestGap enters each aisle from the nearer cross aisle and turns
+	// back at the largest gap between stops.
+	LargestGap Strategy = "largest_gap"
+	// TwoOpt improves a nearest-neighbour tour by reversing segments.
+	TwoOpt Strategy = "two_opt"
+	// Best runs every heuristic and keeps the shortest route.
+	Best Strategy = "best"
+)
+
+// Grid is the walkable warehouse: parallel aisles joined by a cross aisle
+// at the front and at the back. Distances are in grid cells.
+type Grid struct {
+	// Cols is the number of shelf columns along each aisle.
+	Cols int
+}
+
+// aisleSpacing is the distance between neighbouring aisles, which are
+// separated by two rows of shelves.
+const aisleSpacing = 2
+
+func aisle(l Location) int {
+	return l.Row / aisleSpacing
+}
+
+// position is the distance of l along its aisle from the front cross aisle.
+func position(l Location) int {
+	return l.Col + 1
+}
+
+func (g Grid) back() int {
+	return g.Cols + 1
+}
+
+// Distance is the shortest walk between a and b. Within an aisle it is the
+// straight line; between aisles the picker leaves through whichever cross
+// aisle is shorter.
+func (g Grid) Distance(a, b Location) float64 {
+	pa, pb := position(a), position(b)
+	if aisle(a) == aisle(b) {
+		return float64(abs(pa - pb))
+	}
+
+	front := pa + pb
+	back := 2*g.back() - pa - pb
+	if back < front {
+		front = back
+	}
+	return float64(front + aisleSpacing*abs(aisle(a)-aisle(b)))
+}
+
+// Route is an ordered visit of the stops between the depots.
+type Route struct {
+	Strategy Strategy `json:"strategy"`
+	Stops    []Stop   `json:"stops"`
+	Distance float64  `json:"distance"`
+}
+
+// Optimize orders stops into a short walk from start to end using strategy.
+// The heuristics give a near-optimal order, not a guaranteed shortest one.
+func Optimize(g Grid, start, end Location, stops []Stop, strategy Strategy) (Route, error) {
+	var order []Stop
+	switch strategy {
+	case SShape:
+		order = sShape(g, start, end, stops)
+	case LargestGap:
+		order = largestGap(g, start, end, stops)
+	case TwoOpt:
+		order = twoOpt(g, start, end, stops)
+	case Best, "":
+		best := Route{}
+		for _, s := range []Strategy{SShape, LargestGap, TwoOpt} {
+			route, _ := Optimize(g, start, end, stops, s)
+			if best.Stops == nil || route.Distance < best.Distance {
+				best = route
+			}
+		}
+		return best, nil
+	default:
+		return Route{}, fmt.Errorf("unknown routing strategy %q", strategy)
+	}
+
+	return Route{Strategy: strategy, Stops: order, Distance: g.length(start, end, order)}, nil
+}
+
+// length is the walk from start through order to end.
+func (g Grid) length(start, end Location, order []Stop) float64 {
+	total := 0.0
+	at := start
+	for _, stop := range order {
+		total += g.Distance(at, stop.Location)
+		at = stop.Location
+	}
+	return total + g.Distance(at, end)
+}
+
+// byAisle groups stops by aisle, listing the aisles in the order they are
+// reached from start: away from the start aisle towards the far end of the
+// warehouse.
+func byAisle(start Location, stops []Stop) ([]int, map[int][]Stop) {
+	groups := make(map[int][]Stop)
+	for _, stop := range stops {
+		a := aisle(stop.Location)
+		groups[a] = append(groups[a], stop)
+	}
+
+	aisles := make([]int, 0, len(groups))
+	for a := range groups {
+		aisles = append(aisles, a)
+	}
+	sort.Ints(aisles)
+
+	if len(aisles) > 1 && aisle(start)-aisles[0] > aisles[len(aisles)-1]-aisle(start) {
+		for i, j := 0, len(aisles)-1; i < j; i, j = i+1, j-1 {
+			aisles[i], aisles[j] = aisles[j], aisles[i]
+		}
+	}
+	return aisles, groups
+}
+
+// sortAlong orders stops by their position in the aisle, front to back or
+// back to front.
+func sortAlong(stops []Stop, forward bool) []Stop {
+	sorted := append([]Stop(nil), stops...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		pi, pj := position(sorted[i].Location), position(sorted[j].Location)
+		if forward {
+			return pi < pj
+		}
+		return pi > pj
+	})
+	return sorted
+}
+
+// shorter returns whichever of a and b is the shorter walk from start to
+// end, preferring a on a tie.
+func (g Grid) shorter(start, end Location, a, b []Stop) []Stop {
+	if g.length(start, end, b) < g.length(start, end, a) {
+		return b
+	}
+	return a
+}
+
+func sShape(g Grid, start, end Location, stops []Stop) []Stop {
+	aisles, groups := byAisle(start, stops)
+
+	walk := func(forward bool) []Stop {
+		var order []Stop
+		for _, a := range aisles {
+			order = append(order, sortAlong(groups[a], forward)...)
+			forward = !forward
+		}
+		return order
+	}
+
+	// Start walking away from whichever cross aisle the depot is nearer,
+	// unless starting the other way leaves the last aisle nearer the end
+	forward := position(start) <= g.back()-position(start)
+	return g.shorter(start, end, walk(forward), walk(!forward))
+}
+
+func largestGap(g Grid, start, end Location, stops []Stop) []Stop {
+	aisles, groups := byAisle(start, stops)
+	if len(aisles) == 1 {
+		return sShape(g, start, end, stops)
+	}
+
+	// The first and last aisles are walked end to end. Every aisle in
+	// between is split at its largest gap: the far part is picked from the
+	// far cross aisle on the way out, the near part from the near cross
+	// aisle on the way back.
+	forward := position(start) <= g.back()-position(start)
+	var farParts, nearParts []Stop
+	last := len(aisles) - 1
+	for _, a := range aisles[1:last] {
+		sorted := sortAlong(groups[a], true)
+		split := gapSplit(g, sorted)
+		front, back := sortAlong(sorted[:split], true), sortAlong(sorted[split:], false)
+		if forward {
+			farParts = append(farParts, back...)
+			nearParts = append(front, nearParts...)
+		} else {
+			farParts = append(farParts, front...)
+			nearParts = append(back, nearParts...)
+		}
+	}
+
+	// The last aisle is walked back towards the near cross aisle, unless
+	// walking it the other way gives a shorter way to the end
+	walk := func(lastForward bool) []Stop {
+		order := sortAlong(groups[aisles[0]], forward)
+		order = append(order, farParts...)
+		order = append(order, sortAlong(groups[aisles[last]], lastForward)...)
+		return append(order, nearParts...)
+	}
+	return g.shorter(start, end, walk(!forward), walk(forward))
+}
+
+// gapSplit returns the index in sorted, ordered front to back, where the
+// largest gap between consecutive stops or the cross aisles lies.
+func gapSplit(g Grid, sorted []Stop) int {
+	split, widest := 0, position(sorted[0].Location)
+	for i := 1; i < len(sorted); i++ {
+		gap := position(sorted[i].Location) - position(sorted[i-1].Location)
+		if gap > widest {
+			split, widest = i, gap
+		}
+	}
+	if g.back()-position(sorted[len(sorted)-1].Location) > widest {
+		split = len(sorted)
+	}
+	return split
+}
+
+// maxTwoOptPasses bounds the improvement loop on large pick lists.
+const maxTwoOptPasses = 50
+
+func twoOpt(g Grid, start, end Location, stops []Stop) []Stop {
+	order := nearestNeighbour(g, start, stops)
+
+	at := func(i int) Location {
+		switch {
+		case i < 0:
+			return start
+		case i >= len(order):
+			return end
+		default:
+			return order[i].Location
+		}
+	}
+
+	for pass := 0; pass < maxTwoOptPasses; pass++ {
+		improved := false
+		for i := 0; i < len(order)-1; i++ {
+			for j := i + 1; j < len(order); j++ {
+				// Reversing order[i..j] swaps edges (i-1, i) and (j, j+1)
+				// for (i-1, j) and (i, j+1)
+				before := g.Distance(at(i-1), at(i)) + g.Distance(at(j), at(j+1))
+				after := g.Distance(at(i-1), at(j)) + g.Distance(at(i), at(j+1))
+				if after < before {
+					for l, r := i, j; l < r; l, r = l+1, r-1 {
+						order[l], order[r] = order[r], order[l]
+					}
+					improved = true
+				}
+			}
+		}
+		if !improved {
+			break
+		}
+	}
+	return order
+}
+
+func nearestNeighbour(g Grid, start Location, stops []Stop) []Stop {
+	remaining := append([]Stop(nil), stops...)
+	order := make([]Stop, 0, len(stops))
+
+	at := start
+	for len(remaining) > 0 {
+		next := 0
+		for i := 1; i < len(remaining); i++ {
+			if g.Distance(at, remaining[i].Location) < g.Distance(at, remaining[next].Location) {
+				next = i
+			}
+		}
+
+		order = append(order, remaining[next])
+		at = remaining[next].Location
+		remaining = append(remaining[:next], remaining[next+1:]...)
+	}
+	return order
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,112 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// MaxTerms bounds how many words of a query are matched.
+const MaxTerms = 8
+
+// similarityThreshold is how close a word must be to a term, in trigram
+// similarity, to count as a misspelling of it.
+const similarityThreshold = 0.5
+
+// Terms splits a query into lower-case words of letters and digits, the
+// same way full-text search tokenizes, dropping duplicates.
+func Terms(query string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, word := range words(query) {
+		word = strings.ToLower(word)
+		if seen[word] {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+		if len(terms) == MaxTerms {
+			break
+		}
+	}
+	return terms
+}
+
+func words(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Highlight wraps the words of text that match a term in <mark> tags,
+// escaping the rest for HTML. A word matches a term it starts with or is
+// a near spelling of. The second result reports whether anything matched.
+func Highlight(text string, terms []string) (string, bool) {
+	var b strings.Builder
+	matched := false
+
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		word := text[start:end]
+		if matches(strings.ToLower(word), terms) {
+			b.WriteString("<mark>" + html.EscapeString(word) + "</mark>")
+			matched = true
+		} else {
+			b.WriteString(html.EscapeString(word))
+		}
+		start = -1
+	}
+
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		flush(i)
+		b.WriteString(html.EscapeString(string(r)))
+	}
+	flush(len(text))
+
+	return b.String(), matched
+}
+
+func matches(word string, terms []string) bool {
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) || Similarity(word, term) >= similarityThreshold {
+			return true
+		}
+	}
+	return false
+}
+
+// Similarity is the share of trigrams two words have in common, as
+// pg_trgm computes it: each word is padded with two spaces in front and
+// one behind before being cut into trigrams.
+func Similarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for t := range ta {
+		if tb[t] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
+
+func trigrams(word string) map[string]bool {
+	runes := []rune("  " + strings.ToLower(word) + " ")
+	set := make(map[string]bool, len(runes))
+	for i := 0; i+3 <= len(runes); i++ {
+		set[string(runes[i:i+3])] = true
+	}
+	return set
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Local stores objects as files under a root directory. The server hands
+// them out itself, so URLs point at BaseURL, which should be routed to
+// Get.
+type Local struct {
+	Root    string
+	BaseURL string
+}
+
+func NewLocal(root, baseURL string) (*Local, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &Local{Root: root, BaseURL: strings.TrimRight(baseURL, "/")}, nil
+}
+
+// path maps key into the root, refusing keys that would escape it.
+func (l *Local) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" || strings.Contains(key, "\\") {
+		return "", errors.New("invalid storage key")
+	}
+	return filepath.Join(l.Root, filepath.FromSlash(clean)), nil
+}
+
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a partial
+	// object
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, io.LimitReader(r, size)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), p)
+}
+
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(p))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return f, contentType, nil
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) URL(key string) string {
+	return l.BaseURL + "/" + key
+}
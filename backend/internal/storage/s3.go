@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3 stores objects in a bucket of an S3-compatible service such as MinIO.
+// Buckets are addressed by path, which every such service supports, and
+// requests are signed with AWS Signature Version 4.
+type S3 struct {
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+
+	// PublicURL is where clients reach the bucket, for example a CDN in
+	// front of it; objects are addressed through Endpoint when empty.
+	PublicURL string
+
+	Client *http.Client
+}
+
+func NewS3(endpoint, bucket, region, accessKey, secretKey, publicURL string) (*S3, error) {
+	if endpoint == "" || bucket == "" {
+		return nil, errors.New("s3 storage needs an endpoint and a bucket")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return &S3{
+		Endpoint:  strings.TrimRight(endpoint, "/"),
+		Bucket:    bucket,
+		Region:    region,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		PublicURL: strings.TrimRight(publicURL, "/"),
+		Client:    &http.Client{Timeout: time.Minute},
+	}, nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	// The payload is hashed into the signature, so it has to be read in
+	// full before the request goes out
+	body, err := io.ReadAll(io.LimitReader(r, size))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(s.Endpoint, key), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := s.do(req, body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(s.Endpoint, key), nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resp, err := s.do(req, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return resp.Body, resp.Header.Get("Content-Type"), nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(s.Endpoint, key), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(req, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3) URL(key string) string {
+	if s.PublicURL != "" {
+		return s.PublicURL + "/" + escapePath(key)
+	}
+	return s.objectURL(s.Endpoint, key)
+}
+
+func (s *S3) objectURL(base, key string) string {
+	return base + "/" + escapePath(s.Bucket) + "/" + escapePath(key)
+}
+
+// do signs and sends req, turning error responses into errors.
+func (s *S3) do(req *http.Request, body []byte) (*http.Response, error) {
+	s.sign(req, body, time.Now().UTC())
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("s3 %s %s: %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req.
+func (s *S3) sign(req *http.Request, body []byte, now time.Time) {
+	payloadHash := sha256.Sum256(body)
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+
+	var headers strings.Builder
+	for _, name := range names {
+		headers.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		headers.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonical))
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// escapePath escapes each segment of a slash-separated path the way S3
+// expects in canonical requests.
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = strings.ReplaceAll(url.PathEscape(segment), "+", "%2B")
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned by Get for keys that hold no object.
+var ErrNotFound = errors.New("object not found")
+
+// Storage keeps uploaded files under slash-separated keys. Drivers decide
+// where the bytes live and how clients reach them.
+type Storage interface {
+	// Put stores size bytes from r under key, replacing any existing
+	// object.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+
+	// Get opens the object under key along with its content type.
+	Get(ctx context.Context, key string) (io.ReadCloser, string, error)
+
+	// Delete removes the object under key; missing objects are not an
+	// error.
+	Delete(ctx context.Context, key string) error
+
+	// URL is where clients fetch the object under key.
+	URL(key string) string
+}
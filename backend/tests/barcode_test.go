@@ -0,0 +1,202 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aslam/backend/internal/barcode"
+)
+
+func TestBarcodeValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		symbology barcode.Symbology
+		code      string
+		valid     bool
+	}{
+		{name: "ean13", symbology: barcode.EAN13, code: "4006381333931", valid: true},
+		{name: "ean13 bad check digit", symbology: barcode.EAN13, code: "4006381333932"},
+		{name: "ean13 too short", symbology: barcode.EAN13, code: "400638133393"},
+		{name: "upc-a", symbology: barcode.UPCA, code: "036000291452", valid: true},
+		{name: "upc-a bad check digit", symbology: barcode.UPCA, code: "036000291453"},
+		{name: "gtin14", symbology: barcode.GTIN14, code: "10614141000415", valid: true},
+		{name: "gtin14 letters", symbology: barcode.GTIN14, code: "1061414100041A"},
+		{name: "code128", symbology: barcode.Code128, code: "PART-42/b", valid: true},
+		{name: "code128 control character", symbology: barcode.Code128, code: "PART\t42"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := barcode.Validate(tt.symbology, tt.code)
+			if tt.valid && err != nil {
+				t.Errorf("Expected %s to be valid, got %v", tt.code, err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("Expected %s to be invalid", tt.code)
+			}
+		})
+	}
+}
+
+func TestBarcodeGTIN(t *testing.T) {
+	// A UPC-A and the EAN-13 it is printed as are the same GTIN
+	upc, ok := barcode.GTIN("036000291452")
+	if !ok {
+		t.Fatal("Expected UPC-A to be a GTIN")
+	}
+	ean, ok := barcode.GTIN("0036000291452")
+	if !ok {
+		t.Fatal("Expected EAN-13 to be a GTIN")
+	}
+	if upc != ean || upc != "00036000291452" {
+		t.Errorf("Expected both to normalise to 00036000291452, got %s and %s", upc, ean)
+	}
+
+	if _, ok := barcode.GTIN("SKU001"); ok {
+		t.Error("Expected a SKU not to be a GTIN")
+	}
+}
+
+func TestCode128(t *testing.T) {
+	modules, err := barcode.EncodeCode128("SKU001")
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	render := func(modules []bool) string {
+		s := ""
+		for _, bar := range modules {
+			if bar {
+				s += "1"
+			} else {
+				s += "0"
+			}
+		}
+		return s
+	}
+
+	// Start B, six data symbols and the check symbol at 11 modules each,
+	// then the 13-module stop
+	if len(modules) != 8*11+13 {
+		t.Errorf("Expected %d modules, got %d", 8*11+13, len(modules))
+	}
+	if got := render(modules[:11]); got != "11010010000" {
+		t.Errorf("Expected start B pattern, got %s", got)
+	}
+	if got := render(modules[len(modules)-13:]); got != "1100011101011" {
+		t.Errorf("Expected stop pattern, got %s", got)
+	}
+
+	// Even digit runs pack into code set C
+	modules, err = barcode.EncodeCode128("036000291452")
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if got := render(modules[:11]); got != "11010011100" {
+		t.Errorf("Expected start C pattern, got %s", got)
+	}
+	if len(modules) != 8*11+13 {
+		t.Errorf("Expected %d modules, got %d", 8*11+13, len(modules))
+	}
+}
+
+func TestQR(t *testing.T) {
+	// Golden symbols from an independent reference encoder, byte mode at
+	// level M, masked with the pattern the ISO 18004 penalty rules rank
+	// lowest. Any error in the codewords, Reed-Solomon bytes, placement,
+	// masking or format bits changes some modules.
+	tests := []struct {
+		data   string
+		golden []string
+	}{
+		{
+			data: "SKU001",
+			golden: []string{
+				"#######.##.#..#######",
+				"#.....#..##...#.....#",
+				"#.###.#...###.#.###.#",
+				"#.###.#.#...#.#.###.#",
+				"#.###.#.#####.#.###.#",
+				"#.....#.###.#.#.....#",
+				"#######.#.#.#.#######",
+				"........#............",
+				"#...#.###...######..#",
+				".###.#.##.#.###....##",
+				"#..##.#.##..##....##.",
+				"#.##.......##..#...##",
+				"#.###.###.##..#######",
+				"........#####....##.#",
+				"#######.#.##..###..#.",
+				"#.....#..##..##.##..#",
+				"#.###.#.##..###..#..#",
+				"#.###.#...#.#####.###",
+				"#.###.#...#.##.###...",
+				"#.....#..#.##..###...",
+				"#######.##.#..#..#..#",
+			},
+		},
+		{
+			data: "SHELF:3f2504e0-4f89-11d3-9a0c-0305e82c3301",
+			golden: []string{
+				"#######..#.#..#...###.#######",
+				"#.....#...##.#.#....#.#.....#",
+				"#.###.#.##.##..#..#...#.###.#",
+				"#.###.#.#..#.##.###.#.#.###.#",
+				"#.###.#.##.##......#..#.###.#",
+				"#.....#.##...#.####.#.#.....#",
+				"#######.#.#.#.#.#.#.#.#######",
+				"........##..#.###............",
+				"#.#####....#.#.#.##.#.#####..",
+				".##....######.#.####.#######.",
+				"#.#####.##.#.#.##...#...#....",
+				"...#.#.#....#.###...#..###...",
+				".#.#.##..##..#.#####.#.#.....",
+				"..#.....###.#.#..#.#..#.##.#.",
+				"..#..####.#..#.#..#.##..#.#..",
+				".###.#..####..##.....#..#..#.",
+				"#.#######.#..#.###.###.#.####",
+				"##...#.##.###.#...##.##.#.##.",
+				"#.##.###.##.#..##.#...###.#..",
+				"#..#......#.#..........##...#",
+				"#..#..#..##..#.#############.",
+				"........#.##..#....##...#....",
+				"#######...#....#..###.#.###..",
+				"#.....#.#.....##..#.#...##.##",
+				"#.###.#.##..#..###..#####.###",
+				"#.###.#.#.####....#.##.#.#.##",
+				"#.###.#.#.#..#.#####..#.#.##.",
+				"#.....#...#.##.##...#......#.",
+				"#######.#...#.#..###.#..###..",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		matrix, err := barcode.EncodeQR(tt.data)
+		if err != nil {
+			t.Fatalf("Failed to encode %s: %v", tt.data, err)
+		}
+		if len(matrix) != len(tt.golden) {
+			t.Errorf("Expected %dx%d for %s, got %d", len(tt.golden), len(tt.golden), tt.data, len(matrix))
+			continue
+		}
+
+		for y, row := range matrix {
+			got := ""
+			for _, dark := range row {
+				if dark {
+					got += "#"
+				} else {
+					got += "."
+				}
+			}
+			if got != tt.golden[y] {
+				t.Errorf("Row %d of %s: expected %s, got %s", y, tt.data, tt.golden[y], got)
+			}
+		}
+	}
+
+	if _, err := barcode.EncodeQR(strings.Repeat("x", 300)); err == nil {
+		t.Error("Expected data too long error")
+	}
+}
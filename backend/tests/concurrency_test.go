@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/aslam/backend/internal/models"
+)
+
+func TestConcurrentAddRespectsCapacity(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	_, err := db.CreateProduct(ctx, &models.CreateProductRequest{
+		SKU:    "SKU020",
+		Name:   "Concurrent Product",
+		Volume: 1.0,
+		Weight: 1.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	shelf, err := db.CreateShelf(ctx, &models.CreateShelfRequest{
+		Name:      "Concurrent Shelf",
+		RowIndex:  2,
+		ColIndex:  2,
+		MaxVolume: 100.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create shelf: %v", err)
+	}
+
+	// 50 scanners each try to add 5 units; only 20 of them fit
+	const workers = 50
+	const perWorker = 5
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := db.AddItemToShelf(ctx, shelf.ID, &models.AddItemToShelfRequest{SKU: "SKU020", Quantity: perWorker}); err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	retrieved, err := db.GetShelfByID(ctx, shelf.ID)
+	if err != nil {
+		t.Fatalf("Failed to get shelf: %v", err)
+	}
+
+	if retrieved.UsedVolume > retrieved.MaxVolume {
+		t.Errorf("Shelf overfilled: used %f of %f", retrieved.UsedVolume, retrieved.MaxVolume)
+	}
+
+	if succeeded != 20 {
+		t.Errorf("Expected 20 successful additions, got %d", succeeded)
+	}
+
+	if len(retrieved.Items) != 1 {
+		t.Errorf("Expected a single merged row, got %d", len(retrieved.Items))
+	}
+
+	if retrieved.UsedVolume != float64(succeeded*perWorker) {
+		t.Errorf("Expected used volume %d, got %f", succeeded*perWorker, retrieved.UsedVolume)
+	}
+}
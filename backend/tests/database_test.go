@@ -2,12 +2,18 @@ package tests
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/aslam/backend/internal/database"
+	"github.com/aslam/backend/internal/listquery"
 	"github.com/aslam/backend/internal/models"
+	"github.com/google/uuid"
 )
 
 func TestUserOperations(t *testing.T) {
@@ -82,7 +88,7 @@ func TestProductOperations(t *testing.T) {
 	}
 
 	// Test list products
-	products, err := db.ListProducts(ctx)
+	products, _, err := db.ListProducts(ctx, &models.ProductFilter{}, nil)
 	if err != nil {
 		t.Fatalf("Failed to list products: %v", err)
 	}
@@ -91,10 +97,14 @@ func TestProductOperations(t *testing.T) {
 		t.Error("Expected at least one product")
 	}
 
-	// Test delete product
-	err = db.DeleteProduct(ctx, "SKU001")
+	// Test archive product
+	archived, err := db.ArchiveProduct(ctx, "SKU001")
 	if err != nil {
-		t.Fatalf("Failed to delete product: %v", err)
+		t.Fatalf("Failed to archive product: %v", err)
+	}
+
+	if archived.ArchivedAt == nil {
+		t.Error("Expected the product to be marked archived")
 	}
 }
 
@@ -130,7 +140,7 @@ func TestShelfOperations(t *testing.T) {
 	}
 
 	// Test add item to shelf
-	item, err := db.AddItemToShelf(ctx, shelf.ID, "SKU002", 5)
+	item, err := db.AddItemToShelf(ctx, shelf.ID, &models.AddItemToShelfRequest{SKU: "SKU002", Quantity: 5})
 	if err != nil {
 		t.Fatalf("Failed to add item to shelf: %v", err)
 	}
@@ -158,7 +168,7 @@ func TestShelfOperations(t *testing.T) {
 	}
 
 	// Test volume validation
-	_, err = db.AddItemToShelf(ctx, shelf.ID, "SKU002", 50)
+	_, err = db.AddItemToShelf(ctx, shelf.ID, &models.AddItemToShelfRequest{SKU: "SKU002", Quantity: 50})
 	if err == nil {
 		t.Error("Expected volume exceeded error")
 	}
@@ -169,10 +179,1892 @@ func TestShelfOperations(t *testing.T) {
 		t.Fatalf("Failed to remove item: %v", err)
 	}
 
-	// Test delete shelf
-	err = db.DeleteShelf(ctx, shelf.ID)
+	// Test archive shelf
+	_, err = db.ArchiveShelf(ctx, shelf.ID)
+	if err != nil {
+		t.Fatalf("Failed to archive shelf: %v", err)
+	}
+}
+
+func TestStockMovements(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	user, err := db.CreateUser(ctx, "movements@example.com", "password123", models.RoleEditor)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	ctx = database.WithActor(ctx, user.ID)
+
+	_, err = db.CreateProduct(ctx, &models.CreateProductRequest{
+		SKU:    "SKU010",
+		Name:   "Ledger Product",
+		Volume: 1.0,
+		Weight: 1.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	shelf, err := db.CreateShelf(ctx, &models.CreateShelfRequest{
+		Name:      "Ledger Shelf",
+		RowIndex:  1,
+		ColIndex:  1,
+		MaxVolume: 100.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create shelf: %v", err)
+	}
+
+	item, err := db.AddItemToShelf(ctx, shelf.ID, &models.AddItemToShelfRequest{SKU: "SKU010", Quantity: 10})
+	if err != nil {
+		t.Fatalf("Failed to add item to shelf: %v", err)
+	}
+
+	if err := db.UpdateItemQuantity(ctx, item.ID, &models.UpdateItemQuantityRequest{Quantity: 4}); err != nil {
+		t.Fatalf("Failed to update item quantity: %v", err)
+	}
+
+	if err := db.RemoveItemFromShelf(ctx, item.ID); err != nil {
+		t.Fatalf("Failed to remove item: %v", err)
+	}
+
+	movements, _, err := db.ListMovements(ctx, &models.MovementFilter{SKU: "SKU010", ShelfID: shelf.ID}, nil)
+	if err != nil {
+		t.Fatalf("Failed to list movements: %v", err)
+	}
+
+	if len(movements) != 3 {
+		t.Fatalf("Expected 3 movements, got %d", len(movements))
+	}
+
+	// Movements are returned newest first
+	expected := []int{-4, -6, 10}
+	for i, movement := range movements {
+		if movement.QuantityDelta != expected[i] {
+			t.Errorf("Movement %d: expected delta %d, got %d", i, expected[i], movement.QuantityDelta)
+		}
+		if movement.UserID != user.ID {
+			t.Errorf("Movement %d: expected user %s, got %s", i, user.ID, movement.UserID)
+		}
+	}
+}
+
+func TestTransferItems(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	_, err := db.CreateProduct(ctx, &models.CreateProductRequest{SKU: "SKU038", Name: "Transferred Product", Volume: 1.0, Weight: 1.0})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	from, err := db.CreateShelf(ctx, &models.CreateShelfRequest{Name: "Transfer Source", RowIndex: 10, ColIndex: 2, MaxVolume: 100.0})
+	if err != nil {
+		t.Fatalf("Failed to create shelf: %v", err)
+	}
+	to, err := db.CreateShelf(ctx, &models.CreateShelfRequest{Name: "Transfer Destination", RowIndex: 10, ColIndex: 3, MaxVolume: 10.0})
+	if err != nil {
+		t.Fatalf("Failed to create shelf: %v", err)
+	}
+	if _, err := db.AddItemToShelf(ctx, from.ID, &models.AddItemToShelfRequest{SKU: "SKU038", Quantity: 10}); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+	if _, err := db.AddItemToShelf(ctx, to.ID, &models.AddItemToShelfRequest{SKU: "SKU038", Quantity: 5}); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+
+	// Units merge into the destination's existing item
+	response, err := db.TransferItems(ctx, &models.TransferRequest{SKU: "SKU038", FromShelfID: from.ID, ToShelfID: to.ID, Quantity: 3})
+	if err != nil {
+		t.Fatalf("Failed to transfer: %v", err)
+	}
+	if response.From.ID != from.ID || response.From.OnHand != 7 {
+		t.Errorf("Expected 7 units left on the source, got %+v", response.From)
+	}
+	if response.To.ID != to.ID || response.To.OnHand != 8 || len(response.To.Items) != 1 {
+		t.Errorf("Expected 8 units in one item on the destination, got %+v", response.To)
+	}
+
+	// Overfilling the destination rolls the source back too
+	_, err = db.TransferItems(ctx, &models.TransferRequest{SKU: "SKU038", FromShelfID: from.ID, ToShelfID: to.ID, Quantity: 5})
+	var capacityErr *database.CapacityError
+	if !errors.As(err, &capacityErr) {
+		t.Fatalf("Expected capacity error, got %v", err)
+	}
+
+	source, err := db.GetShelfByID(ctx, from.ID)
+	if err != nil {
+		t.Fatalf("Failed to get shelf: %v", err)
+	}
+	if source.OnHand != 7 {
+		t.Errorf("Expected the failed transfer to leave 7 units on the source, got %d", source.OnHand)
+	}
+}
+
+func TestCapacityRules(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	_, err := db.CreateProduct(ctx, &models.CreateProductRequest{
+		SKU:    "SKU011",
+		Name:   "Capacity Product",
+		Volume: 2.0,
+		Weight: 1.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	shelf, err := db.CreateShelf(ctx, &models.CreateShelfRequest{
+		Name:      "Capacity Shelf",
+		RowIndex:  1,
+		ColIndex:  2,
+		MaxVolume: 50.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create shelf: %v", err)
+	}
+
+	item, err := db.AddItemToShelf(ctx, shelf.ID, &models.AddItemToShelfRequest{SKU: "SKU011", Quantity: 20})
+	if err != nil {
+		t.Fatalf("Failed to add item to shelf: %v", err)
+	}
+
+	// Growing the quantity past the limit is rejected
+	err = db.UpdateItemQuantity(ctx, item.ID, &models.UpdateItemQuantityRequest{Quantity: 30})
+	var capacityErr *database.CapacityError
+	if !errors.As(err, &capacityErr) {
+		t.Fatalf("Expected capacity error, got %v", err)
+	}
+	if len(capacityErr.Shelves) != 1 || capacityErr.Shelves[0].ShelfID != shelf.ID {
+		t.Errorf("Expected violation on shelf %s, got %+v", shelf.ID, capacityErr.Shelves)
+	}
+
+	// Shrinking the shelf below its stored volume is rejected
+	_, err = db.UpdateShelf(ctx, shelf.ID, &models.UpdateShelfRequest{MaxVolume: 30.0})
+	if !errors.As(err, &capacityErr) {
+		t.Fatalf("Expected capacity error, got %v", err)
+	}
+
+	// Growing the product volume overfills the shelf
+	_, err = db.UpdateProduct(ctx, "SKU011", &models.UpdateProductRequest{Volume: 3.0})
+	if !errors.As(err, &capacityErr) {
+		t.Fatalf("Expected capacity error, got %v", err)
+	}
+
+	// Forcing the change goes through and flags the shelf
+	_, err = db.UpdateShelf(ctx, shelf.ID, &models.UpdateShelfRequest{MaxVolume: 30.0, Force: true})
+	if err != nil {
+		t.Fatalf("Failed to force shelf update: %v", err)
+	}
+
+	retrieved, err := db.GetShelfByID(ctx, shelf.ID)
+	if err != nil {
+		t.Fatalf("Failed to get shelf: %v", err)
+	}
+
+	if !retrieved.OverCapacity {
+		t.Error("Expected shelf to be flagged as over capacity")
+	}
+
+	// Weight limits are enforced on add, and can be lifted again
+	weightShelf, err := db.CreateShelf(ctx, &models.CreateShelfRequest{
+		Name: "Weight Shelf", RowIndex: 9, ColIndex: 4, MaxVolume: 100.0, MaxWeight: 5.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create shelf: %v", err)
+	}
+	_, err = db.AddItemToShelf(ctx, weightShelf.ID, &models.AddItemToShelfRequest{SKU: "SKU011", Quantity: 6})
+	if !errors.As(err, &capacityErr) || capacityErr.Shelves[0].Exceeds[0] != "weight" {
+		t.Errorf("Expected a weight capacity error, got %v", err)
+	}
+
+	noLimit := 0.0
+	updated, err := db.UpdateShelf(ctx, weightShelf.ID, &models.UpdateShelfRequest{MaxVolume: 100.0, MaxWeight: &noLimit})
+	if err != nil {
+		t.Fatalf("Failed to remove weight limit: %v", err)
+	}
+	if updated.MaxWeight != 0 {
+		t.Errorf("Expected no weight limit, got %f", updated.MaxWeight)
+	}
+	if _, err := db.AddItemToShelf(ctx, weightShelf.ID, &models.AddItemToShelfRequest{SKU: "SKU011", Quantity: 6}); err != nil {
+		t.Errorf("Expected the add to fit once the limit is gone, got %v", err)
+	}
+
+	// Raising a quantity runs the same dimensional check as adding: two
+	// half-height boxes fill the shelf, so a third cannot go in even though
+	// the volume limit allows it
+	_, err = db.CreateProduct(ctx, &models.CreateProductRequest{
+		SKU: "SKU035", Name: "Boxed Product", Volume: 1.0, Weight: 1.0, Length: 10, Width: 10, Height: 5,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	boxShelf, err := db.CreateShelf(ctx, &models.CreateShelfRequest{
+		Name: "Box Shelf", RowIndex: 9, ColIndex: 3, MaxVolume: 100.0, Length: 10, Width: 10, Height: 10,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create shelf: %v", err)
+	}
+	boxes, err := db.AddItemToShelf(ctx, boxShelf.ID, &models.AddItemToShelfRequest{SKU: "SKU035", Quantity: 2})
+	if err != nil {
+		t.Fatalf("Failed to add item to shelf: %v", err)
+	}
+
+	err = db.UpdateItemQuantity(ctx, boxes.ID, &models.UpdateItemQuantityRequest{Quantity: 3})
+	if !errors.As(err, &capacityErr) || capacityErr.Shelves[0].Exceeds[0] != "dimensions" {
+		t.Errorf("Expected a dimensional capacity error, got %v", err)
+	}
+}
+
+func TestSerialNumbers(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	_, err := db.CreateProduct(ctx, &models.CreateProductRequest{
+		SKU:        "SKU012",
+		Name:       "Serialized Product",
+		Volume:     1.0,
+		Weight:     1.0,
+		Serialized: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	shelf, err := db.CreateShelf(ctx, &models.CreateShelfRequest{
+		Name:      "Serial Shelf",
+		RowIndex:  1,
+		ColIndex:  3,
+		MaxVolume: 100.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create shelf: %v", err)
+	}
+
+	// Serial count must match the quantity
+	_, err = db.AddItemToShelf(ctx, shelf.ID, &models.AddItemToShelfRequest{SKU: "SKU012", Quantity: 2, SerialNumbers: []string{"SN-001"}})
+	if err == nil {
+		t.Error("Expected serial count mismatch error")
+	}
+
+	_, err = db.AddItemToShelf(ctx, shelf.ID, &models.AddItemToShelfRequest{SKU: "SKU012", Quantity: 2, SerialNumbers: []string{"SN-001", "SN-002"}})
+	if err != nil {
+		t.Fatalf("Failed to add serialized item: %v", err)
+	}
+
+	// The same serial cannot be stocked twice
+	_, err = db.AddItemToShelf(ctx, shelf.ID, &models.AddItemToShelfRequest{SKU: "SKU012", Quantity: 1, SerialNumbers: []string{"SN-002"}})
+	if err == nil {
+		t.Error("Expected duplicate serial error")
+	}
+
+	lookup, err := db.GetSerial(ctx, "SN-002")
+	if err != nil {
+		t.Fatalf("Failed to look up serial: %v", err)
+	}
+
+	if lookup.Shelf == nil || lookup.Shelf.ID != shelf.ID {
+		t.Errorf("Expected serial on shelf %s", shelf.ID)
+	}
+
+	if len(lookup.Movements) != 1 {
+		t.Errorf("Expected 1 movement, got %d", len(lookup.Movements))
+	}
+}
+
+func TestReservations(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	_, err := db.CreateProduct(ctx, &models.CreateProductRequest{
+		SKU:    "SKU013",
+		Name:   "Reserved Product",
+		Volume: 1.0,
+		Weight: 1.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	shelf, err := db.CreateShelf(ctx, &models.CreateShelfRequest{
+		Name:      "Reservation Shelf",
+		RowIndex:  1,
+		ColIndex:  4,
+		MaxVolume: 100.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create shelf: %v", err)
+	}
+
+	item, err := db.AddItemToShelf(ctx, shelf.ID, &models.AddItemToShelfRequest{SKU: "SKU013", Quantity: 10})
+	if err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+
+	reservation, err := db.CreateReservation(ctx, &models.CreateReservationRequest{SKU: "SKU013", ShelfID: shelf.ID, Quantity: 6})
+	if err != nil {
+		t.Fatalf("Failed to create reservation: %v", err)
+	}
+
+	// Only 4 units remain available
+	_, err = db.CreateReservation(ctx, &models.CreateReservationRequest{SKU: "SKU013", Quantity: 5})
+	if err == nil {
+		t.Error("Expected insufficient available stock error")
+	}
+
+	retrieved, err := db.GetShelfByID(ctx, shelf.ID)
+	if err != nil {
+		t.Fatalf("Failed to get shelf: %v", err)
+	}
+
+	if retrieved.OnHand != 10 || retrieved.Allocated != 6 || retrieved.Available != 4 {
+		t.Errorf("Expected 10/6/4 on hand/allocated/available, got %d/%d/%d", retrieved.OnHand, retrieved.Allocated, retrieved.Available)
+	}
+
+	// Reserved stock cannot be removed
+	err = db.UpdateItemQuantity(ctx, item.ID, &models.UpdateItemQuantityRequest{Quantity: 5})
+	if err == nil {
+		t.Error("Expected reserved stock error")
+	}
+
+	if _, err := db.ConfirmReservation(ctx, reservation.ID); err != nil {
+		t.Fatalf("Failed to confirm reservation: %v", err)
+	}
+
+	released, err := db.ReleaseReservation(ctx, reservation.ID)
+	if err != nil {
+		t.Fatalf("Failed to release reservation: %v", err)
+	}
+
+	if released.Status != models.ReservationReleased {
+		t.Errorf("Expected status released, got %s", released.Status)
+	}
+
+	if err := db.UpdateItemQuantity(ctx, item.ID, &models.UpdateItemQuantityRequest{Quantity: 5}); err != nil {
+		t.Errorf("Failed to update quantity after release: %v", err)
+	}
+}
+
+func TestConcurrentRemovalsKeepReservations(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	_, err := db.CreateProduct(ctx, &models.CreateProductRequest{SKU: "SKU034", Name: "Contended Product", Volume: 1.0, Weight: 1.0})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	var itemIDs []string
+	for col := 1; col <= 2; col++ {
+		shelf, err := db.CreateShelf(ctx, &models.CreateShelfRequest{Name: fmt.Sprintf("Contended Shelf %d", col), RowIndex: 9, ColIndex: col, MaxVolume: 100.0})
+		if err != nil {
+			t.Fatalf("Failed to create shelf: %v", err)
+		}
+		item, err := db.AddItemToShelf(ctx, shelf.ID, &models.AddItemToShelfRequest{SKU: "SKU034", Quantity: 5})
+		if err != nil {
+			t.Fatalf("Failed to add item: %v", err)
+		}
+		itemIDs = append(itemIDs, item.ID)
+	}
+
+	// Either shelf may be emptied, but not both: 5 of the 10 units are held
+	if _, err := db.CreateReservation(ctx, &models.CreateReservationRequest{SKU: "SKU034", Quantity: 5}); err != nil {
+		t.Fatalf("Failed to create reservation: %v", err)
+	}
+
+	errs := make([]error, len(itemIDs))
+	var wg sync.WaitGroup
+	for i, id := range itemIDs {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			errs[i] = db.RemoveItemFromShelf(ctx, id)
+		}(i, id)
+	}
+	wg.Wait()
+
+	if (errs[0] == nil) == (errs[1] == nil) {
+		t.Errorf("Expected exactly one removal to succeed, got %v and %v", errs[0], errs[1])
+	}
+
+	product, err := db.GetProductBySKU(ctx, "SKU034")
+	if err != nil {
+		t.Fatalf("Failed to get product: %v", err)
+	}
+	if product.OnHand != 5 {
+		t.Errorf("Expected the reserved 5 units to stay on hand, got %d", product.OnHand)
+	}
+}
+
+func TestOrderPicking(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	_, err := db.CreateProduct(ctx, &models.CreateProductRequest{
+		SKU:    "SKU014",
+		Name:   "Ordered Product",
+		Volume: 1.0,
+		Weight: 1.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	var shelfIDs []string
+	for i := 0; i < 2; i++ {
+		shelf, err := db.CreateShelf(ctx, &models.CreateShelfRequest{
+			Name:      fmt.Sprintf("Order Shelf %d", i),
+			RowIndex:  3,
+			ColIndex:  i,
+			MaxVolume: 100.0,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create shelf: %v", err)
+		}
+
+		if _, err := db.AddItemToShelf(ctx, shelf.ID, &models.AddItemToShelfRequest{SKU: "SKU014", Quantity: 5}); err != nil {
+			t.Fatalf("Failed to add item: %v", err)
+		}
+		shelfIDs = append(shelfIDs, shelf.ID)
+	}
+
+	order, err := db.CreateOrder(ctx, &models.CreateOrderRequest{
+		Lines: []models.CreateOrderLineRequest{{SKU: "SKU014", Quantity: 8}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+
+	order, err = db.CreatePicklist(ctx, order.ID)
+	if err != nil {
+		t.Fatalf("Failed to create pick list: %v", err)
+	}
+
+	if len(order.Steps) != 2 {
+		t.Fatalf("Expected 2 pick steps, got %d", len(order.Steps))
+	}
+
+	// Allocated stock cannot be picked by anyone else
+	if _, err := db.CreateReservation(ctx, &models.CreateReservationRequest{SKU: "SKU014", Quantity: 3}); err == nil {
+		t.Error("Expected insufficient available stock error")
+	}
+
+	order, err = db.ConfirmPicks(ctx, order.ID, &models.ConfirmPicksRequest{})
 	if err != nil {
-		t.Fatalf("Failed to delete shelf: %v", err)
+		t.Fatalf("Failed to confirm picks: %v", err)
+	}
+
+	if order.Status != models.OrderPicked {
+		t.Errorf("Expected status picked, got %s", order.Status)
+	}
+
+	if order.Lines[0].PickedQuantity != 8 {
+		t.Errorf("Expected 8 units picked, got %d", order.Lines[0].PickedQuantity)
+	}
+
+	remaining := 0
+	for _, id := range shelfIDs {
+		shelf, err := db.GetShelfByID(ctx, id)
+		if err != nil {
+			t.Fatalf("Failed to get shelf: %v", err)
+		}
+		remaining += shelf.OnHand
+	}
+
+	if remaining != 2 {
+		t.Errorf("Expected 2 units left on the shelves, got %d", remaining)
+	}
+
+	// Stock on a shelf frozen for a count is not allocated
+	session, err := db.CreateCountSession(ctx, &models.CreateCountRequest{ShelfIDs: shelfIDs, Freeze: true})
+	if err != nil {
+		t.Fatalf("Failed to create count session: %v", err)
+	}
+	order, err = db.CreateOrder(ctx, &models.CreateOrderRequest{
+		Lines: []models.CreateOrderLineRequest{{SKU: "SKU014", Quantity: 1}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+	if _, err := db.CreatePicklist(ctx, order.ID); err == nil {
+		t.Error("Expected stock on frozen shelves to be left unallocated")
+	}
+
+	if _, err := db.CancelCount(ctx, session.ID); err != nil {
+		t.Fatalf("Failed to cancel count: %v", err)
+	}
+	if _, err := db.CreatePicklist(ctx, order.ID); err != nil {
+		t.Errorf("Expected allocation once the count is cancelled, got %v", err)
+	}
+}
+
+func TestLots(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	_, err := db.CreateProduct(ctx, &models.CreateProductRequest{SKU: "SKU037", Name: "Perishable Product", Volume: 1.0, Weight: 1.0})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	shelf, err := db.CreateShelf(ctx, &models.CreateShelfRequest{Name: "Lot Shelf", RowIndex: 10, ColIndex: 1, MaxVolume: 100.0})
+	if err != nil {
+		t.Fatalf("Failed to create shelf: %v", err)
+	}
+
+	// The later lot arrives first, so FIFO and FEFO disagree
+	today := time.Now().Truncate(24 * time.Hour)
+	soon, late := today.AddDate(0, 0, 5), today.AddDate(0, 0, 60)
+	if _, err := db.AddItemToShelf(ctx, shelf.ID, &models.AddItemToShelfRequest{SKU: "SKU037", Quantity: 3, LotNumber: "LATE", ExpiresAt: &late}); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+	if _, err := db.AddItemToShelf(ctx, shelf.ID, &models.AddItemToShelfRequest{SKU: "SKU037", Quantity: 3, LotNumber: "SOON", ExpiresAt: &soon}); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+
+	// Lots are kept apart on the shelf, and a lot keeps one expiry date
+	retrieved, err := db.GetShelfByID(ctx, shelf.ID)
+	if err != nil {
+		t.Fatalf("Failed to get shelf: %v", err)
+	}
+	if len(retrieved.Items) != 2 {
+		t.Errorf("Expected one item per lot, got %d", len(retrieved.Items))
+	}
+	if _, err := db.AddItemToShelf(ctx, shelf.ID, &models.AddItemToShelfRequest{SKU: "SKU037", Quantity: 1, LotNumber: "SOON", ExpiresAt: &late}); err == nil {
+		t.Error("Expected a lot with a different expiry date to be rejected")
+	}
+	if _, err := db.AddItemToShelf(ctx, shelf.ID, &models.AddItemToShelfRequest{SKU: "SKU037", Quantity: 1, LotNumber: "SOON"}); err != nil {
+		t.Fatalf("Failed to add to a lot without restating its expiry: %v", err)
+	}
+
+	expiring, _, err := db.ListExpiringStock(ctx, 30, nil)
+	if err != nil {
+		t.Fatalf("Failed to list expiring stock: %v", err)
+	}
+	var lots []string
+	for _, item := range expiring {
+		if item.SKU == "SKU037" {
+			lots = append(lots, item.LotNumber)
+		}
+	}
+	if len(lots) != 1 || lots[0] != "SOON" {
+		t.Errorf("Expected only lot SOON to expire within 30 days, got %v", lots)
+	}
+
+	// Picking takes the soonest-expiring lot first
+	order, err := db.CreateOrder(ctx, &models.CreateOrderRequest{
+		Lines: []models.CreateOrderLineRequest{{SKU: "SKU037", Quantity: 5}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+	if _, err := db.CreatePicklist(ctx, order.ID); err != nil {
+		t.Fatalf("Failed to create pick list: %v", err)
+	}
+	if _, err := db.ConfirmPicks(ctx, order.ID, &models.ConfirmPicksRequest{}); err != nil {
+		t.Fatalf("Failed to confirm picks: %v", err)
+	}
+
+	retrieved, err = db.GetShelfByID(ctx, shelf.ID)
+	if err != nil {
+		t.Fatalf("Failed to get shelf: %v", err)
+	}
+	if len(retrieved.Items) != 1 || retrieved.Items[0].LotNumber != "LATE" || retrieved.Items[0].Quantity != 2 {
+		t.Errorf("Expected 2 units of lot LATE left, got %+v", retrieved.Items)
+	}
+}
+
+func TestInboundReceiving(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	_, err := db.CreateProduct(ctx, &models.CreateProductRequest{
+		SKU:    "SKU015",
+		Name:   "Inbound Product",
+		Volume: 1.0,
+		Weight: 1.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	shelf, err := db.CreateShelf(ctx, &models.CreateShelfRequest{
+		Name:      "Inbound Shelf",
+		RowIndex:  4,
+		ColIndex:  0,
+		MaxVolume: 100.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create shelf: %v", err)
+	}
+
+	document, err := db.CreateInboundDocument(ctx, &models.CreateInboundRequest{
+		Type:      models.InboundPurchaseOrder,
+		Reference: "PO-1001",
+		Lines:     []models.CreateInboundLineRequest{{SKU: "SKU015", Quantity: 10}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create inbound document: %v", err)
+	}
+
+	document, err = db.ReceiveInbound(ctx, document.ID, &models.ReceiveRequest{
+		Lines: []models.ReceiveLineRequest{{SKU: "SKU015", Quantity: 7, LotNumber: "L-1"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to receive: %v", err)
+	}
+
+	if document.Lines[0].Discrepancy != models.DiscrepancyUnder || document.Lines[0].Variance != -3 {
+		t.Errorf("Expected under-delivery of 3, got %s %d", document.Lines[0].Discrepancy, document.Lines[0].Variance)
+	}
+
+	staged, _, err := db.ListStagedItems(ctx, document.ID, nil)
+	if err != nil {
+		t.Fatalf("Failed to list staged items: %v", err)
+	}
+
+	if len(staged) != 1 || staged[0].Quantity != 7 {
+		t.Fatalf("Expected 7 staged units, got %v", staged)
+	}
+
+	item, err := db.PutawayStagedItem(ctx, staged[0].ID, &models.PutawayRequest{ShelfID: shelf.ID, Quantity: 4})
+	if err != nil {
+		t.Fatalf("Failed to put away: %v", err)
+	}
+
+	if item.Quantity != 4 || item.LotNumber != "L-1" {
+		t.Errorf("Expected 4 units of lot L-1 on the shelf, got %d of %q", item.Quantity, item.LotNumber)
+	}
+
+	staged, _, err = db.ListStagedItems(ctx, document.ID, nil)
+	if err != nil {
+		t.Fatalf("Failed to list staged items: %v", err)
+	}
+
+	if len(staged) != 1 || staged[0].Quantity != 3 {
+		t.Errorf("Expected 3 units left in staging, got %v", staged)
+	}
+
+	if _, err := db.CloseInbound(ctx, document.ID); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	_, err = db.ReceiveInbound(ctx, document.ID, &models.ReceiveRequest{
+		Lines: []models.ReceiveLineRequest{{SKU: "SKU015", Quantity: 1}},
+	})
+	if err == nil {
+		t.Error("Expected receipt against a closed document to fail")
+	}
+}
+
+func TestInboundSerials(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	_, err := db.CreateProduct(ctx, &models.CreateProductRequest{
+		SKU:        "SKU039",
+		Name:       "Serialized Inbound Product",
+		Volume:     1.0,
+		Weight:     1.0,
+		Serialized: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	shelf, err := db.CreateShelf(ctx, &models.CreateShelfRequest{
+		Name:      "Serial Inbound Shelf",
+		RowIndex:  11,
+		ColIndex:  1,
+		MaxVolume: 100.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create shelf: %v", err)
+	}
+
+	_, err = db.AddItemToShelf(ctx, shelf.ID, &models.AddItemToShelfRequest{SKU: "SKU039", Quantity: 1, SerialNumbers: []string{"RCV-1"}})
+	if err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+
+	document, err := db.CreateInboundDocument(ctx, &models.CreateInboundRequest{
+		Type:      models.InboundPurchaseOrder,
+		Reference: "PO-SERIAL",
+		Lines:     []models.CreateInboundLineRequest{{SKU: "SKU039", Quantity: 5}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create inbound document: %v", err)
+	}
+
+	_, err = db.ReceiveInbound(ctx, document.ID, &models.ReceiveRequest{
+		Lines: []models.ReceiveLineRequest{{SKU: "SKU039", Quantity: 1, SerialNumbers: []string{"RCV-1"}}},
+	})
+	if err == nil {
+		t.Error("Expected receiving a serial already in stock to fail")
+	}
+
+	// Staged dates are plain dates, whatever time of day was sent
+	expiresAt := time.Date(2030, 6, 1, 15, 30, 0, 0, time.UTC)
+	_, err = db.ReceiveInbound(ctx, document.ID, &models.ReceiveRequest{
+		Lines: []models.ReceiveLineRequest{{SKU: "SKU039", Quantity: 2, SerialNumbers: []string{"RCV-2", "RCV-3"}, ExpiresAt: &expiresAt}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to receive: %v", err)
+	}
+
+	staged, _, err := db.ListStagedItems(ctx, document.ID, nil)
+	if err != nil {
+		t.Fatalf("Failed to list staged items: %v", err)
+	}
+	if len(staged) != 1 || staged[0].ExpiresAt == nil || staged[0].ExpiresAt.Hour() != 0 || staged[0].ExpiresAt.Day() != 1 {
+		t.Errorf("Expected one staged item expiring on 2030-06-01, got %v", staged)
+	}
+
+	_, err = db.ReceiveInbound(ctx, document.ID, &models.ReceiveRequest{
+		Lines: []models.ReceiveLineRequest{{SKU: "SKU039", Quantity: 1, SerialNumbers: []string{"RCV-3"}}},
+	})
+	if err == nil {
+		t.Error("Expected receiving a serial already in staging to fail")
+	}
+
+	_, err = db.ReceiveInbound(ctx, document.ID, &models.ReceiveRequest{
+		Lines: []models.ReceiveLineRequest{
+			{SKU: "SKU039", Quantity: 1, SerialNumbers: []string{"RCV-4"}},
+			{SKU: "SKU039", Quantity: 1, SerialNumbers: []string{"RCV-4"}},
+		},
+	})
+	if err == nil {
+		t.Error("Expected a serial received twice in one request to fail")
+	}
+
+	staged, _, err = db.ListStagedItems(ctx, document.ID, nil)
+	if err != nil {
+		t.Fatalf("Failed to list staged items: %v", err)
+	}
+	if len(staged) != 1 {
+		t.Errorf("Expected rejected receipts to stage nothing, got %v", staged)
+	}
+}
+
+func TestPutawaySuggestions(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	_, err := db.CreateProduct(ctx, &models.CreateProductRequest{
+		SKU:    "SKU016",
+		Name:   "Putaway Product",
+		Volume: 1.0,
+		Weight: 1.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	stocked, err := db.CreateShelf(ctx, &models.CreateShelfRequest{
+		Name:      "Stocked Shelf",
+		RowIndex:  5,
+		ColIndex:  3,
+		MaxVolume: 100.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create shelf: %v", err)
+	}
+
+	if _, err := db.AddItemToShelf(ctx, stocked.ID, &models.AddItemToShelfRequest{SKU: "SKU016", Quantity: 5}); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+
+	// Too small for the requested quantity
+	_, err = db.CreateShelf(ctx, &models.CreateShelfRequest{
+		Name:      "Tiny Shelf",
+		RowIndex:  5,
+		ColIndex:  4,
+		MaxVolume: 2.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create shelf: %v", err)
+	}
+
+	req := &models.PutawaySuggestRequest{SKU: "SKU016", Quantity: 10, Strategy: models.PutawayConsolidate, Limit: 100}
+	suggestions, err := db.SuggestPutaway(ctx, req)
+	if err != nil {
+		t.Fatalf("Failed to suggest putaway: %v", err)
+	}
+
+	if len(suggestions) == 0 || suggestions[0].ShelfID != stocked.ID {
+		t.Fatalf("Expected the stocked shelf to rank first, got %v", suggestions)
+	}
+
+	for _, suggestion := range suggestions {
+		if suggestion.ShelfName == "Tiny Shelf" {
+			t.Error("Expected shelves without room to be excluded")
+		}
+	}
+
+	response, err := db.ApplyPutaway(ctx, &models.ApplyPutawayRequest{PutawaySuggestRequest: *req})
+	if err != nil {
+		t.Fatalf("Failed to apply putaway: %v", err)
+	}
+
+	if response.Suggestion.ShelfID != stocked.ID || response.Item.Quantity != 15 {
+		t.Errorf("Expected 15 units on the stocked shelf, got %d on %s", response.Item.Quantity, response.Suggestion.ShelfName)
+	}
+}
+
+func TestCycleCount(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	for _, sku := range []string{"SKU017", "SKU018"} {
+		_, err := db.CreateProduct(ctx, &models.CreateProductRequest{
+			SKU:    sku,
+			Name:   "Counted Product",
+			Volume: 1.0,
+			Weight: 1.0,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create product: %v", err)
+		}
+	}
+
+	shelf, err := db.CreateShelf(ctx, &models.CreateShelfRequest{
+		Name:      "Count Shelf",
+		RowIndex:  6,
+		ColIndex:  0,
+		MaxVolume: 100.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create shelf: %v", err)
+	}
+
+	if _, err := db.AddItemToShelf(ctx, shelf.ID, &models.AddItemToShelfRequest{SKU: "SKU017", Quantity: 10}); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+
+	session, err := db.CreateCountSession(ctx, &models.CreateCountRequest{ShelfIDs: []string{shelf.ID}, Freeze: true})
+	if err != nil {
+		t.Fatalf("Failed to create count session: %v", err)
+	}
+
+	if len(session.Lines) != 1 || session.Lines[0].ExpectedQuantity != 10 {
+		t.Fatalf("Expected a snapshot of 10 units, got %v", session.Lines)
+	}
+
+	// The shelf is frozen while the count is open
+	if _, err := db.AddItemToShelf(ctx, shelf.ID, &models.AddItemToShelfRequest{SKU: "SKU017", Quantity: 1}); err == nil {
+		t.Error("Expected frozen shelf error")
+	}
+
+	session, err = db.SubmitCounts(ctx, session.ID, &models.SubmitCountsRequest{
+		Lines: []models.SubmitCountLineRequest{
+			{ShelfID: shelf.ID, SKU: "SKU017", Quantity: 8},
+			{ShelfID: shelf.ID, SKU: "SKU018", Quantity: 3},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to submit counts: %v", err)
+	}
+
+	if len(session.Lines) != 2 {
+		t.Fatalf("Expected the unexpected SKU to get its own line, got %d lines", len(session.Lines))
+	}
+
+	if _, err := db.ApproveCount(ctx, session.ID, &models.ApproveCountRequest{ReasonCode: models.AdjustmentMiscount}); err != nil {
+		t.Fatalf("Failed to approve count: %v", err)
+	}
+
+	retrieved, err := db.GetShelfByID(ctx, shelf.ID)
+	if err != nil {
+		t.Fatalf("Failed to get shelf: %v", err)
+	}
+
+	quantities := make(map[string]int)
+	for _, item := range retrieved.Items {
+		quantities[item.SKU] += item.Quantity
+	}
+
+	if quantities["SKU017"] != 8 || quantities["SKU018"] != 3 {
+		t.Errorf("Expected 8 and 3 units after approval, got %v", quantities)
+	}
+
+	movements, _, err := db.ListMovements(ctx, &models.MovementFilter{ShelfID: shelf.ID}, nil)
+	if err != nil {
+		t.Fatalf("Failed to list movements: %v", err)
+	}
+
+	for _, movement := range movements {
+		if movement.Reason == models.MovementCount && movement.ReasonCode != string(models.AdjustmentMiscount) {
+			t.Errorf("Expected reason code miscount, got %q", movement.ReasonCode)
+		}
+	}
+}
+
+func TestCountFrozenSerializedShelf(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	_, err := db.CreateProduct(ctx, &models.CreateProductRequest{
+		SKU:        "SKU040",
+		Name:       "Counted Serialized Product",
+		Volume:     1.0,
+		Weight:     1.0,
+		Serialized: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	shelf, err := db.CreateShelf(ctx, &models.CreateShelfRequest{
+		Name:      "Counted Serial Shelf",
+		RowIndex:  11,
+		ColIndex:  3,
+		MaxVolume: 100.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create shelf: %v", err)
+	}
+
+	_, err = db.AddItemToShelf(ctx, shelf.ID, &models.AddItemToShelfRequest{SKU: "SKU040", Quantity: 1, SerialNumbers: []string{"CNT-1"}})
+	if err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+
+	session, err := db.CreateCountSession(ctx, &models.CreateCountRequest{ShelfIDs: []string{shelf.ID}, Freeze: true})
+	if err != nil {
+		t.Fatalf("Failed to create count session: %v", err)
+	}
+
+	// Putaway passes over the frozen shelf, even though it holds the SKU
+	req := &models.PutawaySuggestRequest{SKU: "SKU040", Quantity: 1, Strategy: models.PutawayConsolidate, Limit: 100}
+	suggestions, err := db.SuggestPutaway(ctx, req)
+	if err != nil {
+		t.Fatalf("Failed to suggest putaway: %v", err)
+	}
+	for _, suggestion := range suggestions {
+		if suggestion.ShelfID == shelf.ID {
+			t.Error("Expected the frozen shelf to be excluded")
+		}
+	}
+
+	// Units found beyond the snapshot need their serials
+	_, err = db.SubmitCounts(ctx, session.ID, &models.SubmitCountsRequest{
+		Lines: []models.SubmitCountLineRequest{{ShelfID: shelf.ID, SKU: "SKU040", Quantity: 2}},
+	})
+	if err == nil {
+		t.Error("Expected a found serialized unit without a serial to be rejected")
+	}
+	_, err = db.SubmitCounts(ctx, session.ID, &models.SubmitCountsRequest{
+		Lines: []models.SubmitCountLineRequest{{ShelfID: shelf.ID, SKU: "SKU040", Quantity: 2, SerialNumbers: []string{"CNT-2"}}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to submit counts: %v", err)
+	}
+
+	if _, err := db.ApproveCount(ctx, session.ID, &models.ApproveCountRequest{ReasonCode: models.AdjustmentFound}); err != nil {
+		t.Fatalf("Failed to approve count: %v", err)
+	}
+
+	lookup, err := db.GetSerial(ctx, "CNT-2")
+	if err != nil {
+		t.Fatalf("Failed to look up serial: %v", err)
+	}
+	if !lookup.InStock || lookup.Shelf == nil || lookup.Shelf.ID != shelf.ID {
+		t.Errorf("Expected the found serial on the counted shelf, got %+v", lookup)
+	}
+}
+
+func TestReorderLevels(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	_, err := db.CreateProduct(ctx, &models.CreateProductRequest{
+		SKU:          "SKU019",
+		Name:         "Reordered Product",
+		Volume:       1.0,
+		Weight:       1.0,
+		MinStock:     2,
+		ReorderPoint: 5,
+		MaxStock:     20,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	// Levels must be ordered
+	_, err = db.CreateProduct(ctx, &models.CreateProductRequest{
+		SKU:          "SKU021",
+		Name:         "Misconfigured Product",
+		Volume:       1.0,
+		Weight:       1.0,
+		ReorderPoint: 10,
+		MaxStock:     5,
+	})
+	if err == nil {
+		t.Error("Expected stock level ordering error")
+	}
+
+	shelf, err := db.CreateShelf(ctx, &models.CreateShelfRequest{
+		Name:      "Reorder Shelf",
+		RowIndex:  6,
+		ColIndex:  1,
+		MaxVolume: 100.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create shelf: %v", err)
+	}
+
+	if _, err := db.AddItemToShelf(ctx, shelf.ID, &models.AddItemToShelfRequest{SKU: "SKU019", Quantity: 3}); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+
+	product, err := db.GetProductBySKU(ctx, "SKU019")
+	if err != nil {
+		t.Fatalf("Failed to get product: %v", err)
+	}
+
+	if product.OnHand != 3 {
+		t.Errorf("Expected 3 on hand, got %d", product.OnHand)
+	}
+
+	suggestions, _, err := db.ListBelowReorder(ctx, nil)
+	if err != nil {
+		t.Fatalf("Failed to list reorder suggestions: %v", err)
+	}
+
+	found := false
+	for _, s := range suggestions {
+		if s.SKU == "SKU019" {
+			found = true
+			if s.SuggestedQuantity != 17 {
+				t.Errorf("Expected suggested quantity 17, got %d", s.SuggestedQuantity)
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected SKU019 below its reorder point")
+	}
+
+	if err := db.CheckStockLevels(ctx, "SKU019"); err != nil {
+		t.Fatalf("Failed to check stock levels: %v", err)
+	}
+
+	alerts, _, err := db.ListStockAlerts(ctx, false, nil)
+	if err != nil {
+		t.Fatalf("Failed to list alerts: %v", err)
+	}
+
+	raised := make(map[models.StockAlertKind]bool)
+	for _, alert := range alerts {
+		if alert.SKU == "SKU019" {
+			raised[alert.Kind] = true
+		}
+	}
+	if !raised[models.AlertBelowReorder] || raised[models.AlertBelowMinimum] {
+		t.Errorf("Expected only a below-reorder alert, got %v", raised)
+	}
+}
+
+func TestValuation(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	_, err := db.CreateProduct(ctx, &models.CreateProductRequest{
+		SKU:           "SKU022",
+		Name:          "FIFO Product",
+		Volume:        1.0,
+		Weight:        1.0,
+		CostingMethod: models.CostingFIFO,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	shelf, err := db.CreateShelf(ctx, &models.CreateShelfRequest{
+		Name:      "Valuation Shelf",
+		RowIndex:  7,
+		ColIndex:  1,
+		MaxVolume: 100.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create shelf: %v", err)
+	}
+
+	if _, err := db.AddItemToShelf(ctx, shelf.ID, &models.AddItemToShelfRequest{SKU: "SKU022", Quantity: 2, LotNumber: "V1", UnitCost: 10}); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+	later, err := db.AddItemToShelf(ctx, shelf.ID, &models.AddItemToShelfRequest{SKU: "SKU022", Quantity: 2, LotNumber: "V2", UnitCost: 20})
+	if err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+
+	// FIFO costs the removal at the oldest layer, whichever lot leaves
+	if err := db.RemoveItemFromShelf(ctx, later.ID); err != nil {
+		t.Fatalf("Failed to remove item: %v", err)
+	}
+
+	entries, _, err := db.ListCOGS(ctx, &models.COGSFilter{SKU: "SKU022"}, nil)
+	if err != nil {
+		t.Fatalf("Failed to list COGS: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Quantity != 2 || entries[0].Cost != 20 {
+		t.Errorf("Expected 2 units costing 20, got %+v", entries)
+	}
+
+	report, err := db.GetValuation(ctx, &models.ValuationFilter{})
+	if err != nil {
+		t.Fatalf("Failed to get valuation: %v", err)
+	}
+	for _, v := range report.SKUs {
+		if v.SKU == "SKU022" && v.Value != 40 {
+			t.Errorf("Expected FIFO value 40, got %v", v.Value)
+		}
+	}
+
+	// The moving average of 15 values the same two units at 30
+	report, err = db.GetValuation(ctx, &models.ValuationFilter{Method: models.CostingAverage})
+	if err != nil {
+		t.Fatalf("Failed to get valuation: %v", err)
+	}
+	for _, v := range report.SKUs {
+		if v.SKU == "SKU022" && v.Value != 30 {
+			t.Errorf("Expected average value 30, got %v", v.Value)
+		}
+	}
+}
+
+func TestUnitsOfMeasure(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	_, err := db.CreateProduct(ctx, &models.CreateProductRequest{
+		SKU:    "SKU023",
+		Name:   "Packed Product",
+		Volume: 0.5,
+		Weight: 0.5,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	// Each level must hold a whole number of the level below
+	_, err = db.SetProductUnits(ctx, "SKU023", &models.SetProductUnitsRequest{Units: []models.ProductUnitRequest{
+		{Unit: "case", Factor: 12},
+		{Unit: "pallet", Factor: 50},
+	}})
+	if err == nil {
+		t.Error("Expected uneven hierarchy error")
+	}
+
+	units, err := db.SetProductUnits(ctx, "SKU023", &models.SetProductUnitsRequest{Units: []models.ProductUnitRequest{
+		{Unit: "case", Factor: 12, Volume: 5, Weight: 10},
+		{Unit: "pallet", Factor: 48},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to set units: %v", err)
+	}
+	if len(units) != 3 || units[1].Volume != 5 || units[2].Volume != 24 {
+		t.Errorf("Unexpected units: %+v", units)
+	}
+
+	shelf, err := db.CreateShelf(ctx, &models.CreateShelfRequest{
+		Name:      "Pallet Shelf",
+		RowIndex:  7,
+		ColIndex:  2,
+		MaxVolume: 100.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create shelf: %v", err)
+	}
+
+	if _, err := db.AddItemToShelf(ctx, shelf.ID, &models.AddItemToShelfRequest{SKU: "SKU023", Quantity: 1, Unit: "crate"}); err == nil {
+		t.Error("Expected unknown unit error")
+	}
+
+	for _, add := range []models.AddItemToShelfRequest{
+		{SKU: "SKU023", Quantity: 1, Unit: "pallet"},
+		{SKU: "SKU023", Quantity: 2, Unit: "case"},
+		{SKU: "SKU023", Quantity: 5},
+	} {
+		if _, err := db.AddItemToShelf(ctx, shelf.ID, &add); err != nil {
+			t.Fatalf("Failed to add item: %v", err)
+		}
+	}
+
+	response, err := db.GetShelfByID(ctx, shelf.ID)
+	if err != nil {
+		t.Fatalf("Failed to get shelf: %v", err)
+	}
+
+	if len(response.Items) != 1 || response.Items[0].Quantity != 77 {
+		t.Fatalf("Expected 77 units on the shelf, got %+v", response.Items)
+	}
+	if got := response.Items[0].QuantityBreakdown; got != "1 pallet + 2 cases + 5 each" {
+		t.Errorf("Unexpected breakdown %q", got)
+	}
+
+	// A packed case is checked at its own weight, heavier than its 12 eaches
+	light, err := db.CreateShelf(ctx, &models.CreateShelfRequest{
+		Name: "Light Shelf", RowIndex: 9, ColIndex: 5, MaxVolume: 100.0, MaxWeight: 8.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create shelf: %v", err)
+	}
+	_, err = db.AddItemToShelf(ctx, light.ID, &models.AddItemToShelfRequest{SKU: "SKU023", Quantity: 1, Unit: "case"})
+	var capacityErr *database.CapacityError
+	if !errors.As(err, &capacityErr) {
+		t.Errorf("Expected a packed case to exceed the weight limit, got %v", err)
+	}
+	if _, err := db.AddItemToShelf(ctx, light.ID, &models.AddItemToShelfRequest{SKU: "SKU023", Quantity: 12}); err != nil {
+		t.Errorf("Expected 12 loose units to fit, got %v", err)
+	}
+
+	// A case packed smaller than its 12 eaches is still charged for them
+	small, err := db.CreateShelf(ctx, &models.CreateShelfRequest{
+		Name: "Small Shelf", RowIndex: 11, ColIndex: 2, MaxVolume: 10.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create shelf: %v", err)
+	}
+	if _, err := db.AddItemToShelf(ctx, small.ID, &models.AddItemToShelfRequest{SKU: "SKU023", Quantity: 1, Unit: "case"}); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+	_, err = db.AddItemToShelf(ctx, small.ID, &models.AddItemToShelfRequest{SKU: "SKU023", Quantity: 1, Unit: "case"})
+	if !errors.As(err, &capacityErr) {
+		t.Errorf("Expected a second case to exceed the volume limit, got %v", err)
+	}
+	response, err = db.GetShelfByID(ctx, small.ID)
+	if err != nil {
+		t.Fatalf("Failed to get shelf: %v", err)
+	}
+	if response.UsedVolume > response.MaxVolume || response.OverCapacity {
+		t.Errorf("Expected the shelf within capacity, used %v of %v", response.UsedVolume, response.MaxVolume)
+	}
+}
+
+func TestBarcodeScan(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	_, err := db.CreateProduct(ctx, &models.CreateProductRequest{
+		SKU:    "SKU024",
+		Name:   "Barcoded Product",
+		Volume: 1.0,
+		Weight: 1.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	if _, err := db.AddBarcode(ctx, "SKU024", &models.AddBarcodeRequest{Code: "036000291453", Type: models.BarcodeUPCA}); err == nil {
+		t.Error("Expected check digit error")
+	}
+	if _, err := db.AddBarcode(ctx, "SKU024", &models.AddBarcodeRequest{Code: "036000291452", Type: models.BarcodeUPCA}); err != nil {
+		t.Fatalf("Failed to add barcode: %v", err)
+	}
+
+	// The EAN-13 form of the same GTIN is taken
+	if _, err := db.AddBarcode(ctx, "SKU024", &models.AddBarcodeRequest{Code: "0036000291452", Type: models.BarcodeEAN13}); err == nil {
+		t.Error("Expected duplicate GTIN error")
+	}
+
+	result, err := db.Scan(ctx, "0036000291452")
+	if err != nil {
+		t.Fatalf("Failed to scan barcode: %v", err)
+	}
+	if result.Kind != models.ScanProduct || result.Product.SKU != "SKU024" {
+		t.Errorf("Expected SKU024, got %+v", result)
+	}
+	if len(result.Product.Barcodes) != 1 {
+		t.Errorf("Expected 1 barcode on product, got %v", result.Product.Barcodes)
+	}
+
+	// A digit-only Code128 value claims its GTIN form as well
+	_, err = db.CreateProduct(ctx, &models.CreateProductRequest{SKU: "SKU036", Name: "Colliding Product", Volume: 1.0, Weight: 1.0})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	if _, err := db.AddBarcode(ctx, "SKU024", &models.AddBarcodeRequest{Code: "4006381333931", Type: models.BarcodeCode128}); err != nil {
+		t.Fatalf("Failed to add barcode: %v", err)
+	}
+	if _, err := db.AddBarcode(ctx, "SKU036", &models.AddBarcodeRequest{Code: "04006381333931", Type: models.BarcodeGTIN14}); err == nil {
+		t.Error("Expected the GTIN-14 form of a Code128 value to be taken")
+	}
+	result, err = db.Scan(ctx, "04006381333931")
+	if err != nil {
+		t.Fatalf("Failed to scan barcode: %v", err)
+	}
+	if result.Product.SKU != "SKU024" {
+		t.Errorf("Expected SKU024, got %+v", result.Product)
+	}
+
+	shelf, err := db.CreateShelf(ctx, &models.CreateShelfRequest{
+		Name:      "Scanned Shelf",
+		RowIndex:  7,
+		ColIndex:  3,
+		MaxVolume: 100.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create shelf: %v", err)
+	}
+
+	result, err = db.Scan(ctx, models.ShelfLabelPrefix+shelf.ID)
+	if err != nil {
+		t.Fatalf("Failed to scan shelf label: %v", err)
+	}
+	if result.Kind != models.ScanShelf || result.Shelf.ID != shelf.ID {
+		t.Errorf("Expected shelf %s, got %+v", shelf.ID, result)
+	}
+
+	if _, err := db.Scan(ctx, "no-such-code"); err == nil {
+		t.Error("Expected unrecognised code error")
+	}
+}
+
+func TestCategories(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	tools, err := db.CreateCategory(ctx, &models.CreateCategoryRequest{Name: "Tools"})
+	if err != nil {
+		t.Fatalf("Failed to create category: %v", err)
+	}
+	power, err := db.CreateCategory(ctx, &models.CreateCategoryRequest{Name: "Power Tools", ParentID: tools.ID})
+	if err != nil {
+		t.Fatalf("Failed to create category: %v", err)
+	}
+	drills, err := db.CreateCategory(ctx, &models.CreateCategoryRequest{Name: "Drills", ParentID: power.ID})
+	if err != nil {
+		t.Fatalf("Failed to create category: %v", err)
+	}
+
+	if _, err := db.CreateCategory(ctx, &models.CreateCategoryRequest{Name: "drills", ParentID: power.ID}); err == nil {
+		t.Error("Expected duplicate sibling name error")
+	}
+
+	// A category cannot move below its own descendant
+	if _, err := db.MoveCategory(ctx, tools.ID, &models.MoveCategoryRequest{ParentID: drills.ID}); err == nil {
+		t.Error("Expected cycle error")
+	}
+
+	_, err = db.CreateProduct(ctx, &models.CreateProductRequest{
+		SKU:        "SKU025",
+		Name:       "Cordless Drill",
+		Volume:     1.0,
+		Weight:     1.0,
+		CategoryID: drills.ID,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	shelf, err := db.CreateShelf(ctx, &models.CreateShelfRequest{
+		Name:      "Tool Shelf",
+		RowIndex:  7,
+		ColIndex:  4,
+		MaxVolume: 100.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create shelf: %v", err)
+	}
+
+	if _, err := db.AddItemToShelf(ctx, shelf.ID, &models.AddItemToShelfRequest{SKU: "SKU025", Quantity: 4}); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+
+	products, _, err := db.ListProducts(ctx, &models.ProductFilter{Category: tools.ID}, nil)
+	if err != nil {
+		t.Fatalf("Failed to list products: %v", err)
+	}
+	if len(products) != 1 || products[0].SKU != "SKU025" {
+		t.Errorf("Expected SKU025 under Tools, got %+v", products)
+	}
+
+	shelves, _, err := db.ListShelfs(ctx, &models.ShelfFilter{Category: tools.ID}, nil)
+	if err != nil {
+		t.Fatalf("Failed to list shelves: %v", err)
+	}
+	if len(shelves) != 1 || shelves[0].ID != shelf.ID {
+		t.Errorf("Expected only the tool shelf, got %d shelves", len(shelves))
+	}
+
+	category, err := db.GetCategory(ctx, tools.ID)
+	if err != nil {
+		t.Fatalf("Failed to get category: %v", err)
+	}
+	if category.ProductCount != 1 || category.OnHand != 4 {
+		t.Errorf("Expected 1 product and 4 on hand under Tools, got %d and %d", category.ProductCount, category.OnHand)
+	}
+
+	// Deleting the middle category hands Drills to Tools
+	if err := db.DeleteCategory(ctx, power.ID); err != nil {
+		t.Fatalf("Failed to delete category: %v", err)
+	}
+
+	category, err = db.GetCategory(ctx, drills.ID)
+	if err != nil {
+		t.Fatalf("Failed to get category: %v", err)
+	}
+	if category.ParentID == nil || *category.ParentID != tools.ID {
+		t.Errorf("Expected Drills to move under Tools, got parent %v", category.ParentID)
+	}
+}
+
+func TestProductAttributes(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	electrical, err := db.CreateCategory(ctx, &models.CreateCategoryRequest{Name: "Electrical"})
+	if err != nil {
+		t.Fatalf("Failed to create category: %v", err)
+	}
+	lamps, err := db.CreateCategory(ctx, &models.CreateCategoryRequest{Name: "Lamps", ParentID: electrical.ID})
+	if err != nil {
+		t.Fatalf("Failed to create category: %v", err)
+	}
+
+	_, err = db.SetAttributes(ctx, electrical.ID, &models.SetAttributesRequest{Attributes: []models.AttributeDefinitionRequest{
+		{Name: "voltage", Type: models.AttributeInteger, Required: true, Unit: "V"},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to set attributes: %v", err)
+	}
+	attributes, err := db.SetAttributes(ctx, lamps.ID, &models.SetAttributesRequest{Attributes: []models.AttributeDefinitionRequest{
+		{Name: "color", Type: models.AttributeEnum, Enum: []string{"white", "black"}},
+		{Name: "features", Type: models.AttributeList},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to set attributes: %v", err)
+	}
+	if len(attributes) != 3 {
+		t.Errorf("Expected lamps to inherit voltage, got %+v", attributes)
+	}
+
+	invalid := []map[string]interface{}{
+		{"color": "white"},
+		{"voltage": 230.0, "color": "purple"},
+		{"voltage": 230.0, "wattage": 60.0},
+		{"voltage": "230"},
+	}
+	for _, values := range invalid {
+		_, err := db.CreateProduct(ctx, &models.CreateProductRequest{
+			SKU:        "SKU026",
+			Name:       "Desk Lamp",
+			Volume:     1.0,
+			Weight:     1.0,
+			CategoryID: lamps.ID,
+			Attributes: values,
+		})
+		if err == nil {
+			t.Errorf("Expected attributes %v to be rejected", values)
+		}
+	}
+
+	_, err = db.CreateProduct(ctx, &models.CreateProductRequest{
+		SKU:        "SKU026",
+		Name:       "Desk Lamp",
+		Volume:     1.0,
+		Weight:     1.0,
+		CategoryID: lamps.ID,
+		Attributes: map[string]interface{}{"voltage": 230.0, "color": "white", "features": []interface{}{"dimmable", "usb"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	products, _, err := db.ListProducts(ctx, &models.ProductFilter{Attributes: map[string]string{"color": "white", "features": "dimmable"}}, nil)
+	if err != nil {
+		t.Fatalf("Failed to list products: %v", err)
+	}
+	if len(products) != 1 || products[0].SKU != "SKU026" {
+		t.Errorf("Expected SKU026 to match, got %d products", len(products))
+	}
+
+	products, _, err = db.ListProducts(ctx, &models.ProductFilter{Attributes: map[string]string{"voltage": "110"}}, nil)
+	if err != nil {
+		t.Fatalf("Failed to list products: %v", err)
+	}
+	if len(products) != 0 {
+		t.Errorf("Expected no 110V products, got %d", len(products))
+	}
+
+	_, err = db.UpdateProduct(ctx, "SKU026", &models.UpdateProductRequest{
+		Attributes: map[string]interface{}{"voltage": 12.5},
+	})
+	if err == nil {
+		t.Error("Expected non-integer voltage to be rejected")
+	}
+}
+
+func TestProductMedia(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	_, err := db.CreateProduct(ctx, &models.CreateProductRequest{
+		SKU:    "SKU027",
+		Name:   "Media Product",
+		Volume: 1.0,
+		Weight: 1.0,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	media, err := db.AddMedia(ctx, &models.ProductMedia{
+		ID:           uuid.New().String(),
+		SKU:          "SKU027",
+		Kind:         models.MediaImage,
+		Filename:     "front.png",
+		ContentType:  "image/png",
+		Size:         1024,
+		URL:          "/media/products/front.png",
+		ThumbnailURL: "/media/products/front_thumb.jpg",
+		StorageKey:   "products/front.png",
+		ThumbnailKey: "products/front_thumb.jpg",
+	})
+	if err != nil {
+		t.Fatalf("Failed to add media: %v", err)
+	}
+
+	product, err := db.GetProductBySKU(ctx, "SKU027")
+	if err != nil {
+		t.Fatalf("Failed to get product: %v", err)
+	}
+	if len(product.Media) != 1 || product.Media[0].ID != media.ID || product.Media[0].ThumbnailURL != media.ThumbnailURL {
+		t.Errorf("Expected the image on the product, got %+v", product.Media)
+	}
+
+	_, err = db.AddMedia(ctx, &models.ProductMedia{ID: uuid.New().String(), SKU: "NOPE", Kind: models.MediaDocument})
+	if err == nil {
+		t.Error("Expected media for a missing product to be rejected")
+	}
+
+	deleted, err := db.DeleteMedia(ctx, "SKU027", media.ID)
+	if err != nil {
+		t.Fatalf("Failed to delete media: %v", err)
+	}
+	if deleted.StorageKey != "products/front.png" || deleted.ThumbnailKey != "products/front_thumb.jpg" {
+		t.Errorf("Expected the storage keys back for cleanup, got %+v", deleted)
+	}
+	if _, err := db.DeleteMedia(ctx, "SKU027", media.ID); err == nil {
+		t.Error("Expected deleting twice to fail")
+	}
+}
+
+func TestProductSearch(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	for _, req := range []models.CreateProductRequest{
+		{SKU: "SKU028", Name: "Parafuso sextavado 8mm", Volume: 0.1, Weight: 0.1},
+		{SKU: "SKU029", Name: "Porca sextavada 8mm", Volume: 0.1, Weight: 0.1},
+	} {
+		if _, err := db.CreateProduct(ctx, &req); err != nil {
+			t.Fatalf("Failed to create product: %v", err)
+		}
+	}
+	if _, err := db.AddBarcode(ctx, "SKU029", &models.AddBarcodeRequest{Code: "4006381333931", Type: models.BarcodeEAN13}); err != nil {
+		t.Fatalf("Failed to add barcode: %v", err)
+	}
+
+	results, err := db.SearchProducts(ctx, &models.ProductSearchQuery{Q: "parafuzo 8mm"})
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if len(results) != 1 || results[0].SKU != "SKU028" {
+		t.Fatalf("Expected the misspelled search to find SKU028 only, got %+v", results)
+	}
+	if results[0].Highlights["name"] != "<mark>Parafuso</mark> sextavado <mark>8mm</mark>" {
+		t.Errorf("Unexpected highlight %q", results[0].Highlights["name"])
+	}
+
+	results, err = db.SearchProducts(ctx, &models.ProductSearchQuery{Q: "sextavad"})
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("Expected the prefix to match both products, got %d", len(results))
+	}
+
+	// Barcodes become searchable as soon as they are assigned
+	results, err = db.SearchProducts(ctx, &models.ProductSearchQuery{Q: "4006381333931"})
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if len(results) != 1 || results[0].SKU != "SKU029" || results[0].Rank < 1 {
+		t.Errorf("Expected an exact barcode match for SKU029 ranked first, got %+v", results)
+	}
+
+	if _, err := db.SearchProducts(ctx, &models.ProductSearchQuery{Q: "--"}); err == nil {
+		t.Error("Expected a query without words to be rejected")
+	}
+}
+
+func TestListPagination(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	for i, weight := range []float64{3, 1, 2} {
+		_, err := db.CreateProduct(ctx, &models.CreateProductRequest{
+			SKU:    fmt.Sprintf("SKU03%d", i),
+			Name:   fmt.Sprintf("Paged Product %d", i),
+			Volume: 1.0,
+			Weight: weight,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create product: %v", err)
+		}
+	}
+
+	values := url.Values{"limit": {"2"}, "sort": {"-weight"}, "name[like]": {"paged"}}
+	lq, err := listquery.Parse(values, database.ProductList)
+	if err != nil {
+		t.Fatalf("Failed to parse list query: %v", err)
+	}
+
+	products, page, err := db.ListProducts(ctx, &models.ProductFilter{}, lq)
+	if err != nil {
+		t.Fatalf("Failed to list products: %v", err)
+	}
+	if page.Total != 3 || page.NextCursor == nil {
+		t.Fatalf("Expected 3 products over more than one page, got %+v", page)
+	}
+	if len(products) != 2 || products[0].SKU != "SKU030" || products[1].SKU != "SKU032" {
+		t.Fatalf("Expected the two heaviest products first, got %+v", products)
+	}
+
+	values.Set("cursor", *page.NextCursor)
+	lq, err = listquery.Parse(values, database.ProductList)
+	if err != nil {
+		t.Fatalf("Failed to parse list query: %v", err)
+	}
+
+	products, page, err = db.ListProducts(ctx, &models.ProductFilter{}, lq)
+	if err != nil {
+		t.Fatalf("Failed to list products: %v", err)
+	}
+	if len(products) != 1 || products[0].SKU != "SKU031" || page.NextCursor != nil {
+		t.Errorf("Expected the lightest product alone on the last page, got %+v %+v", products, page)
+	}
+
+	// Per-product lists page the same way
+	for _, code := range []string{"PAGE-1", "PAGE-2"} {
+		if _, err := db.AddBarcode(ctx, "SKU030", &models.AddBarcodeRequest{Code: code, Type: models.BarcodeCode128}); err != nil {
+			t.Fatalf("Failed to add barcode: %v", err)
+		}
+	}
+
+	values = url.Values{"limit": {"1"}}
+	lq, err = listquery.Parse(values, database.BarcodeList)
+	if err != nil {
+		t.Fatalf("Failed to parse list query: %v", err)
+	}
+	barcodes, page, err := db.ListBarcodes(ctx, "SKU030", lq)
+	if err != nil {
+		t.Fatalf("Failed to list barcodes: %v", err)
+	}
+	if len(barcodes) != 1 || barcodes[0].Code != "PAGE-1" || page.Total != 2 || page.NextCursor == nil {
+		t.Fatalf("Expected the first of 2 barcodes, got %+v %+v", barcodes, page)
+	}
+
+	values.Set("cursor", *page.NextCursor)
+	lq, err = listquery.Parse(values, database.BarcodeList)
+	if err != nil {
+		t.Fatalf("Failed to parse list query: %v", err)
+	}
+	barcodes, page, err = db.ListBarcodes(ctx, "SKU030", lq)
+	if err != nil {
+		t.Fatalf("Failed to list barcodes: %v", err)
+	}
+	if len(barcodes) != 1 || barcodes[0].Code != "PAGE-2" || page.NextCursor != nil {
+		t.Errorf("Expected the second barcode alone on the last page, got %+v %+v", barcodes, page)
+	}
+}
+
+func TestArchiving(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	_, err := db.CreateProduct(ctx, &models.CreateProductRequest{SKU: "SKU033", Name: "Archived Product", Volume: 1.0, Weight: 1.0, ReorderPoint: 5})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	shelf, err := db.CreateShelf(ctx, &models.CreateShelfRequest{Name: "Archive Shelf", RowIndex: 8, ColIndex: 1, MaxVolume: 100.0})
+	if err != nil {
+		t.Fatalf("Failed to create shelf: %v", err)
+	}
+
+	// Units on their way in keep the product in use until they are shelved
+	document, err := db.CreateInboundDocument(ctx, &models.CreateInboundRequest{
+		Type:      models.InboundPurchaseOrder,
+		Reference: "PO-ARCHIVE",
+		Lines:     []models.CreateInboundLineRequest{{SKU: "SKU033", Quantity: 2}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create inbound document: %v", err)
+	}
+	if _, err := db.ArchiveProduct(ctx, "SKU033"); err == nil {
+		t.Error("Expected a product on an open inbound document to be kept")
+	}
+
+	_, err = db.ReceiveInbound(ctx, document.ID, &models.ReceiveRequest{
+		Lines: []models.ReceiveLineRequest{{SKU: "SKU033", Quantity: 2}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to receive: %v", err)
+	}
+	if _, err := db.CloseInbound(ctx, document.ID); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if _, err := db.ArchiveProduct(ctx, "SKU033"); err == nil {
+		t.Error("Expected a product with staged units to be kept")
+	}
+
+	staged, _, err := db.ListStagedItems(ctx, document.ID, nil)
+	if err != nil || len(staged) != 1 {
+		t.Fatalf("Failed to list staged items: %v %v", staged, err)
+	}
+	item, err := db.PutawayStagedItem(ctx, staged[0].ID, &models.PutawayRequest{ShelfID: shelf.ID, Quantity: 2})
+	if err != nil {
+		t.Fatalf("Failed to put away: %v", err)
+	}
+
+	// Neither can be archived while stock sits on the shelf
+	if _, err := db.ArchiveShelf(ctx, shelf.ID); err == nil {
+		t.Error("Expected a shelf holding stock to be kept")
+	}
+	if _, err := db.ArchiveProduct(ctx, "SKU033"); err == nil {
+		t.Error("Expected a product on a shelf to be kept")
+	}
+
+	if err := db.RemoveItemFromShelf(ctx, item.ID); err != nil {
+		t.Fatalf("Failed to remove item: %v", err)
+	}
+
+	archivedShelf, err := db.ArchiveShelf(ctx, shelf.ID)
+	if err != nil {
+		t.Fatalf("Failed to archive shelf: %v", err)
+	}
+	if archivedShelf.ArchivedAt == nil {
+		t.Error("Expected the shelf to be marked archived")
+	}
+	if _, err := db.ArchiveProduct(ctx, "SKU033"); err != nil {
+		t.Fatalf("Failed to archive product: %v", err)
+	}
+
+	// Archived rows leave the default lists and show up on request
+	shelves, _, err := db.ListShelfs(ctx, &models.ShelfFilter{}, nil)
+	if err != nil {
+		t.Fatalf("Failed to list shelves: %v", err)
+	}
+	for _, s := range shelves {
+		if s.ID == shelf.ID {
+			t.Error("Expected the archived shelf to be left out")
+		}
+	}
+	products, _, err := db.ListProducts(ctx, &models.ProductFilter{Archived: true}, nil)
+	if err != nil {
+		t.Fatalf("Failed to list products: %v", err)
+	}
+	found := false
+	for _, p := range products {
+		found = found || p.SKU == "SKU033"
+	}
+	if !found {
+		t.Error("Expected the archived product among the archived list")
+	}
+
+	if _, err := db.AddItemToShelf(ctx, shelf.ID, &models.AddItemToShelfRequest{SKU: "SKU002", Quantity: 1}); err == nil {
+		t.Error("Expected an archived shelf to refuse stock")
+	}
+
+	if _, err := db.RestoreShelf(ctx, shelf.ID); err != nil {
+		t.Fatalf("Failed to restore shelf: %v", err)
+	}
+	if _, err := db.AddItemToShelf(ctx, shelf.ID, &models.AddItemToShelfRequest{SKU: "SKU033", Quantity: 1}); err == nil {
+		t.Error("Expected an archived product to refuse stock")
+	}
+
+	// Archived products are neither reordered nor put away
+	if _, err := db.SuggestPutaway(ctx, &models.PutawaySuggestRequest{SKU: "SKU033", Quantity: 1}); err == nil {
+		t.Error("Expected no putaway suggestions for an archived product")
+	}
+	suggestions, _, err := db.ListBelowReorder(ctx, nil)
+	if err != nil {
+		t.Fatalf("Failed to list reorder suggestions: %v", err)
+	}
+	for _, s := range suggestions {
+		if s.SKU == "SKU033" {
+			t.Error("Expected the archived product to be left out of reordering")
+		}
+	}
+	if err := db.CheckStockLevels(ctx, "SKU033"); err != nil {
+		t.Fatalf("Failed to check stock levels: %v", err)
+	}
+	alerts, _, err := db.ListStockAlerts(ctx, false, nil)
+	if err != nil {
+		t.Fatalf("Failed to list alerts: %v", err)
+	}
+	for _, alert := range alerts {
+		if alert.SKU == "SKU033" {
+			t.Errorf("Expected no open alerts for the archived product, got %+v", alert)
+		}
+	}
+
+	product, err := db.RestoreProduct(ctx, "SKU033")
+	if err != nil {
+		t.Fatalf("Failed to restore product: %v", err)
+	}
+	if product.ArchivedAt != nil || product.ArchivedBy != nil {
+		t.Errorf("Expected the product to be active again, got %+v", product)
+	}
+	if _, err := db.RestoreProduct(ctx, "SKU033"); err == nil {
+		t.Error("Expected restoring an active product to fail")
 	}
 }
 
@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/aslam/backend/internal/label"
+)
+
+func TestLabelRender(t *testing.T) {
+	labels := []label.Label{
+		{Lines: []string{"SKU001", "Test Product"}, Code: "SKU001", Symbology: label.Code128},
+		{Lines: []string{"Shelf A1", "Row 0 / Col 1"}, Code: "SHELF:3f2504e0-4f89-11d3-9a0c-0305e82c3301", Symbology: label.QR},
+	}
+
+	svg, err := label.Render(label.SVG, labels)
+	if err != nil {
+		t.Fatalf("Failed to render SVG: %v", err)
+	}
+	if !bytes.HasPrefix(svg, []byte("<svg")) || bytes.Count(svg, []byte("<g ")) != 2 {
+		t.Errorf("Expected an SVG with two labels, got %s", svg)
+	}
+
+	data, err := label.Render(label.PNG, labels)
+	if err != nil {
+		t.Fatalf("Failed to render PNG: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != label.Width || b.Dy() != 2*label.Height {
+		t.Errorf("Expected %dx%d image, got %v", label.Width, 2*label.Height, b)
+	}
+
+	zpl, err := label.Render(label.ZPL, labels)
+	if err != nil {
+		t.Fatalf("Failed to render ZPL: %v", err)
+	}
+	out := string(zpl)
+	if strings.Count(out, "^XA") != 2 || strings.Count(out, "^XZ") != 2 {
+		t.Errorf("Expected two ZPL formats, got %s", out)
+	}
+	if !strings.Contains(out, "^BCN") || !strings.Contains(out, "^BQN") {
+		t.Errorf("Expected Code128 and QR commands, got %s", out)
+	}
+
+	// Field data cannot start a ZPL command
+	zpl, err = label.Render(label.ZPL, []label.Label{{Lines: []string{"A^B~C"}, Code: "X", Symbology: label.Code128}})
+	if err != nil {
+		t.Fatalf("Failed to render ZPL: %v", err)
+	}
+	if !strings.Contains(string(zpl), "A_5EB_7EC") {
+		t.Errorf("Expected escaped field data, got %s", zpl)
+	}
+
+	// Sheets are bounded so one request cannot allocate a huge image
+	many := make([]label.Label, label.MaxLabels+1)
+	for i := range many {
+		many[i] = label.Label{Lines: []string{"Shelf"}, Code: "X", Symbology: label.Code128}
+	}
+	if _, err := label.Render(label.PNG, many); err == nil {
+		t.Error("Expected too many labels to be rejected")
+	}
+}
@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aslam/backend/internal/listquery"
+)
+
+var testListSpec = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"id":         {Column: "id", Type: listquery.UUID},
+		"name":       {Column: "name", Type: listquery.String},
+		"weight":     {Column: "weight", Type: listquery.Number},
+		"status":     {Column: "status", Type: listquery.String},
+		"created_at": {Column: "created_at", Type: listquery.Time},
+	},
+	Sort: []listquery.Sort{{Field: "created_at", Desc: true}},
+	Key:  "id",
+}
+
+func TestListQueryParse(t *testing.T) {
+	values, _ := url.ParseQuery("limit=20&sort=name,-weight&name[like]=50%25_off&weight[gt]=2.5&status[in]=open,picking&created_at[lt]=2026-01-02T03:04:05-03:00&attr[color]=red")
+	lq, err := listquery.Parse(values, testListSpec)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	if lq.Limit != 20 {
+		t.Errorf("Expected limit 20, got %d", lq.Limit)
+	}
+	wantSort := []listquery.Sort{{Field: "name"}, {Field: "weight", Desc: true}, {Field: "id"}}
+	if !reflect.DeepEqual(lq.Sort, wantSort) {
+		t.Errorf("Expected sort %v, got %v", wantSort, lq.Sort)
+	}
+
+	conditions, args := lq.FilterWhere([]string{"category_id = $1"}, []interface{}{"c"})
+	wantConditions := []string{
+		"category_id = $1",
+		"created_at < $2::timestamp",
+		`name ILIKE '%' || $3::text || '%'`,
+		"status IN ($4::text, $5::text)",
+		"weight > $6::numeric",
+	}
+	if !reflect.DeepEqual(conditions, wantConditions) {
+		t.Errorf("Expected conditions %q, got %q", wantConditions, conditions)
+	}
+	wantArgs := []interface{}{"c", "2026-01-02 06:04:05", `50\%\_off`, "open", "picking", "2.5"}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("Expected args %q, got %q", wantArgs, args)
+	}
+
+	if got := lq.OrderBy(); got != "ORDER BY name ASC, weight DESC, id ASC LIMIT 21" {
+		t.Errorf("Unexpected order %q", got)
+	}
+}
+
+func TestListQueryInvalid(t *testing.T) {
+	invalid := []string{
+		"limit=0",
+		"limit=1000",
+		"sort=password",
+		"weight[gt]=heavy",
+		"id[eq]=42",
+		"weight[like]=2",
+		"created_at[gt]=yesterday",
+		"cursor=garbage",
+	}
+
+	for _, query := range invalid {
+		values, _ := url.ParseQuery(query)
+		if _, err := listquery.Parse(values, testListSpec); err == nil {
+			t.Errorf("Expected %q to be rejected", query)
+		}
+	}
+}
+
+func TestListQueryCursor(t *testing.T) {
+	values, _ := url.ParseQuery("sort=name,-weight")
+	lq, err := listquery.Parse(values, testListSpec)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if got := lq.CursorColumn(); got != "json_build_array(name, weight, id)::text" {
+		t.Errorf("Unexpected cursor column %q", got)
+	}
+
+	cursor := lq.Cursor(`["Bolt", 2.50, "3f2504e0-4f89-11d3-9a0c-0305e82c3301"]`)
+
+	values.Set("cursor", cursor)
+	next, err := listquery.Parse(values, testListSpec)
+	if err != nil {
+		t.Fatalf("Failed to parse cursor: %v", err)
+	}
+
+	conditions, args := next.AfterWhere(nil, nil)
+	want := "((name > $1::text) OR (name = $1::text AND weight < $2::numeric) OR " +
+		"(name = $1::text AND weight = $2::numeric AND id > $3::uuid))"
+	if len(conditions) != 1 || conditions[0] != want {
+		t.Errorf("Expected %q, got %q", want, conditions)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"Bolt", "2.50", "3f2504e0-4f89-11d3-9a0c-0305e82c3301"}) {
+		t.Errorf("Unexpected cursor args %q", args)
+	}
+
+	// Values are checked against their field types like filter values
+	for _, after := range []string{
+		`["Bolt", "heavy", "3f2504e0-4f89-11d3-9a0c-0305e82c3301"]`,
+		`["Bolt", 2.50, "42"]`,
+	} {
+		values.Set("cursor", lq.Cursor(after))
+		if _, err := listquery.Parse(values, testListSpec); err == nil || err.Error() != "invalid cursor" {
+			t.Errorf("Expected cursor %s to be rejected, got %v", after, err)
+		}
+	}
+
+	// Timestamps come back from Postgres without a zone
+	byDate := listquery.All(testListSpec)
+	dateValues := url.Values{"cursor": {byDate.Cursor(`["2026-01-02T03:04:05.123456", "3f2504e0-4f89-11d3-9a0c-0305e82c3301"]`)}}
+	next, err = listquery.Parse(dateValues, testListSpec)
+	if err != nil {
+		t.Fatalf("Failed to parse time cursor: %v", err)
+	}
+	if _, args := next.AfterWhere(nil, nil); len(args) != 2 || args[0] != "2026-01-02 03:04:05.123456" {
+		t.Errorf("Unexpected time cursor args %q", args)
+	}
+
+	// A cursor only makes sense under the sort it was made for
+	values.Set("cursor", cursor)
+	values.Set("sort", "name")
+	if _, err := listquery.Parse(values, testListSpec); err == nil || !strings.Contains(err.Error(), "sort") {
+		t.Errorf("Expected a cursor from another sort to be rejected, got %v", err)
+	}
+}
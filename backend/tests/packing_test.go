@@ -0,0 +1,56 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/aslam/backend/internal/packing"
+)
+
+func TestPackingFits(t *testing.T) {
+	shelf := packing.Box{Length: 100, Width: 50, Height: 40}
+
+	tests := []struct {
+		name  string
+		items []packing.Box
+		want  bool
+	}{
+		{
+			name:  "single box",
+			items: []packing.Box{{Length: 50, Width: 50, Height: 40}},
+			want:  true,
+		},
+		{
+			name:  "too tall even with free volume",
+			items: []packing.Box{{Length: 10, Width: 10, Height: 120}},
+			want:  false,
+		},
+		{
+			name:  "fits only when rotated",
+			items: []packing.Box{{Length: 40, Width: 30, Height: 90}},
+			want:  true,
+		},
+		{
+			name: "exact tiling",
+			items: []packing.Box{
+				{Length: 50, Width: 50, Height: 20}, {Length: 50, Width: 50, Height: 20},
+				{Length: 50, Width: 50, Height: 20}, {Length: 50, Width: 50, Height: 20},
+			},
+			want: true,
+		},
+		{
+			name: "volume exceeded",
+			items: []packing.Box{
+				{Length: 100, Width: 50, Height: 30}, {Length: 100, Width: 50, Height: 30},
+			},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := packing.Fits(shelf, tt.items); got != tt.want {
+				t.Errorf("Fits() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
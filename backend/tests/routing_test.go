@@ -0,0 +1,186 @@
+package tests
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aslam/backend/internal/routing"
+)
+
+func TestRoutingDistance(t *testing.T) {
+	grid := routing.Grid{Cols: 10}
+
+	tests := []struct {
+		name string
+		a, b routing.Location
+		want float64
+	}{
+		{
+			name: "same aisle",
+			a:    routing.Location{Row: 0, Col: 2},
+			b:    routing.Location{Row: 1, Col: 7},
+			want: 5,
+		},
+		{
+			name: "across the front",
+			a:    routing.Location{Row: 0, Col: 1},
+			b:    routing.Location{Row: 2, Col: 0},
+			want: 5,
+		},
+		{
+			name: "across the back",
+			a:    routing.Location{Row: 0, Col: 9},
+			b:    routing.Location{Row: 4, Col: 8},
+			want: 7,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := grid.Distance(tt.a, tt.b); got != tt.want {
+				t.Errorf("Distance() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoutingOptimize(t *testing.T) {
+	grid := routing.Grid{Cols: 10}
+	depot := routing.Location{Row: 0, Col: -1}
+
+	stops := []routing.Stop{
+		{ID: "c", Location: routing.Location{Row: 4, Col: 1}},
+		{ID: "a", Location: routing.Location{Row: 0, Col: 3}},
+		{ID: "d", Location: routing.Location{Row: 0, Col: 8}},
+		{ID: "b", Location: routing.Location{Row: 2, Col: 5}},
+	}
+
+	for _, strategy := range []routing.Strategy{routing.SShape, routing.LargestGap, routing.TwoOpt, routing.Best} {
+		t.Run(string(strategy), func(t *testing.T) {
+			route, err := routing.Optimize(grid, depot, depot, stops, strategy)
+			if err != nil {
+				t.Fatalf("Optimize() error: %v", err)
+			}
+
+			if len(route.Stops) != len(stops) {
+				t.Fatalf("Expected %d stops, got %d", len(stops), len(route.Stops))
+			}
+
+			seen := make(map[string]bool)
+			for _, stop := range route.Stops {
+				seen[stop.ID] = true
+			}
+			if len(seen) != len(stops) {
+				t.Errorf("Expected every stop exactly once, got %v", route.Stops)
+			}
+
+			// A walk out and back along the first aisle is a lower bound
+			if route.Distance < 18 {
+				t.Errorf("Distance %v is shorter than possible", route.Distance)
+			}
+		})
+	}
+
+	best, _ := routing.Optimize(grid, depot, depot, stops, routing.Best)
+	for _, strategy := range []routing.Strategy{routing.SShape, routing.LargestGap, routing.TwoOpt} {
+		route, _ := routing.Optimize(grid, depot, depot, stops, strategy)
+		if best.Distance > route.Distance {
+			t.Errorf("Best route %v is longer than %s route %v", best.Distance, strategy, route.Distance)
+		}
+	}
+
+	if _, err := routing.Optimize(grid, depot, depot, stops, "random"); err == nil {
+		t.Error("Expected unknown strategy error")
+	}
+}
+
+func TestRoutingSeparateEnd(t *testing.T) {
+	grid := routing.Grid{Cols: 10}
+
+	tests := []struct {
+		name       string
+		start, end routing.Location
+		stops      []routing.Stop
+		want       []string
+		distance   float64
+	}{
+		{
+			name:  "one aisle",
+			start: routing.Location{Row: 0, Col: 4},
+			end:   routing.Location{Row: 0, Col: -1},
+			stops: []routing.Stop{
+				{ID: "a", Location: routing.Location{Row: 0, Col: 2}},
+				{ID: "b", Location: routing.Location{Row: 1, Col: 8}},
+			},
+			want:     []string{"b", "a"},
+			distance: 13,
+		},
+		{
+			name:  "two aisles",
+			start: routing.Location{Row: 0, Col: -1},
+			end:   routing.Location{Row: 2, Col: -1},
+			stops: []routing.Stop{
+				{ID: "d", Location: routing.Location{Row: 3, Col: 8}},
+				{ID: "a", Location: routing.Location{Row: 0, Col: 2}},
+				{ID: "c", Location: routing.Location{Row: 2, Col: 2}},
+				{ID: "b", Location: routing.Location{Row: 1, Col: 6}},
+			},
+			want:     []string{"a", "b", "d", "c"},
+			distance: 24,
+		},
+	}
+
+	for _, tt := range tests {
+		for _, strategy := range []routing.Strategy{routing.SShape, routing.LargestGap} {
+			t.Run(tt.name+"/"+string(strategy), func(t *testing.T) {
+				route, err := routing.Optimize(grid, tt.start, tt.end, tt.stops, strategy)
+				if err != nil {
+					t.Fatalf("Optimize() error: %v", err)
+				}
+
+				var got []string
+				for _, stop := range route.Stops {
+					got = append(got, stop.ID)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Expected stops %v, got %v", tt.want, got)
+				}
+				if route.Distance != tt.distance {
+					t.Errorf("Expected distance %v, got %v", tt.distance, route.Distance)
+				}
+			})
+		}
+	}
+}
+
+func TestRoutingLargestGapOrder(t *testing.T) {
+	grid := routing.Grid{Cols: 10}
+	depot := routing.Location{Row: 0, Col: -1}
+
+	// The middle aisle splits at its gap: d is picked from the back cross
+	// aisle on the way out, c from the front cross aisle on the way back
+	stops := []routing.Stop{
+		{ID: "c", Location: routing.Location{Row: 2, Col: 1}},
+		{ID: "e", Location: routing.Location{Row: 4, Col: 3}},
+		{ID: "a", Location: routing.Location{Row: 0, Col: 2}},
+		{ID: "f", Location: routing.Location{Row: 5, Col: 7}},
+		{ID: "d", Location: routing.Location{Row: 3, Col: 8}},
+		{ID: "b", Location: routing.Location{Row: 1, Col: 6}},
+	}
+
+	route, err := routing.Optimize(grid, depot, depot, stops, routing.LargestGap)
+	if err != nil {
+		t.Fatalf("Optimize() error: %v", err)
+	}
+
+	var got []string
+	for _, stop := range route.Stops {
+		got = append(got, stop.ID)
+	}
+	if want := []string{"a", "b", "d", "f", "e", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected stops %v, got %v", want, got)
+	}
+	if route.Distance != 38 {
+		t.Errorf("Expected distance 38, got %v", route.Distance)
+	}
+}
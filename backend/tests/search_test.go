@@ -0,0 +1,53 @@
+package tests
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aslam/backend/internal/search"
+)
+
+func TestSearchTerms(t *testing.T) {
+	got := search.Terms("Parafuso 8mm, parafuso  M8-Inox")
+	want := []string{"parafuso", "8mm", "m8", "inox"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	if terms := search.Terms(" -- "); len(terms) != 0 {
+		t.Errorf("Expected no terms, got %v", terms)
+	}
+}
+
+func TestSearchHighlight(t *testing.T) {
+	tests := []struct {
+		text    string
+		terms   []string
+		want    string
+		matched bool
+	}{
+		{"Parafuso sextavado 8mm", []string{"parafuzo", "8mm"}, "<mark>Parafuso</mark> sextavado <mark>8mm</mark>", true},
+		{"Porca <M8>", []string{"por"}, "<mark>Porca</mark> &lt;M8&gt;", true},
+		{"Arruela lisa", []string{"parafuso"}, "Arruela lisa", false},
+	}
+
+	for _, tt := range tests {
+		got, matched := search.Highlight(tt.text, tt.terms)
+		if got != tt.want || matched != tt.matched {
+			t.Errorf("Highlight(%q, %v) = %q, %v; want %q, %v", tt.text, tt.terms, got, matched, tt.want, tt.matched)
+		}
+	}
+}
+
+func TestSearchSimilarity(t *testing.T) {
+	if s := search.Similarity("word", "word"); s != 1 {
+		t.Errorf("Expected identical words to be fully similar, got %v", s)
+	}
+	// pg_trgm gives 0.5 for one substituted letter near the end
+	if s := search.Similarity("parafuso", "parafuzo"); s != 0.5 {
+		t.Errorf("Expected 0.5, got %v", s)
+	}
+	if s := search.Similarity("parafuso", "arruela"); s > 0.2 {
+		t.Errorf("Expected unrelated words to be dissimilar, got %v", s)
+	}
+}
@@ -0,0 +1,192 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aslam/backend/internal/imaging"
+	"github.com/aslam/backend/internal/storage"
+)
+
+// fakeS3 stands in for an S3-compatible service, keeping objects in memory
+// and rejecting requests that are not signed.
+type fakeS3 struct {
+	t       *testing.T
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=minio/") ||
+		!strings.Contains(auth, "/us-east-1/s3/aws4_request") ||
+		!strings.Contains(auth, "SignedHeaders=") || !strings.Contains(auth, "Signature=") {
+		f.t.Errorf("Unexpected Authorization header %q", auth)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	hash := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(hash[:]) {
+		f.t.Errorf("Payload hash does not match the body of %s %s", r.Method, r.URL.Path)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[r.URL.Path] = body
+		f.types[r.URL.Path] = r.Header.Get("Content-Type")
+	case http.MethodGet:
+		data, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", f.types[r.URL.Path])
+		w.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func testStorageRoundTrip(t *testing.T, store storage.Storage) {
+	ctx := context.Background()
+	data := []byte("%PDF-1.4 datasheet")
+
+	if err := store.Put(ctx, "products/sheet.pdf", bytes.NewReader(data), int64(len(data)), "application/pdf"); err != nil {
+		t.Fatalf("Failed to put object: %v", err)
+	}
+
+	r, contentType, err := store.Get(ctx, "products/sheet.pdf")
+	if err != nil {
+		t.Fatalf("Failed to get object: %v", err)
+	}
+	got, _ := io.ReadAll(r)
+	r.Close()
+	if !bytes.Equal(got, data) || contentType != "application/pdf" {
+		t.Errorf("Expected the stored PDF back, got %q as %s", got, contentType)
+	}
+
+	if err := store.Delete(ctx, "products/sheet.pdf"); err != nil {
+		t.Fatalf("Failed to delete object: %v", err)
+	}
+	if _, _, err := store.Get(ctx, "products/sheet.pdf"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected deleted object to be gone, got %v", err)
+	}
+	if err := store.Delete(ctx, "products/sheet.pdf"); err != nil {
+		t.Errorf("Expected deleting a missing object to succeed, got %v", err)
+	}
+}
+
+func TestLocalStorage(t *testing.T) {
+	store, err := storage.NewLocal(t.TempDir(), "/media/")
+	if err != nil {
+		t.Fatalf("Failed to create local storage: %v", err)
+	}
+
+	testStorageRoundTrip(t, store)
+
+	if url := store.URL("products/a.jpg"); url != "/media/products/a.jpg" {
+		t.Errorf("Unexpected URL %s", url)
+	}
+
+	err = store.Put(context.Background(), `..\escape.txt`, strings.NewReader("x"), 1, "text/plain")
+	if err == nil {
+		t.Error("Expected keys with backslashes to be rejected")
+	}
+}
+
+func TestS3Storage(t *testing.T) {
+	fake := &fakeS3{t: t, objects: map[string][]byte{}, types: map[string]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	store, err := storage.NewS3(server.URL, "media", "", "minio", "minio-secret", "")
+	if err != nil {
+		t.Fatalf("Failed to create S3 storage: %v", err)
+	}
+
+	testStorageRoundTrip(t, store)
+
+	if url := store.URL("products/a b.jpg"); url != server.URL+"/media/products/a%20b.jpg" {
+		t.Errorf("Unexpected URL %s", url)
+	}
+
+	public, _ := storage.NewS3(server.URL, "media", "", "minio", "minio-secret", "https://cdn.example.com/")
+	if url := public.URL("products/a.jpg"); url != "https://cdn.example.com/products/a.jpg" {
+		t.Errorf("Unexpected public URL %s", url)
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	// A wide image, opaque red on the left and transparent on the right
+	src := image.NewNRGBA(image.Rect(0, 0, 1000, 500))
+	for y := 0; y < 500; y++ {
+		for x := 0; x < 500; x++ {
+			src.Set(x, y, color.NRGBA{R: 255, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+
+	data, err := imaging.Thumbnail(&buf, imaging.ThumbnailSize)
+	if err != nil {
+		t.Fatalf("Failed to create thumbnail: %v", err)
+	}
+
+	thumb, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Thumbnail is not a JPEG: %v", err)
+	}
+	if b := thumb.Bounds(); b.Dx() != 256 || b.Dy() != 128 {
+		t.Errorf("Expected a 256x128 thumbnail, got %dx%d", b.Dx(), b.Dy())
+	}
+
+	r, g, _, _ := thumb.At(10, 64).RGBA()
+	if r>>8 < 200 || g>>8 > 60 {
+		t.Errorf("Expected the left side to stay red, got %v", thumb.At(10, 64))
+	}
+	r, g, b, _ := thumb.At(240, 64).RGBA()
+	if r>>8 < 200 || g>>8 < 200 || b>>8 < 200 {
+		t.Errorf("Expected transparency to be flattened onto white, got %v", thumb.At(240, 64))
+	}
+
+	if _, err := imaging.Thumbnail(strings.NewReader("not an image"), imaging.ThumbnailSize); err == nil {
+		t.Error("Expected non-images to be rejected")
+	}
+
+	// A tiny GIF whose header claims 65535x65535 pixels must be refused
+	// before it is decoded
+	buf.Reset()
+	if err := gif.Encode(&buf, image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{color.White}), nil); err != nil {
+		t.Fatalf("Failed to encode GIF: %v", err)
+	}
+	bomb := buf.Bytes()
+	binary.LittleEndian.PutUint16(bomb[6:], 65535)
+	binary.LittleEndian.PutUint16(bomb[8:], 65535)
+	if _, err := imaging.Thumbnail(bytes.NewReader(bomb), imaging.ThumbnailSize); err == nil || !strings.Contains(err.Error(), "megapixels") {
+		t.Errorf("Expected an oversized image to be rejected, got %v", err)
+	}
+}
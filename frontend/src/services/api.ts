@@ -59,6 +59,24 @@ class APIClient {
     return !!this.token;
   }
 
+  // Lista paginada: segue next_cursor até a última página
+  private async listAll<T>(path: string, key: string): Promise<T[]> {
+    const items: T[] = [];
+    let cursor: string | null = null;
+    do {
+      const params: Record<string, string | number> = { limit: 200 };
+      if (cursor) {
+        params.cursor = cursor;
+      }
+      const response = await this.client.get<Record<string, unknown>>(path, {
+        params,
+      });
+      items.push(...((response.data[key] as T[] | null) ?? []));
+      cursor = response.data.next_cursor as string | null;
+    } while (cursor);
+    return items;
+  }
+
   // Auth endpoints
   async login(email: string, password: string): Promise<AuthResponse> {
     const response = await this.client.post<AuthResponse>("/auth/login", {
@@ -93,8 +111,7 @@ class APIClient {
   }
 
   async listUsers(): Promise<User[]> {
-    const response = await this.client.get<{ users: User[] }>("/users");
-    return response.data.users;
+    return this.listAll<User>("/users", "users");
   }
 
   async deleteUser(id: string): Promise<void> {
@@ -123,10 +140,7 @@ class APIClient {
   }
 
   async listProducts(): Promise<Product[]> {
-    const response = await this.client.get<{ products: Product[] }>(
-      "/products",
-    );
-    return response.data.products;
+    return this.listAll<Product>("/products", "products");
   }
 
   async updateProduct(
@@ -169,8 +183,7 @@ class APIClient {
   }
 
   async listShelves(): Promise<Shelf[]> {
-    const response = await this.client.get<{ shelves: Shelf[] }>("/shelves");
-    return response.data.shelves;
+    return this.listAll<Shelf>("/shelves", "shelves");
   }
 
   async updateShelf(